@@ -55,6 +55,6 @@ func GetCipherSuite(s string) (CipherSuite, error) {
 	case "CHACHA20_POLY1305":
 		return CHACHA20_POLY1305, nil
 	default:
-		return 0, fmt.Errorf("unknown cipher suite %q", s)
+		return 0, fmt.Errorf("%w %q", ErrUnknownCipherSuite, s)
 	}
 }
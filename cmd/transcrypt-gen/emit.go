@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const transcryptImport = `"github.com/jantytgat/go-transcrypt"`
+
+// emitFile writes the generated file for decls. The output is formatted by
+// the caller.
+func emitFile(buf *bytes.Buffer, pkgName string, imports []string, decls []*typeDecl) {
+	var body bytes.Buffer
+	for _, decl := range decls {
+		emitDecl(&body, decl)
+	}
+
+	// Paths are only formatted with fmt when a field holds a slice, array or
+	// map.
+	if bytes.Contains(body.Bytes(), []byte("fmt.Sprintf")) {
+		imports = append(imports, `"fmt"`)
+	}
+	imports = append(imports, transcryptImport)
+
+	// Standard library imports come first, as goimports groups them; format
+	// sorts each group.
+	var std, other []string
+	for _, spec := range imports {
+		if path := spec[strings.IndexByte(spec, '"')+1:]; strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	fmt.Fprintf(buf, "// Code generated by transcrypt-gen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkgName)
+	if len(std) > 0 {
+		buf.WriteString(strings.Join(std, "\n") + "\n\n")
+	}
+	buf.WriteString(strings.Join(other, "\n") + "\n)\n")
+	buf.Write(body.Bytes())
+}
+
+// emitDecl writes the mirror type and the functions of one annotated type.
+func emitDecl(buf *bytes.Buffer, decl *typeDecl) {
+	p, m := decl.name, decl.mirror
+	encrypt, decrypt := funcName("Encrypt", p, ""), funcName("Decrypt", p, "")
+	encryptWith, decryptWith := funcName("Encrypt", p, "With"), funcName("Decrypt", p, "With")
+
+	fmt.Fprintf(buf, "\n// %s is the encrypted mirror of %s.\ntype %s struct {\n", m, p, m)
+	for _, f := range decl.fields {
+		fmt.Fprintf(buf, "%s %s %s\n", f.name, f.shape.mirror, f.tag)
+	}
+	buf.WriteString("}\n")
+
+	fmt.Fprintf(buf, `
+// %[1]s encrypts v into its mirror %[3]s, as
+// transcrypt.Encrypt[%[3]s] does.
+func %[1]s(key []byte, cipherSuite transcrypt.CipherSuite, v %[2]s, opts ...transcrypt.Option) (%[3]s, error) {
+	// The full slice expression makes append copy opts rather than write into
+	// the caller's backing array.
+	e, err := transcrypt.NewEncryptor(key, append(opts[:len(opts):len(opts)], transcrypt.WithCipherSuite(cipherSuite))...)
+	if err != nil {
+		return %[3]s{}, err
+	}
+	return %[4]s(e, v)
+}
+
+// %[5]s decrypts v back into %[2]s, as
+// transcrypt.Decrypt[%[2]s] does.
+func %[5]s(key []byte, v %[3]s, opts ...transcrypt.Option) (%[2]s, error) {
+	e, err := transcrypt.NewEncryptor(key, opts...)
+	if err != nil {
+		return %[2]s{}, err
+	}
+	return %[6]s(e, v)
+}
+`, encrypt, p, m, encryptWith, decrypt, decryptWith)
+
+	fmt.Fprintf(buf, `
+// %[1]s encrypts v into its mirror %[2]s using e's key
+// and options, as transcrypt.EncryptWith[%[2]s] does.
+func %[1]s(e *transcrypt.Encryptor, v %[3]s) (%[2]s, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		return %[2]s{}, err
+	}
+	return %[4]s(c, v)
+}
+
+// %[5]s decrypts v back into %[3]s using e's key and
+// options, as transcrypt.DecryptWith[%[3]s] does.
+func %[5]s(e *transcrypt.Encryptor, v %[2]s) (%[3]s, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		return %[3]s{}, err
+	}
+	return %[6]s(c, v)
+}
+`, encryptWith, m, p, fieldsFunc("encrypt", p), decryptWith, fieldsFunc("decrypt", p))
+
+	emitWalker(buf, decl, true, fmt.Sprintf(
+		"\n// %s encrypts v into %s with the options and key\n// resolved in c.\nfunc %s(c *transcrypt.FieldCodec, v %s) (%s, error) {\n",
+		fieldsFunc("encrypt", p), m, fieldsFunc("encrypt", p), p, m), m)
+	emitWalker(buf, decl, false, fmt.Sprintf(
+		"\n// %s decrypts v into %s with the options and key\n// resolved in c.\nfunc %s(c *transcrypt.FieldCodec, v %s) (%s, error) {\n",
+		fieldsFunc("decrypt", p), p, fieldsFunc("decrypt", p), m, p), p)
+}
+
+// fieldsFunc is the name of the unexported function converting the fields of
+// the plain type name with a resolved FieldCodec, which nested annotated
+// types call directly so the options and key are resolved once per call.
+func fieldsFunc(verb, name string) string {
+	return verb + upperFirst(name) + "Fields"
+}
+
+// emitWalker writes the body of the Fields function for one direction, after
+// its header. out is the result type.
+func emitWalker(buf *bytes.Buffer, decl *typeDecl, encrypt bool, header, out string) {
+	w := &walker{encrypt: encrypt, zero: out + "{}"}
+	for _, f := range decl.fields {
+		w.emit(f.shape, "v."+f.name, "out."+f.name, []string{strconv.Quote(f.match)}, 0)
+	}
+
+	buf.WriteString(header)
+	fmt.Fprintf(buf, "var out %s\n", out)
+	if w.usesErr {
+		buf.WriteString("var err error\n")
+	}
+	buf.Write(w.body.Bytes())
+	buf.WriteString("return out, nil\n}\n")
+}
+
+// walker emits the statements converting one value into its counterpart,
+// the generated equivalent of the library's plan walkers.
+type walker struct {
+	encrypt bool
+	// zero is the zero value returned on error.
+	zero    string
+	body    bytes.Buffer
+	usesErr bool
+}
+
+// emit writes the statements assigning the converted value of src to dst.
+// path holds the Go expressions of the path elements reported on error, and
+// depth numbers the loop and temporary variables of nested composites.
+func (w *walker) emit(s *shape, src, dst string, path []string, depth int) {
+	switch s.kind {
+	case shapeCopy:
+		fmt.Fprintf(&w.body, "%s = %s\n", dst, src)
+	case shapeLeaf:
+		if w.encrypt {
+			w.check(fmt.Sprintf("%s, err = c.Encrypt(%s)", dst, src), path)
+		} else {
+			w.check(fmt.Sprintf("%s, err = transcrypt.DecryptFieldWith[%s](c, %s)", dst, s.plain, src), path)
+		}
+	case shapeMirror:
+		verb := "decrypt"
+		if w.encrypt {
+			verb = "encrypt"
+		}
+		w.check(fmt.Sprintf("%s, err = %s(c, %s)", dst, fieldsFunc(verb, s.decl.name), src), path)
+	case shapePointer:
+		tmp := fmt.Sprintf("x%d", depth)
+		fmt.Fprintf(&w.body, "if %s != nil {\nvar %s %s\n", src, tmp, w.typeOf(s.elem))
+		w.emit(s.elem, "*"+src, tmp, path, depth+1)
+		fmt.Fprintf(&w.body, "%s = &%s\n}\n", dst, tmp)
+	case shapeSlice:
+		i := fmt.Sprintf("i%d", depth)
+		fmt.Fprintf(&w.body, "if %s != nil {\n%s = make(%s, len(%s))\nfor %s := range %s {\n", src, dst, w.typeOf(s), src, i, src)
+		w.emit(s.elem, index(src, i), index(dst, i), append(path, fmt.Sprintf("fmt.Sprintf(\"[%%d]\", %s)", i)), depth+1)
+		w.body.WriteString("}\n}\n")
+	case shapeArray:
+		i := fmt.Sprintf("i%d", depth)
+		fmt.Fprintf(&w.body, "for %s := range %s {\n", i, src)
+		w.emit(s.elem, index(src, i), index(dst, i), append(path, fmt.Sprintf("fmt.Sprintf(\"[%%d]\", %s)", i)), depth+1)
+		w.body.WriteString("}\n")
+	case shapeMap:
+		k, x, tmp := fmt.Sprintf("k%d", depth), fmt.Sprintf("x%d", depth), fmt.Sprintf("y%d", depth)
+		fmt.Fprintf(&w.body, "if %s != nil {\n%s = make(%s, len(%s))\nfor %s, %s := range %s {\n", src, dst, w.typeOf(s), src, k, x, src)
+		// Map elements are not addressable, so composite elements are built
+		// in a temporary first.
+		elemPath := append(path, fmt.Sprintf("fmt.Sprintf(\"[%%v]\", %s)", k))
+		switch s.elem.kind {
+		case shapeLeaf, shapeMirror:
+			w.emit(s.elem, x, index(dst, k), elemPath, depth+1)
+		default:
+			fmt.Fprintf(&w.body, "var %s %s\n", tmp, w.typeOf(s.elem))
+			w.emit(s.elem, x, tmp, elemPath, depth+1)
+			fmt.Fprintf(&w.body, "%s[%s] = %s\n", dst, k, tmp)
+		}
+		w.body.WriteString("}\n}\n")
+	}
+}
+
+// check writes an assignment that can fail, returning its error located at
+// path.
+func (w *walker) check(assign string, path []string) {
+	w.usesErr = true
+	fmt.Fprintf(&w.body, "if %s; err != nil {\nreturn %s, transcrypt.PrefixPath(err, %s)\n}\n", assign, w.zero, strings.Join(path, ", "))
+}
+
+// typeOf is the type of the values the walker produces for s.
+func (w *walker) typeOf(s *shape) string {
+	if w.encrypt {
+		return s.mirror
+	}
+	return s.plain
+}
+
+// index indexes a slice, array or map expression, parenthesizing a
+// dereference.
+func index(expr, i string) string {
+	if strings.HasPrefix(expr, "*") {
+		expr = "(" + expr + ")"
+	}
+	return expr + "[" + i + "]"
+}
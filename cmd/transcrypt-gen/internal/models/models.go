@@ -0,0 +1,54 @@
+// Package models holds annotated structs exercising every shape
+// transcrypt-gen supports. The generated models_transcrypt.go is checked in;
+// the tests compare it against fresh generator output and against the
+// reflection-based transcrypt.Encrypt.
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+//go:generate go run github.com/jantytgat/go-transcrypt/cmd/transcrypt-gen
+
+// Level is a named leaf type.
+type Level int
+
+//transcrypt:generate
+type Account struct {
+	//transcrypt:encrypt
+	Name     string            `json:"name"`
+	Password string            `json:"password"` //transcrypt:encrypt
+	PIN      Level             //transcrypt:encrypt
+	Token    []byte            //transcrypt:encrypt
+	TTL      time.Duration     //transcrypt:encrypt
+	Enabled  bool              `json:"enabled"`
+	Owner    Person            // mirrored without a marker: Person is annotated
+	Backup   *Person           // nil is preserved
+	Members  []Person          // slice of mirrored structs
+	Labels   map[string]string //transcrypt:encrypt
+	Scores   [2]float64        //transcrypt:encrypt
+	Aliases  *[]string         //transcrypt:encrypt
+	Created  time.Time         // copied as-is
+	internal string
+}
+
+//transcrypt:generate
+type Person struct {
+	FullName string //transcrypt:encrypt
+	Age      int
+	Email    string         `transcrypt:"mail"` //transcrypt:encrypt
+	Scratch  string         `transcrypt:"-"`    // left out of the mirror
+	Phone    sql.NullString //transcrypt:encrypt
+}
+
+// Node is recursive through a pointer, a slice and a map, and has a custom
+// mirror name.
+//
+//transcrypt:generate SealedNode
+type Node struct {
+	Note     string //transcrypt:encrypt
+	Next     *Node
+	Children []Node
+	Index    map[string][]*Node
+}
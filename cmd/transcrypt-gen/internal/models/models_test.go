@@ -0,0 +1,161 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jantytgat/go-transcrypt"
+	"github.com/jantytgat/go-transcrypt/transcrypttest"
+)
+
+var testKey = transcrypttest.Key("models", 32)
+
+// testAccount uses single-entry maps: map iteration order is random, so with
+// several entries the two walkers would draw salts in different orders.
+func testAccount() Account {
+	aliases := []string{"a", "b"}
+	return Account{
+		Name:     "prod-database",
+		Password: "s3cr3t",
+		PIN:      1234,
+		Token:    []byte{0xde, 0xad},
+		TTL:      time.Hour,
+		Enabled:  true,
+		Owner:    Person{FullName: "Owner", Age: 40, Email: "owner@example.com", Phone: sql.NullString{String: "555", Valid: true}},
+		Members:  []Person{{FullName: "First", Age: 1}, {FullName: "Second", Age: 2}},
+		Labels:   map[string]string{"env": "prod"},
+		Scores:   [2]float64{0.5, 1.5},
+		Aliases:  &aliases,
+		Created:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		internal: "dropped",
+	}
+}
+
+func testNode() Node {
+	return Node{
+		Note:     "root",
+		Next:     &Node{Note: "next"},
+		Children: []Node{{Note: "child"}},
+		Index:    map[string][]*Node{"k": {{Note: "indexed"}, nil}},
+	}
+}
+
+// deterministic returns options that make two encryptions comparable.
+func deterministic(seed string) []transcrypt.Option {
+	return []transcrypt.Option{
+		transcrypt.WithRandom(transcrypttest.NewReader(seed)),
+		transcrypt.WithIssuedAt(),
+		transcrypt.WithClock(func() time.Time { return time.Unix(1_700_000_000, 0) }),
+	}
+}
+
+func TestGenerated_MatchesReflection(t *testing.T) {
+	for _, suite := range []transcrypt.CipherSuite{transcrypt.AES_256_GCM, transcrypt.CHACHA20_POLY1305} {
+		t.Run(suite.String(), func(t *testing.T) {
+			generated, err := EncryptAccount(testKey, suite, testAccount(), deterministic("account")...)
+			if err != nil {
+				t.Fatalf("EncryptAccount() error = %v", err)
+			}
+			reflected, err := transcrypt.Encrypt[SecureAccount](testKey, suite, testAccount(), deterministic("account")...)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if !reflect.DeepEqual(generated, reflected) {
+				t.Errorf("EncryptAccount() = %+v\nEncrypt() = %+v", generated, reflected)
+			}
+
+			node, err := EncryptNode(testKey, suite, testNode(), deterministic("node")...)
+			if err != nil {
+				t.Fatalf("EncryptNode() error = %v", err)
+			}
+			reflectedNode, err := transcrypt.Encrypt[SealedNode](testKey, suite, testNode(), deterministic("node")...)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if !reflect.DeepEqual(node, reflectedNode) {
+				t.Errorf("EncryptNode() = %+v\nEncrypt() = %+v", node, reflectedNode)
+			}
+		})
+	}
+}
+
+func TestGenerated_RoundTrip(t *testing.T) {
+	want := testAccount()
+	want.internal = ""
+
+	secure, err := EncryptAccount(testKey, transcrypt.AES_256_GCM, testAccount())
+	if err != nil {
+		t.Fatalf("EncryptAccount() error = %v", err)
+	}
+	if secure.Backup != nil {
+		t.Error("EncryptAccount() did not preserve a nil pointer")
+	}
+	got, err := DecryptAccount(testKey, secure)
+	if err != nil {
+		t.Fatalf("DecryptAccount() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecryptAccount() = %+v, want %+v", got, want)
+	}
+
+	// Generated and reflection code read each other's output.
+	reflected, err := transcrypt.Decrypt[Account](testKey, secure)
+	if err != nil || !reflect.DeepEqual(reflected, want) {
+		t.Errorf("Decrypt() of generated output = %+v, %v", reflected, err)
+	}
+
+	node, err := EncryptNode(testKey, transcrypt.AES_256_GCM, testNode())
+	if err != nil {
+		t.Fatalf("EncryptNode() error = %v", err)
+	}
+	gotNode, err := DecryptNode(testKey, node)
+	if err != nil || !reflect.DeepEqual(gotNode, testNode()) {
+		t.Errorf("DecryptNode() = %+v, %v; want %+v", gotNode, err, testNode())
+	}
+}
+
+func TestGenerated_ErrorsMatchReflection(t *testing.T) {
+	secure, err := EncryptAccount(testKey, transcrypt.AES_256_GCM, testAccount())
+	if err != nil {
+		t.Fatalf("EncryptAccount() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*SecureAccount)
+		path   string
+		want   error
+	}{
+		{"nested", func(s *SecureAccount) { s.Members[1].FullName = "garbage" }, "Members[1].FullName", transcrypt.ErrMalformed},
+		{"tagged", func(s *SecureAccount) { s.Owner.Email = "garbage" }, "Owner.mail", transcrypt.ErrMalformed},
+		{"map", func(s *SecureAccount) { s.Labels["env"] = s.Labels["env"][:len(s.Labels["env"])-2] + "00" }, "Labels[env]", transcrypt.ErrAuthentication},
+		{"kind", func(s *SecureAccount) { s.PIN = s.Name }, "PIN", transcrypt.ErrKindMismatch},
+		{"pointer", func(s *SecureAccount) { (*s.Aliases)[0] = "" }, "Aliases[0]", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := secure
+			tampered.Members = append([]SecurePerson(nil), secure.Members...)
+			tampered.Labels = map[string]transcrypt.Ciphertext{"env": secure.Labels["env"]}
+			aliases := append([]transcrypt.Ciphertext(nil), *secure.Aliases...)
+			tampered.Aliases = &aliases
+			tt.tamper(&tampered)
+
+			_, generated := DecryptAccount(testKey, tampered)
+			_, reflected := transcrypt.Decrypt[Account](testKey, tampered)
+			var fieldErr *transcrypt.FieldError
+			if !errors.As(generated, &fieldErr) || fieldErr.Path != tt.path {
+				t.Fatalf("DecryptAccount() error = %v, want a FieldError at %q", generated, tt.path)
+			}
+			if tt.want != nil && !errors.Is(generated, tt.want) {
+				t.Errorf("DecryptAccount() error = %v, want %v", generated, tt.want)
+			}
+			if reflected == nil || generated.Error() != reflected.Error() {
+				t.Errorf("DecryptAccount() error = %v\nDecrypt() error = %v", generated, reflected)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+// Code generated by transcrypt-gen. DO NOT EDIT.
+
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jantytgat/go-transcrypt"
+)
+
+// SecureAccount is the encrypted mirror of Account.
+type SecureAccount struct {
+	Name     transcrypt.Ciphertext `json:"name"`
+	Password transcrypt.Ciphertext `json:"password"`
+	PIN      transcrypt.Ciphertext
+	Token    transcrypt.Ciphertext
+	TTL      transcrypt.Ciphertext
+	Enabled  bool `json:"enabled"`
+	Owner    SecurePerson
+	Backup   *SecurePerson
+	Members  []SecurePerson
+	Labels   map[string]transcrypt.Ciphertext
+	Scores   [2]transcrypt.Ciphertext
+	Aliases  *[]transcrypt.Ciphertext
+	Created  time.Time
+}
+
+// EncryptAccount encrypts v into its mirror SecureAccount, as
+// transcrypt.Encrypt[SecureAccount] does.
+func EncryptAccount(key []byte, cipherSuite transcrypt.CipherSuite, v Account, opts ...transcrypt.Option) (SecureAccount, error) {
+	// The full slice expression makes append copy opts rather than write into
+	// the caller's backing array.
+	e, err := transcrypt.NewEncryptor(key, append(opts[:len(opts):len(opts)], transcrypt.WithCipherSuite(cipherSuite))...)
+	if err != nil {
+		return SecureAccount{}, err
+	}
+	return EncryptAccountWith(e, v)
+}
+
+// DecryptAccount decrypts v back into Account, as
+// transcrypt.Decrypt[Account] does.
+func DecryptAccount(key []byte, v SecureAccount, opts ...transcrypt.Option) (Account, error) {
+	e, err := transcrypt.NewEncryptor(key, opts...)
+	if err != nil {
+		return Account{}, err
+	}
+	return DecryptAccountWith(e, v)
+}
+
+// EncryptAccountWith encrypts v into its mirror SecureAccount using e's key
+// and options, as transcrypt.EncryptWith[SecureAccount] does.
+func EncryptAccountWith(e *transcrypt.Encryptor, v Account) (SecureAccount, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		return SecureAccount{}, err
+	}
+	return encryptAccountFields(c, v)
+}
+
+// DecryptAccountWith decrypts v back into Account using e's key and
+// options, as transcrypt.DecryptWith[Account] does.
+func DecryptAccountWith(e *transcrypt.Encryptor, v SecureAccount) (Account, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		return Account{}, err
+	}
+	return decryptAccountFields(c, v)
+}
+
+// encryptAccountFields encrypts v into SecureAccount with the options and key
+// resolved in c.
+func encryptAccountFields(c *transcrypt.FieldCodec, v Account) (SecureAccount, error) {
+	var out SecureAccount
+	var err error
+	if out.Name, err = c.Encrypt(v.Name); err != nil {
+		return SecureAccount{}, transcrypt.PrefixPath(err, "Name")
+	}
+	if out.Password, err = c.Encrypt(v.Password); err != nil {
+		return SecureAccount{}, transcrypt.PrefixPath(err, "Password")
+	}
+	if out.PIN, err = c.Encrypt(v.PIN); err != nil {
+		return SecureAccount{}, transcrypt.PrefixPath(err, "PIN")
+	}
+	if out.Token, err = c.Encrypt(v.Token); err != nil {
+		return SecureAccount{}, transcrypt.PrefixPath(err, "Token")
+	}
+	if out.TTL, err = c.Encrypt(v.TTL); err != nil {
+		return SecureAccount{}, transcrypt.PrefixPath(err, "TTL")
+	}
+	out.Enabled = v.Enabled
+	if out.Owner, err = encryptPersonFields(c, v.Owner); err != nil {
+		return SecureAccount{}, transcrypt.PrefixPath(err, "Owner")
+	}
+	if v.Backup != nil {
+		var x0 SecurePerson
+		if x0, err = encryptPersonFields(c, *v.Backup); err != nil {
+			return SecureAccount{}, transcrypt.PrefixPath(err, "Backup")
+		}
+		out.Backup = &x0
+	}
+	if v.Members != nil {
+		out.Members = make([]SecurePerson, len(v.Members))
+		for i0 := range v.Members {
+			if out.Members[i0], err = encryptPersonFields(c, v.Members[i0]); err != nil {
+				return SecureAccount{}, transcrypt.PrefixPath(err, "Members", fmt.Sprintf("[%d]", i0))
+			}
+		}
+	}
+	if v.Labels != nil {
+		out.Labels = make(map[string]transcrypt.Ciphertext, len(v.Labels))
+		for k0, x0 := range v.Labels {
+			if out.Labels[k0], err = c.Encrypt(x0); err != nil {
+				return SecureAccount{}, transcrypt.PrefixPath(err, "Labels", fmt.Sprintf("[%v]", k0))
+			}
+		}
+	}
+	for i0 := range v.Scores {
+		if out.Scores[i0], err = c.Encrypt(v.Scores[i0]); err != nil {
+			return SecureAccount{}, transcrypt.PrefixPath(err, "Scores", fmt.Sprintf("[%d]", i0))
+		}
+	}
+	if v.Aliases != nil {
+		var x0 []transcrypt.Ciphertext
+		if *v.Aliases != nil {
+			x0 = make([]transcrypt.Ciphertext, len(*v.Aliases))
+			for i1 := range *v.Aliases {
+				if x0[i1], err = c.Encrypt((*v.Aliases)[i1]); err != nil {
+					return SecureAccount{}, transcrypt.PrefixPath(err, "Aliases", fmt.Sprintf("[%d]", i1))
+				}
+			}
+		}
+		out.Aliases = &x0
+	}
+	out.Created = v.Created
+	return out, nil
+}
+
+// decryptAccountFields decrypts v into Account with the options and key
+// resolved in c.
+func decryptAccountFields(c *transcrypt.FieldCodec, v SecureAccount) (Account, error) {
+	var out Account
+	var err error
+	if out.Name, err = transcrypt.DecryptFieldWith[string](c, v.Name); err != nil {
+		return Account{}, transcrypt.PrefixPath(err, "Name")
+	}
+	if out.Password, err = transcrypt.DecryptFieldWith[string](c, v.Password); err != nil {
+		return Account{}, transcrypt.PrefixPath(err, "Password")
+	}
+	if out.PIN, err = transcrypt.DecryptFieldWith[Level](c, v.PIN); err != nil {
+		return Account{}, transcrypt.PrefixPath(err, "PIN")
+	}
+	if out.Token, err = transcrypt.DecryptFieldWith[[]byte](c, v.Token); err != nil {
+		return Account{}, transcrypt.PrefixPath(err, "Token")
+	}
+	if out.TTL, err = transcrypt.DecryptFieldWith[time.Duration](c, v.TTL); err != nil {
+		return Account{}, transcrypt.PrefixPath(err, "TTL")
+	}
+	out.Enabled = v.Enabled
+	if out.Owner, err = decryptPersonFields(c, v.Owner); err != nil {
+		return Account{}, transcrypt.PrefixPath(err, "Owner")
+	}
+	if v.Backup != nil {
+		var x0 Person
+		if x0, err = decryptPersonFields(c, *v.Backup); err != nil {
+			return Account{}, transcrypt.PrefixPath(err, "Backup")
+		}
+		out.Backup = &x0
+	}
+	if v.Members != nil {
+		out.Members = make([]Person, len(v.Members))
+		for i0 := range v.Members {
+			if out.Members[i0], err = decryptPersonFields(c, v.Members[i0]); err != nil {
+				return Account{}, transcrypt.PrefixPath(err, "Members", fmt.Sprintf("[%d]", i0))
+			}
+		}
+	}
+	if v.Labels != nil {
+		out.Labels = make(map[string]string, len(v.Labels))
+		for k0, x0 := range v.Labels {
+			if out.Labels[k0], err = transcrypt.DecryptFieldWith[string](c, x0); err != nil {
+				return Account{}, transcrypt.PrefixPath(err, "Labels", fmt.Sprintf("[%v]", k0))
+			}
+		}
+	}
+	for i0 := range v.Scores {
+		if out.Scores[i0], err = transcrypt.DecryptFieldWith[float64](c, v.Scores[i0]); err != nil {
+			return Account{}, transcrypt.PrefixPath(err, "Scores", fmt.Sprintf("[%d]", i0))
+		}
+	}
+	if v.Aliases != nil {
+		var x0 []string
+		if *v.Aliases != nil {
+			x0 = make([]string, len(*v.Aliases))
+			for i1 := range *v.Aliases {
+				if x0[i1], err = transcrypt.DecryptFieldWith[string](c, (*v.Aliases)[i1]); err != nil {
+					return Account{}, transcrypt.PrefixPath(err, "Aliases", fmt.Sprintf("[%d]", i1))
+				}
+			}
+		}
+		out.Aliases = &x0
+	}
+	out.Created = v.Created
+	return out, nil
+}
+
+// SecurePerson is the encrypted mirror of Person.
+type SecurePerson struct {
+	FullName transcrypt.Ciphertext
+	Age      int
+	Email    transcrypt.Ciphertext `transcrypt:"mail"`
+	Phone    transcrypt.Ciphertext
+}
+
+// EncryptPerson encrypts v into its mirror SecurePerson, as
+// transcrypt.Encrypt[SecurePerson] does.
+func EncryptPerson(key []byte, cipherSuite transcrypt.CipherSuite, v Person, opts ...transcrypt.Option) (SecurePerson, error) {
+	// The full slice expression makes append copy opts rather than write into
+	// the caller's backing array.
+	e, err := transcrypt.NewEncryptor(key, append(opts[:len(opts):len(opts)], transcrypt.WithCipherSuite(cipherSuite))...)
+	if err != nil {
+		return SecurePerson{}, err
+	}
+	return EncryptPersonWith(e, v)
+}
+
+// DecryptPerson decrypts v back into Person, as
+// transcrypt.Decrypt[Person] does.
+func DecryptPerson(key []byte, v SecurePerson, opts ...transcrypt.Option) (Person, error) {
+	e, err := transcrypt.NewEncryptor(key, opts...)
+	if err != nil {
+		return Person{}, err
+	}
+	return DecryptPersonWith(e, v)
+}
+
+// EncryptPersonWith encrypts v into its mirror SecurePerson using e's key
+// and options, as transcrypt.EncryptWith[SecurePerson] does.
+func EncryptPersonWith(e *transcrypt.Encryptor, v Person) (SecurePerson, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		return SecurePerson{}, err
+	}
+	return encryptPersonFields(c, v)
+}
+
+// DecryptPersonWith decrypts v back into Person using e's key and
+// options, as transcrypt.DecryptWith[Person] does.
+func DecryptPersonWith(e *transcrypt.Encryptor, v SecurePerson) (Person, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		return Person{}, err
+	}
+	return decryptPersonFields(c, v)
+}
+
+// encryptPersonFields encrypts v into SecurePerson with the options and key
+// resolved in c.
+func encryptPersonFields(c *transcrypt.FieldCodec, v Person) (SecurePerson, error) {
+	var out SecurePerson
+	var err error
+	if out.FullName, err = c.Encrypt(v.FullName); err != nil {
+		return SecurePerson{}, transcrypt.PrefixPath(err, "FullName")
+	}
+	out.Age = v.Age
+	if out.Email, err = c.Encrypt(v.Email); err != nil {
+		return SecurePerson{}, transcrypt.PrefixPath(err, "mail")
+	}
+	if out.Phone, err = c.Encrypt(v.Phone); err != nil {
+		return SecurePerson{}, transcrypt.PrefixPath(err, "Phone")
+	}
+	return out, nil
+}
+
+// decryptPersonFields decrypts v into Person with the options and key
+// resolved in c.
+func decryptPersonFields(c *transcrypt.FieldCodec, v SecurePerson) (Person, error) {
+	var out Person
+	var err error
+	if out.FullName, err = transcrypt.DecryptFieldWith[string](c, v.FullName); err != nil {
+		return Person{}, transcrypt.PrefixPath(err, "FullName")
+	}
+	out.Age = v.Age
+	if out.Email, err = transcrypt.DecryptFieldWith[string](c, v.Email); err != nil {
+		return Person{}, transcrypt.PrefixPath(err, "mail")
+	}
+	if out.Phone, err = transcrypt.DecryptFieldWith[sql.NullString](c, v.Phone); err != nil {
+		return Person{}, transcrypt.PrefixPath(err, "Phone")
+	}
+	return out, nil
+}
+
+// SealedNode is the encrypted mirror of Node.
+type SealedNode struct {
+	Note     transcrypt.Ciphertext
+	Next     *SealedNode
+	Children []SealedNode
+	Index    map[string][]*SealedNode
+}
+
+// EncryptNode encrypts v into its mirror SealedNode, as
+// transcrypt.Encrypt[SealedNode] does.
+func EncryptNode(key []byte, cipherSuite transcrypt.CipherSuite, v Node, opts ...transcrypt.Option) (SealedNode, error) {
+	// The full slice expression makes append copy opts rather than write into
+	// the caller's backing array.
+	e, err := transcrypt.NewEncryptor(key, append(opts[:len(opts):len(opts)], transcrypt.WithCipherSuite(cipherSuite))...)
+	if err != nil {
+		return SealedNode{}, err
+	}
+	return EncryptNodeWith(e, v)
+}
+
+// DecryptNode decrypts v back into Node, as
+// transcrypt.Decrypt[Node] does.
+func DecryptNode(key []byte, v SealedNode, opts ...transcrypt.Option) (Node, error) {
+	e, err := transcrypt.NewEncryptor(key, opts...)
+	if err != nil {
+		return Node{}, err
+	}
+	return DecryptNodeWith(e, v)
+}
+
+// EncryptNodeWith encrypts v into its mirror SealedNode using e's key
+// and options, as transcrypt.EncryptWith[SealedNode] does.
+func EncryptNodeWith(e *transcrypt.Encryptor, v Node) (SealedNode, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		return SealedNode{}, err
+	}
+	return encryptNodeFields(c, v)
+}
+
+// DecryptNodeWith decrypts v back into Node using e's key and
+// options, as transcrypt.DecryptWith[Node] does.
+func DecryptNodeWith(e *transcrypt.Encryptor, v SealedNode) (Node, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		return Node{}, err
+	}
+	return decryptNodeFields(c, v)
+}
+
+// encryptNodeFields encrypts v into SealedNode with the options and key
+// resolved in c.
+func encryptNodeFields(c *transcrypt.FieldCodec, v Node) (SealedNode, error) {
+	var out SealedNode
+	var err error
+	if out.Note, err = c.Encrypt(v.Note); err != nil {
+		return SealedNode{}, transcrypt.PrefixPath(err, "Note")
+	}
+	if v.Next != nil {
+		var x0 SealedNode
+		if x0, err = encryptNodeFields(c, *v.Next); err != nil {
+			return SealedNode{}, transcrypt.PrefixPath(err, "Next")
+		}
+		out.Next = &x0
+	}
+	if v.Children != nil {
+		out.Children = make([]SealedNode, len(v.Children))
+		for i0 := range v.Children {
+			if out.Children[i0], err = encryptNodeFields(c, v.Children[i0]); err != nil {
+				return SealedNode{}, transcrypt.PrefixPath(err, "Children", fmt.Sprintf("[%d]", i0))
+			}
+		}
+	}
+	if v.Index != nil {
+		out.Index = make(map[string][]*SealedNode, len(v.Index))
+		for k0, x0 := range v.Index {
+			var y0 []*SealedNode
+			if x0 != nil {
+				y0 = make([]*SealedNode, len(x0))
+				for i1 := range x0 {
+					if x0[i1] != nil {
+						var x2 SealedNode
+						if x2, err = encryptNodeFields(c, *x0[i1]); err != nil {
+							return SealedNode{}, transcrypt.PrefixPath(err, "Index", fmt.Sprintf("[%v]", k0), fmt.Sprintf("[%d]", i1))
+						}
+						y0[i1] = &x2
+					}
+				}
+			}
+			out.Index[k0] = y0
+		}
+	}
+	return out, nil
+}
+
+// decryptNodeFields decrypts v into Node with the options and key
+// resolved in c.
+func decryptNodeFields(c *transcrypt.FieldCodec, v SealedNode) (Node, error) {
+	var out Node
+	var err error
+	if out.Note, err = transcrypt.DecryptFieldWith[string](c, v.Note); err != nil {
+		return Node{}, transcrypt.PrefixPath(err, "Note")
+	}
+	if v.Next != nil {
+		var x0 Node
+		if x0, err = decryptNodeFields(c, *v.Next); err != nil {
+			return Node{}, transcrypt.PrefixPath(err, "Next")
+		}
+		out.Next = &x0
+	}
+	if v.Children != nil {
+		out.Children = make([]Node, len(v.Children))
+		for i0 := range v.Children {
+			if out.Children[i0], err = decryptNodeFields(c, v.Children[i0]); err != nil {
+				return Node{}, transcrypt.PrefixPath(err, "Children", fmt.Sprintf("[%d]", i0))
+			}
+		}
+	}
+	if v.Index != nil {
+		out.Index = make(map[string][]*Node, len(v.Index))
+		for k0, x0 := range v.Index {
+			var y0 []*Node
+			if x0 != nil {
+				y0 = make([]*Node, len(x0))
+				for i1 := range x0 {
+					if x0[i1] != nil {
+						var x2 Node
+						if x2, err = decryptNodeFields(c, *x0[i1]); err != nil {
+							return Node{}, transcrypt.PrefixPath(err, "Index", fmt.Sprintf("[%v]", k0), fmt.Sprintf("[%d]", i1))
+						}
+						y0[i1] = &x2
+					}
+				}
+			}
+			out.Index[k0] = y0
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+// Command transcrypt-gen generates encrypted mirror structs and typed
+// encrypt/decrypt functions for annotated plain structs, so the mirror cannot
+// drift from the plain type and no reflection runs per call.
+//
+// Annotate a struct type with a //transcrypt:generate directive and every
+// field to encrypt with //transcrypt:encrypt, either above the field or at
+// the end of its line, and run the tool from go generate:
+//
+//	//go:generate go run github.com/jantytgat/go-transcrypt/cmd/transcrypt-gen
+//
+//	//transcrypt:generate
+//	type Account struct {
+//		Password string //transcrypt:encrypt
+//		Enabled  bool
+//	}
+//
+// For every annotated type X in the file, the tool writes to
+// <file>_transcrypt.go next to it:
+//
+//   - the mirror struct SecureX, with transcrypt.Ciphertext for encrypted
+//     fields, the mirror of every field whose type is itself annotated, and
+//     the identical type for everything else;
+//   - EncryptX and DecryptX, with the signatures of transcrypt.Encrypt and
+//     transcrypt.Decrypt, and EncryptXWith and DecryptXWith taking a
+//     *transcrypt.Encryptor, whose options and key they resolve once per
+//     call through a transcrypt.FieldCodec.
+//
+// The functions produce the same ciphertexts and errors as
+// transcrypt.Encrypt[SecureX] and transcrypt.Decrypt[X]. The directive takes
+// an optional mirror name, e.g. //transcrypt:generate EncryptedAccount.
+//
+// The encrypt marker applies to the leaves of a field's type: on a []string
+// or map[string]string field it encrypts every element. Encrypted leaves must
+// have a kind transcrypt encrypts as a single value (booleans, numbers,
+// strings and []byte); a local named type is checked against its underlying
+// type, so marking a field of a local struct or slice type is an error.
+// Interface fields are rejected, as the library maps them by their dynamic
+// value at run time; the tool recognizes any, error, local interface types
+// and interface literals, so avoid imported interface types too. Unexported
+// fields and fields tagged `transcrypt:"-"` are left out of the mirror, as
+// the reflection walker ignores them. Field tags are copied to the mirror,
+// and errors name a field after its transcrypt tag, as the library does; tag
+// options selecting a per-field key or cipher suite (see
+// transcrypt.WithKeyring) are not supported. Unlike the reflection walker,
+// the generated code does not detect cyclic values; recursive types are fine.
+// It encrypts sequentially and ignores transcrypt.WithConcurrency, and since
+// the mirror always matches, transcrypt.WithMatching.
+//
+// Usage:
+//
+//	transcrypt-gen [-o output] [file.go]
+//
+// Without a file argument the tool processes $GOFILE, as set by go generate.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	output := flag.String("o", "", "output `file` (default <file>_transcrypt.go)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: transcrypt-gen [-o output] [file.go]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(flag.Args(), *output); err != nil {
+		fmt.Fprintln(os.Stderr, "transcrypt-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, output string) error {
+	var filename string
+	switch len(args) {
+	case 0:
+		filename = os.Getenv("GOFILE")
+		if filename == "" {
+			return fmt.Errorf("no input file and $GOFILE is not set")
+		}
+	case 1:
+		filename = args[0]
+	default:
+		return fmt.Errorf("expected one input file, got %d", len(args))
+	}
+	if output == "" {
+		output = strings.TrimSuffix(filename, ".go") + generatedSuffix
+	}
+
+	src, err := generate(filename)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		return fmt.Errorf("%s: no //transcrypt:generate types", filepath.Base(filename))
+	}
+	return os.WriteFile(output, src, 0o644)
+}
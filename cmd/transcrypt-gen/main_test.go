@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the checked-in generated code")
+
+// TestGenerate_Models guards the checked-in generated code, which the models
+// package tests against the reflection walker, against drifting from what
+// the generator emits.
+func TestGenerate_Models(t *testing.T) {
+	input := filepath.Join("internal", "models", "models.go")
+	golden := filepath.Join("internal", "models", "models"+generatedSuffix)
+	got, err := generate(input)
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	if *update {
+		if err = os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generate() output differs from %s; run go generate ./... or go test -update", golden)
+	}
+}
+
+func writePackage(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGenerate_AcrossFiles(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": `package p
+
+import t "time"
+
+//transcrypt:generate
+type outer struct {
+	Inner  inner
+	When   t.Duration //transcrypt:encrypt
+	Level  rank       //transcrypt:encrypt
+	Maybe  maybeRank  //transcrypt:encrypt
+	hidden int
+}
+`,
+		"b.go": `package p
+
+import "database/sql/driver"
+
+type level int
+
+// rank resolves to a basic type through another local type.
+type rank level
+
+type maybeRank struct{ Rank rank }
+
+func (m maybeRank) Value() (driver.Value, error) { return int64(m.Rank), nil }
+func (m *maybeRank) Scan(src any) error        { return nil }
+
+//transcrypt:generate
+type inner struct {
+	Secret string //transcrypt:encrypt
+}
+`,
+		"a_test.go": "package p_test\n",
+	})
+	got, err := generate(filepath.Join(dir, "a.go"))
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	for _, want := range []string{
+		"type secureOuter struct",
+		"Inner secureInner",
+		`t "time"`,
+		"func encryptOuterWith(e *transcrypt.Encryptor, v outer) (secureOuter, error)",
+		"encryptInnerFields(c, v.Inner)",
+		"transcrypt.DecryptFieldWith[t.Duration](c, v.When)",
+		"Level transcrypt.Ciphertext",
+		"Maybe transcrypt.Ciphertext",
+	} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("generate() output lacks %q:\n%s", want, got)
+		}
+	}
+	// inner is declared in b.go, so it is generated from there.
+	if bytes.Contains(got, []byte("type secureInner struct")) || bytes.Contains(got, []byte("hidden")) {
+		t.Errorf("generate() output has unexpected declarations:\n%s", got)
+	}
+	// Without slices, arrays or maps the output needs no fmt.
+	if bytes.Contains(got, []byte(`"fmt"`)) {
+		t.Errorf("generate() output imports fmt needlessly:\n%s", got)
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"not_struct", "//transcrypt:generate\ntype X int\n", "not a struct type"},
+		{"generic", "//transcrypt:generate\ntype X[T any] struct{ A T }\n", "generic types"},
+		{"embedded", "type Y struct{}\n\n//transcrypt:generate\ntype X struct{ Y }\n", "embedded fields"},
+		{"interface", "//transcrypt:generate\ntype X struct {\n\tA any //transcrypt:encrypt\n}\n", "X.A: interface type any"},
+		{"tag_options", "//transcrypt:generate\ntype X struct {\n\tA string `transcrypt:\",key=pci\"` //transcrypt:encrypt\n}\n", "X: transcrypt tag options (key=pci) are not supported"},
+		{"unmarked_interface", "//transcrypt:generate\ntype X struct {\n\tA []error\n}\n", "X.A: interface type error"},
+		{"interface_literal", "//transcrypt:generate\ntype X struct {\n\tA interface{ M() }\n}\n", "X.A: interface type interface{ M() }"},
+		{"func", "//transcrypt:generate\ntype X struct {\n\tA func() //transcrypt:encrypt\n}\n", "X.A: type func() cannot be encrypted"},
+		{"local_struct", "type Address struct{ City string }\n\n//transcrypt:generate\ntype X struct {\n\tHome Address //transcrypt:encrypt\n}\n", "X.Home: type Address is a struct"},
+		{"local_slice", "type Tags []string\n\n//transcrypt:generate\ntype X struct {\n\tA Tags //transcrypt:encrypt\n}\n", "X.A: type Tags cannot be encrypted"},
+		{"local_named_slice", "type Tags []string\ntype Labels Tags\n\n//transcrypt:generate\ntype X struct {\n\tA []Labels //transcrypt:encrypt\n}\n", "X.A: type Tags cannot be encrypted"},
+		{"local_nullable", "import \"database/sql/driver\"\n\ntype pair struct {\n\tA, B  string\n\tValid bool\n}\n\nfunc (v pair) Value() (driver.Value, error) { return v.A, nil }\nfunc (v *pair) Scan(any) error { return nil }\n\n//transcrypt:generate\ntype X struct {\n\tA pair //transcrypt:encrypt\n}\n", "X.A: nullable type pair cannot be encrypted"},
+		{"local_interface", "type Stringer interface{ String() string }\n\n//transcrypt:generate\ntype X struct {\n\tA Stringer\n}\n", "X.A: interface type Stringer"},
+		{"arguments", "//transcrypt:generate A B\ntype X struct{}\n", "at most one argument"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePackage(t, map[string]string{"x.go": "package p\n\n" + tt.source})
+			_, err := generate(filepath.Join(dir, "x.go"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("generate() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"x.go":     "package p\n\n//transcrypt:generate\ntype X struct {\n\tA string //transcrypt:encrypt\n}\n",
+		"plain.go": "package p\n\ntype Y struct{}\n",
+	})
+
+	t.Setenv("GOFILE", filepath.Join(dir, "x.go"))
+	if err := run(nil, ""); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x"+generatedSuffix)); err != nil {
+		t.Errorf("run() did not write the default output: %v", err)
+	}
+
+	output := filepath.Join(dir, "custom.go")
+	if err := run([]string{filepath.Join(dir, "x.go")}, output); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("run() did not write %s: %v", output, err)
+	}
+
+	if err := run([]string{filepath.Join(dir, "plain.go")}, ""); err == nil {
+		t.Error("run() on a file without annotated types expected error")
+	}
+	if err := run([]string{"a.go", "b.go"}, ""); err == nil {
+		t.Error("run() with two files expected error")
+	}
+	t.Setenv("GOFILE", "")
+	if err := run(nil, ""); err == nil {
+		t.Error("run() without input expected error")
+	}
+}
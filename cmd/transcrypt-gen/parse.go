@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	generateDirective = "//transcrypt:generate"
+	encryptDirective  = "//transcrypt:encrypt"
+	generatedSuffix   = "_transcrypt.go"
+)
+
+// typeDecl is an annotated plain struct type.
+type typeDecl struct {
+	name   string
+	mirror string
+	file   string
+	spec   *ast.TypeSpec
+	fields []field
+}
+
+// field is an exported field of an annotated struct, with its resolved shape.
+type field struct {
+	name string
+	// match is the name the field is matched and reported under: the name
+	// of its transcrypt tag, or its Go name.
+	match string
+	tag   string
+	shape *shape
+}
+
+type shapeKind int
+
+const (
+	// shapeCopy is copied verbatim: the mirror has the identical type.
+	shapeCopy shapeKind = iota
+	// shapeLeaf is encrypted into a transcrypt.Ciphertext.
+	shapeLeaf
+	// shapeMirror is an annotated struct, converted by its own functions.
+	shapeMirror
+	shapePointer
+	shapeSlice
+	shapeArray
+	shapeMap
+)
+
+// shape describes how a field type maps onto its mirror, like the plan the
+// library compiles at run time.
+type shape struct {
+	kind shapeKind
+	// plain and mirror are the Go type expressions on either side.
+	plain  string
+	mirror string
+	// decl is the annotated type of a shapeMirror.
+	decl *typeDecl
+	// elem is the element of a pointer, slice, array or map.
+	elem *shape
+}
+
+// pkg is the parsed package holding the input file.
+type pkg struct {
+	fset  *token.FileSet
+	name  string
+	types map[string]*typeDecl
+	// local holds every type declared in the package, annotated or not, so
+	// encrypted fields of local named types can be checked against their
+	// underlying types.
+	local map[string]*ast.TypeSpec
+	// methods holds the method names declared on each local type, whatever
+	// the receiver, to recognise nullable structs.
+	methods map[string]map[string]bool
+	// imports maps the files of the package to their import specs by the name
+	// they are referred to with.
+	imports map[string]map[string]*ast.ImportSpec
+}
+
+// generate returns the generated source for the annotated types declared in
+// filename, or nil if it declares none. Nested annotated types may be declared
+// in any file of the same package.
+func generate(filename string) ([]byte, error) {
+	p, err := parsePackage(filename)
+	if err != nil {
+		return nil, err
+	}
+	var decls []*typeDecl
+	for _, decl := range p.types {
+		if decl.file == filename {
+			decls = append(decls, decl)
+		}
+	}
+	if len(decls) == 0 {
+		return nil, nil
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].spec.Pos() < decls[j].spec.Pos() })
+
+	uses := make(map[string]bool)
+	for _, decl := range decls {
+		if err = p.resolveFields(decl, uses); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	emitFile(&buf, p.name, p.importsFor(filename, uses), decls)
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+// parsePackage parses the package of filename: the non-test, non-generated Go
+// files in its directory that share its package clause. It collects the
+// annotated types of all of them.
+func parsePackage(filename string) (*pkg, error) {
+	p := &pkg{
+		fset:    token.NewFileSet(),
+		types:   make(map[string]*typeDecl),
+		local:   make(map[string]*ast.TypeSpec),
+		methods: make(map[string]map[string]bool),
+		imports: make(map[string]map[string]*ast.ImportSpec),
+	}
+	target, err := parser.ParseFile(p.fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	p.name = target.Name.Name
+
+	dir := filepath.Dir(filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]*ast.File{filename: target}
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") ||
+			strings.HasSuffix(name, generatedSuffix) || sameFile(path, filename) {
+			continue
+		}
+		f, err := parser.ParseFile(p.fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if f.Name.Name == p.name {
+			files[path] = f
+		}
+	}
+
+	for path, f := range files {
+		p.imports[path] = fileImports(f)
+		if err = p.collectTypes(path, f); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func sameFile(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+func fileImports(f *ast.File) map[string]*ast.ImportSpec {
+	imports := make(map[string]*ast.ImportSpec)
+	for _, spec := range f.Imports {
+		path := strings.Trim(spec.Path.Value, `"`)
+		name := filepath.Base(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = spec
+	}
+	return imports
+}
+
+// collectTypes records the types and methods declared in f, and the
+// annotated struct types among them.
+func (p *pkg) collectTypes(path string, f *ast.File) error {
+	for _, d := range f.Decls {
+		if fn, ok := d.(*ast.FuncDecl); ok {
+			p.collectMethod(fn)
+			continue
+		}
+		gen, ok := d.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range gen.Specs {
+			spec := s.(*ast.TypeSpec)
+			p.local[spec.Name.Name] = spec
+			doc := spec.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			args, ok := directive(doc, generateDirective)
+			if !ok {
+				continue
+			}
+			if _, isStruct := spec.Type.(*ast.StructType); !isStruct {
+				return p.errorf(spec.Pos(), "%s is not a struct type", spec.Name.Name)
+			}
+			if spec.TypeParams != nil {
+				return p.errorf(spec.Pos(), "%s: generic types are not supported", spec.Name.Name)
+			}
+			decl := &typeDecl{name: spec.Name.Name, file: path, spec: spec, mirror: mirrorName(spec.Name.Name)}
+			switch len(args) {
+			case 0:
+			case 1:
+				decl.mirror = args[0]
+			default:
+				return p.errorf(spec.Pos(), "%s takes at most one argument, the mirror type name", generateDirective)
+			}
+			p.types[decl.name] = decl
+		}
+	}
+	return nil
+}
+
+// collectMethod records fn if it is a method of a local type.
+func (p *pkg) collectMethod(fn *ast.FuncDecl) {
+	if fn.Recv == nil || len(fn.Recv.List) != 1 {
+		return
+	}
+	recv := fn.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	ident, ok := recv.(*ast.Ident)
+	if !ok {
+		return
+	}
+	if p.methods[ident.Name] == nil {
+		p.methods[ident.Name] = make(map[string]bool)
+	}
+	p.methods[ident.Name][fn.Name.Name] = true
+}
+
+// directive reports whether the comment group holds the directive, and
+// returns its arguments.
+func directive(doc *ast.CommentGroup, name string) ([]string, bool) {
+	if doc == nil {
+		return nil, false
+	}
+	for _, c := range doc.List {
+		if c.Text == name || strings.HasPrefix(c.Text, name+" ") {
+			return strings.Fields(strings.TrimPrefix(c.Text, name)), true
+		}
+	}
+	return nil, false
+}
+
+// resolveFields resolves the shapes of decl's exported fields, recording the
+// imported package names their types use.
+func (p *pkg) resolveFields(decl *typeDecl, uses map[string]bool) error {
+	for _, f := range decl.spec.Type.(*ast.StructType).Fields.List {
+		if len(f.Names) == 0 {
+			return p.errorf(f.Pos(), "%s: embedded fields are not supported", decl.name)
+		}
+		_, docMarked := directive(f.Doc, encryptDirective)
+		_, lineMarked := directive(f.Comment, encryptDirective)
+		encrypt := docMarked || lineMarked
+
+		var tag, match string
+		if f.Tag != nil {
+			tag = f.Tag.Value
+			value, err := strconv.Unquote(tag)
+			if err != nil {
+				return p.errorf(f.Tag.Pos(), "%s: invalid field tag %s", decl.name, tag)
+			}
+			var opts string
+			match, opts, _ = strings.Cut(reflect.StructTag(value).Get("transcrypt"), ",")
+			// Per-field keys and cipher suites are resolved by the walker.
+			if opts != "" {
+				return p.errorf(f.Tag.Pos(), "%s: transcrypt tag options (%s) are not supported; use transcrypt.Encrypt for per-field keys", decl.name, opts)
+			}
+		}
+		if match != "" && match != "-" && len(f.Names) > 1 {
+			return p.errorf(f.Pos(), "%s: transcrypt tag names a single field, not %d", decl.name, len(f.Names))
+		}
+		for _, name := range f.Names {
+			// Fields tagged "-" are skipped by the library like unexported
+			// ones, so they are left out of the mirror too.
+			if !name.IsExported() || match == "-" {
+				continue
+			}
+			s, err := p.shapeOf(f.Type, encrypt, uses)
+			if err != nil {
+				return p.errorf(f.Pos(), "%s.%s: %v", decl.name, name.Name, err)
+			}
+			fieldMatch := name.Name
+			if match != "" {
+				fieldMatch = match
+			}
+			decl.fields = append(decl.fields, field{name: name.Name, match: fieldMatch, tag: tag, shape: s})
+		}
+	}
+	return nil
+}
+
+// shapeOf resolves the shape of type expression t. encrypt is whether the
+// field is marked for encryption, which applies to the leaves of t.
+func (p *pkg) shapeOf(t ast.Expr, encrypt bool, uses map[string]bool) (*shape, error) {
+	plain := p.render(t, uses)
+	leafOrCopy := func() *shape {
+		if encrypt {
+			return &shape{kind: shapeLeaf, plain: plain, mirror: "transcrypt.Ciphertext"}
+		}
+		return &shape{kind: shapeCopy, plain: plain, mirror: plain}
+	}
+
+	switch t := t.(type) {
+	case *ast.ParenExpr:
+		return p.shapeOf(t.X, encrypt, uses)
+	case *ast.Ident:
+		if decl, ok := p.types[t.Name]; ok {
+			return &shape{kind: shapeMirror, plain: plain, mirror: decl.mirror, decl: decl}, nil
+		}
+		if t.Name == "any" || t.Name == "error" {
+			return nil, errInterface(t.Name)
+		}
+		if err := p.checkLocal(t.Name, encrypt, nil); err != nil {
+			return nil, err
+		}
+		return leafOrCopy(), nil
+	case *ast.InterfaceType:
+		return nil, errInterface(plain)
+	case *ast.SelectorExpr:
+		return leafOrCopy(), nil
+	case *ast.StarExpr:
+		elem, err := p.shapeOf(t.X, encrypt, uses)
+		if err != nil {
+			return nil, err
+		}
+		return composite(shapePointer, plain, "*"+elem.mirror, elem), nil
+	case *ast.ArrayType:
+		if t.Len == nil && isByte(t.Elt) {
+			// []byte is a single value, not a slice of encrypted bytes.
+			return leafOrCopy(), nil
+		}
+		elem, err := p.shapeOf(t.Elt, encrypt, uses)
+		if err != nil {
+			return nil, err
+		}
+		if t.Len == nil {
+			return composite(shapeSlice, plain, "[]"+elem.mirror, elem), nil
+		}
+		return composite(shapeArray, plain, "["+p.render(t.Len, uses)+"]"+elem.mirror, elem), nil
+	case *ast.MapType:
+		elem, err := p.shapeOf(t.Value, encrypt, uses)
+		if err != nil {
+			return nil, err
+		}
+		return composite(shapeMap, plain, "map["+p.render(t.Key, uses)+"]"+elem.mirror, elem), nil
+	default:
+		if encrypt {
+			return nil, fmt.Errorf("type %s cannot be encrypted", plain)
+		}
+		return leafOrCopy(), nil
+	}
+}
+
+// checkLocal rejects a local named type that cannot be a field as a whole:
+// an interface type, or, when encrypt is set, a type whose underlying type is
+// not a leaf the library encrypts into a single Ciphertext. Its underlying
+// type is resolved through the named types it is declared with, and checked
+// like isLeafType: basic types, []byte and nullable structs holding one of
+// them beside a Valid bool are leaves.
+// Types declared elsewhere are assumed to be leaves, as before.
+func (p *pkg) checkLocal(name string, encrypt bool, seen map[string]bool) error {
+	spec, ok := p.local[name]
+	if !ok || seen[name] {
+		return nil
+	}
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+	seen[name] = true
+
+	switch t := spec.Type.(type) {
+	case *ast.ParenExpr, *ast.SelectorExpr:
+		return nil
+	case *ast.Ident:
+		if t.Name == "any" || t.Name == "error" {
+			return errInterface(name)
+		}
+		return p.checkLocal(t.Name, encrypt, seen)
+	case *ast.InterfaceType:
+		return errInterface(name)
+	case *ast.StructType:
+		if !encrypt {
+			return nil
+		}
+		if p.methods[name]["Value"] && p.methods[name]["Scan"] {
+			if value := nullableValue(t); value != nil && p.isLeafExpr(value, seen) {
+				return nil
+			}
+			return fmt.Errorf("nullable type %s cannot be encrypted into a single Ciphertext: it needs a Valid bool and one value field of a kind transcrypt encrypts", name)
+		}
+		return fmt.Errorf("type %s is a struct, which cannot be encrypted into a single Ciphertext; annotate it with %s instead", name, generateDirective)
+	case *ast.ArrayType:
+		if !encrypt || t.Len == nil && isByte(t.Elt) {
+			return nil
+		}
+	default:
+		if !encrypt {
+			return nil
+		}
+	}
+	return fmt.Errorf("type %s cannot be encrypted into a single Ciphertext; use its underlying type %s instead", name, p.render(spec.Type, map[string]bool{}))
+}
+
+// nullableValue returns the type of the value field of a nullable struct
+// shaped like the sql.Null* types, a Valid bool beside a single value field,
+// or nil if t has another shape.
+func nullableValue(t *ast.StructType) ast.Expr {
+	var value ast.Expr
+	for _, f := range t.Fields.List {
+		if len(f.Names) == 1 && f.Names[0].Name == "Valid" {
+			if ident, ok := f.Type.(*ast.Ident); ok && ident.Name == "bool" {
+				continue
+			}
+		}
+		if value != nil || len(f.Names) > 1 {
+			return nil
+		}
+		value = f.Type
+	}
+	return value
+}
+
+// isLeafExpr reports whether t, the value field of a nullable struct, is a
+// leaf as checkLocal defines it. Imported types are assumed to be leaves.
+func (p *pkg) isLeafExpr(t ast.Expr, seen map[string]bool) bool {
+	switch t := t.(type) {
+	case *ast.Ident:
+		if t.Name == "any" || t.Name == "error" {
+			return false
+		}
+		if spec, ok := p.local[t.Name]; ok {
+			if _, isStruct := spec.Type.(*ast.StructType); isStruct {
+				return false
+			}
+		}
+		return p.checkLocal(t.Name, true, seen) == nil
+	case *ast.ArrayType:
+		return t.Len == nil && isByte(t.Elt)
+	case *ast.SelectorExpr:
+		return true
+	default:
+		return false
+	}
+}
+
+// errInterface rejects an interface type: the library maps interface fields
+// by their dynamic value, which generated code cannot do ahead of time.
+func errInterface(name string) error {
+	return fmt.Errorf("interface type %s is not supported: the library maps interface fields by their dynamic value", name)
+}
+
+// composite returns the shape of a pointer, slice, array or map, which is
+// copied verbatim when its element is.
+func composite(kind shapeKind, plain, mirror string, elem *shape) *shape {
+	if elem.kind == shapeCopy {
+		return &shape{kind: shapeCopy, plain: plain, mirror: plain}
+	}
+	return &shape{kind: kind, plain: plain, mirror: mirror, elem: elem}
+}
+
+func isByte(t ast.Expr) bool {
+	ident, ok := t.(*ast.Ident)
+	return ok && (ident.Name == "byte" || ident.Name == "uint8")
+}
+
+// render formats a type expression as source, recording the imported package
+// names it refers to.
+func (p *pkg) render(t ast.Expr, uses map[string]bool) string {
+	ast.Inspect(t, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				uses[ident.Name] = true
+			}
+			return false
+		}
+		return true
+	})
+	var buf bytes.Buffer
+	if err := format.Node(&buf, p.fset, t); err != nil {
+		// t was parsed from valid source, so formatting cannot fail.
+		panic(err)
+	}
+	return buf.String()
+}
+
+// importsFor returns the import specs of filename for the package names in
+// uses, as they appear in the source.
+func (p *pkg) importsFor(filename string, uses map[string]bool) []string {
+	var specs []string
+	for name := range uses {
+		spec, ok := p.imports[filename][name]
+		if !ok {
+			continue
+		}
+		if spec.Name != nil {
+			specs = append(specs, spec.Name.Name+" "+spec.Path.Value)
+		} else {
+			specs = append(specs, spec.Path.Value)
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+func (p *pkg) errorf(pos token.Pos, format string, args ...any) error {
+	return fmt.Errorf("%s: %s", p.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+// mirrorName is the default mirror type name for a plain type: Secure is
+// prefixed, keeping the plain type's visibility.
+func mirrorName(name string) string {
+	if ast.IsExported(name) {
+		return "Secure" + name
+	}
+	return "secure" + upperFirst(name)
+}
+
+// funcName is the name of a generated function: the verb followed by the
+// plain type name, exported when the type is.
+func funcName(verb, name, suffix string) string {
+	if !ast.IsExported(name) {
+		verb = strings.ToLower(verb[:1]) + verb[1:]
+	}
+	return verb + upperFirst(name) + suffix
+}
+
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
@@ -0,0 +1,134 @@
+package transcrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// leafBatch queues the leaves of a concurrent struct walk (see
+// WithConcurrency). The walk itself stays sequential and only records, in
+// walk order, which value goes where; run then encrypts or decrypts the
+// leaves on a bounded worker pool. Every leaf writes to its own destination,
+// so the result is laid out exactly as by a sequential walk.
+type leafBatch struct {
+	leaves []leaf
+	// setters store map elements that hold queued leaves; they run after
+	// the leaves, see structWalk.setMapIndex.
+	setters []func()
+}
+
+// leaf is a leaf to encrypt or decrypt: src is encrypted or decrypted into
+// dst, under the key and cipher suite in effect for its field (see
+// WithKeyring).
+type leaf struct {
+	src         reflect.Value
+	dst         reflect.Value
+	path        string
+	key         []byte
+	cipherSuite CipherSuite
+}
+
+func (b *leafBatch) add(l leaf) {
+	b.leaves = append(b.leaves, l)
+}
+
+func (b *leafBatch) after(set func()) {
+	b.setters = append(b.setters, set)
+}
+
+// run calls do for every queued leaf on up to workers goroutines, then runs
+// the setters. If leaves fail, it returns the error of the first failing
+// leaf in walk order, which is the error a sequential walk reports; leaves
+// after a known failure are skipped.
+func (b *leafBatch) run(workers int, do func(i int, l leaf) error) error {
+	errs := make([]error, len(b.leaves))
+	var next atomic.Int64
+	var firstFailed atomic.Int64
+	firstFailed.Store(int64(len(b.leaves)))
+
+	var wg sync.WaitGroup
+	for range min(workers, len(b.leaves)) {
+		wg.Go(func() {
+			for {
+				i := next.Add(1) - 1
+				if i >= int64(len(b.leaves)) || i > firstFailed.Load() {
+					return
+				}
+				if errs[i] = do(int(i), b.leaves[i]); errs[i] != nil {
+					for failed := firstFailed.Load(); i < failed && !firstFailed.CompareAndSwap(failed, i); {
+						failed = firstFailed.Load()
+					}
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	for _, set := range b.setters {
+		set()
+	}
+	return nil
+}
+
+// finish runs the leaves queued by a concurrent walk that ended with walkErr.
+// A walk error (a cyclic value) is only returned if no leaf queued before it
+// fails, so a concurrent walk reports the same error as a sequential one.
+func (w *structWalk) finish(walkErr error, encrypt bool) error {
+	if w.batch == nil {
+		return walkErr
+	}
+	var err error
+	if encrypt {
+		err = w.runEncrypt()
+	} else {
+		err = w.batch.run(w.o.concurrency, func(_ int, l leaf) error {
+			return decryptLeaf(l, w.o)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return walkErr
+}
+
+// runEncrypt encrypts the queued leaves. The random bytes of all leaves are
+// read up front, in walk order, and each leaf gets its share as its own
+// random source: workers do not contend for a shared reader, and under a
+// deterministic source (see WithRandom) the output is byte for byte that of a
+// sequential walk.
+func (w *structWalk) runEncrypt() error {
+	n := w.o.valueRandomLength()
+	random := make([]byte, n*len(w.batch.leaves))
+	if _, err := io.ReadFull(w.o.rand(), random); err != nil {
+		return fmt.Errorf("failed to read random data: %w", err)
+	}
+	return w.batch.run(w.o.concurrency, func(i int, l leaf) error {
+		o := *w.o
+		o.random = bytes.NewReader(random[i*n : (i+1)*n])
+		return encryptLeaf(l, &o)
+	})
+}
+
+// valueRandomLength is the number of random bytes encrypting a single value
+// reads: the salt of the transcrypt encoding, or the IV of the others.
+func (o *options) valueRandomLength() int {
+	switch o.encoding {
+	case EncodingFernet:
+		return aes.BlockSize
+	case EncodingJWE:
+		// Both JWE content encryption algorithms use a 96-bit IV.
+		return 12
+	default:
+		return saltLength
+	}
+}
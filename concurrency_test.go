@@ -0,0 +1,233 @@
+package transcrypt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jantytgat/go-transcrypt/transcrypttest"
+)
+
+type record struct {
+	ID     int
+	Secret string
+	Tags   []string
+	Extra  *Inner
+	Scores [2]float64
+}
+
+type secureRecord struct {
+	ID     int
+	Secret Ciphertext
+	Tags   []Ciphertext
+	Extra  *SecureInner
+	Scores [2]Ciphertext
+}
+
+type ledger struct {
+	Owner   string
+	Records []record
+	ByName  map[string]record
+}
+
+type secureLedger struct {
+	Owner   Ciphertext
+	Records []secureRecord
+	ByName  map[string]secureRecord
+}
+
+// testLedger holds n records. byName holds the given number of entries: map
+// iteration order is random, so comparing ciphertexts byte for byte needs
+// at most one.
+func testLedger(n, byName int) ledger {
+	l := ledger{Owner: "owner", ByName: make(map[string]record)}
+	for i := range n {
+		r := record{ID: i, Secret: fmt.Sprintf("secret-%d", i), Scores: [2]float64{float64(i), 0.5}}
+		if i%3 == 0 {
+			r.Tags = []string{"a", "b"}
+			r.Extra = &Inner{Note: "extra", Public: i}
+		}
+		l.Records = append(l.Records, r)
+	}
+	for i := range byName {
+		l.ByName[fmt.Sprint("name", i)] = l.Records[i]
+	}
+	return l
+}
+
+// matchesSequential checks that a concurrent encryption of in is identical
+// to a sequential one under the same deterministic random source, and that
+// it round trips.
+func matchesSequential[P, E any](t *testing.T, key []byte, suite CipherSuite, in P, opts ...Option) {
+	t.Helper()
+	sequential, err := Encrypt[E](key, suite, in, append(opts, WithRandom(transcrypttest.NewReader("ledger")))...)
+	if err != nil {
+		t.Fatalf("sequential Encrypt() error = %v", err)
+	}
+	concurrent, err := Encrypt[E](key, suite, in, append(opts, WithRandom(transcrypttest.NewReader("ledger")), WithConcurrency(8))...)
+	if err != nil {
+		t.Fatalf("concurrent Encrypt() error = %v", err)
+	}
+	if !reflect.DeepEqual(sequential, concurrent) {
+		t.Error("concurrent Encrypt() differs from sequential")
+	}
+
+	got, err := Decrypt[P](key, concurrent, append(opts, WithConcurrency(8))...)
+	if err != nil {
+		t.Fatalf("concurrent Decrypt() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Error("concurrent round trip mismatch")
+	}
+}
+
+func TestConcurrency_MatchesSequential(t *testing.T) {
+	// Fernet tokens only carry strings and bytes.
+	type names struct {
+		Owner string
+		Names []string
+		Blob  []byte
+	}
+	type secureNames struct {
+		Owner Ciphertext
+		Names []Ciphertext
+		Blob  Ciphertext
+	}
+	fernetIn := names{Owner: "owner", Blob: []byte{1, 2, 3}}
+	for i := range 100 {
+		fernetIn.Names = append(fernetIn.Names, fmt.Sprint("name", i))
+	}
+
+	for _, suite := range []CipherSuite{AES_256_GCM, CHACHA20_POLY1305} {
+		t.Run(suite.String(), func(t *testing.T) {
+			in := testLedger(200, 1)
+			t.Run("transcrypt", func(t *testing.T) {
+				matchesSequential[ledger, secureLedger](t, testKey, suite, in)
+			})
+			t.Run("committed_padded", func(t *testing.T) {
+				matchesSequential[ledger, secureLedger](t, testKey, suite, in, WithKeyCommitment(), WithPadding(PadToBlock(64)))
+			})
+			t.Run("jwe", func(t *testing.T) {
+				matchesSequential[ledger, secureLedger](t, jweTestKey, suite, in, WithEncoding(EncodingJWE))
+			})
+			t.Run("fernet", func(t *testing.T) {
+				matchesSequential[names, secureNames](t, jweTestKey, suite, fernetIn, WithEncoding(EncodingFernet), fixedClock(expiryEpoch))
+			})
+		})
+	}
+}
+
+func TestConcurrency_RoundTrip(t *testing.T) {
+	in := testLedger(300, 50)
+	for _, workers := range []int{0, 1, 2, 16, 5000} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			e, err := NewEncryptor(testKey, WithConcurrency(workers))
+			if err != nil {
+				t.Fatalf("NewEncryptor() error = %v", err)
+			}
+			enc, err := EncryptWith[secureLedger](e, in)
+			if err != nil {
+				t.Fatalf("EncryptWith() error = %v", err)
+			}
+			if enc.ByName["name3"].Extra == nil || enc.Records[1].Extra != nil || enc.Records[1].Tags != nil {
+				t.Error("EncryptWith() did not preserve nil and non-nil composites")
+			}
+			got, err := DecryptWith[ledger](e, enc)
+			if err != nil {
+				t.Fatalf("DecryptWith() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, in) {
+				t.Error("round trip mismatch")
+			}
+		})
+	}
+}
+
+func TestConcurrency_ErrorsMatchSequential(t *testing.T) {
+	enc, err := Encrypt[secureLedger](testKey, AES_256_GCM, testLedger(600, 0))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	// Two failing fields: the earlier one in field order is reported, however
+	// the workers happen to be scheduled.
+	enc.Records[550].Secret = "garbage"
+	enc.Records[501].Tags[1] = enc.Records[501].Tags[1][:len(enc.Records[501].Tags[1])-2] + "00"
+
+	_, sequential := Decrypt[ledger](testKey, enc)
+	for range 5 {
+		_, concurrent := Decrypt[ledger](testKey, enc, WithConcurrency(8))
+		var fieldErr *FieldError
+		if !errors.As(concurrent, &fieldErr) || fieldErr.Path != "Records[501].Tags[1]" || !errors.Is(concurrent, ErrAuthentication) {
+			t.Fatalf("concurrent Decrypt() error = %v, want an authentication failure at Records[501].Tags[1]", concurrent)
+		}
+		if concurrent.Error() != sequential.Error() {
+			t.Fatalf("concurrent Decrypt() error = %v, sequential = %v", concurrent, sequential)
+		}
+	}
+}
+
+func TestConcurrency_CyclicValue(t *testing.T) {
+	type PNode struct {
+		Note string
+		Next *PNode
+	}
+	type ENode struct {
+		Note Ciphertext
+		Next *ENode
+	}
+	cyclic := &PNode{Note: "a"}
+	cyclic.Next = cyclic
+	if _, err := Encrypt[ENode](testKey, AES_256_GCM, *cyclic, WithConcurrency(4)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("concurrent Encrypt() of a cyclic value error = %v, want ErrUnsupportedType", err)
+	}
+
+	// A leaf that fails before the cycle is reached is reported instead, as
+	// in a sequential walk.
+	cyclicEnc := &ENode{Note: "garbage"}
+	cyclicEnc.Next = cyclicEnc
+	_, sequential := Decrypt[PNode](testKey, *cyclicEnc)
+	_, concurrent := Decrypt[PNode](testKey, *cyclicEnc, WithConcurrency(4))
+	if !errors.Is(concurrent, ErrMalformed) || concurrent.Error() != sequential.Error() {
+		t.Errorf("concurrent Decrypt() error = %v, sequential = %v", concurrent, sequential)
+	}
+}
+
+func TestConcurrency_Options(t *testing.T) {
+	if _, err := NewEncryptor(testKey, WithConcurrency(-1)); err == nil {
+		t.Error("NewEncryptor() with negative concurrency expected error")
+	}
+	// The random bytes of all leaves are read up front.
+	failing := WithRandom(transcrypttest.FailingReader(transcrypttest.NewReader("x"), 10, errors.New("rng down")))
+	if _, err := Encrypt[secureLedger](testKey, AES_256_GCM, testLedger(3, 0), failing, WithConcurrency(2)); err == nil {
+		t.Error("concurrent Encrypt() with a failing random source expected error")
+	}
+}
+
+// BenchmarkConcurrency compares struct encryption and decryption of a large
+// ledger run sequentially with the same run spread over workers.
+func BenchmarkConcurrency(b *testing.B) {
+	in := testLedger(500, 50)
+	enc, err := Encrypt[secureLedger](testKey, AES_256_GCM, in)
+	if err != nil {
+		b.Fatalf("Encrypt() error = %v", err)
+	}
+	for _, workers := range []int{0, 8} {
+		opts := []Option{WithConcurrency(workers)}
+		name := fmt.Sprint("workers=", workers)
+		b.Run(name+"/encrypt", func(b *testing.B) {
+			for b.Loop() {
+				if _, err := Encrypt[secureLedger](testKey, AES_256_GCM, in, opts...); err != nil {
+					b.Fatalf("Encrypt() error = %v", err)
+				}
+			}
+		})
+		b.Run(name+"/decrypt", func(b *testing.B) {
+			for b.Loop() {
+				if _, err := Decrypt[ledger](testKey, enc, opts...); err != nil {
+					b.Fatalf("Decrypt() error = %v", err)
+				}
+			}
+		})
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"math"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/minio/sio"
 )
@@ -18,34 +20,97 @@ import (
 //  1. Cipher suite  - one hex-encoded byte (2 lowercase hex chars, e.g. "0a")
 //  2. Salt          - 32 hex-encoded bytes (64 lowercase hex chars); the HKDF salt
 //     from which both the encryption key and the AEAD nonce derive
-//  3. Data          - hex-encoded ciphertext (non-empty)
+//  3. Commitment    - optional, 32 hex-encoded bytes (64 lowercase hex chars);
+//     the key commitment, present only when encrypted WithKeyCommitment
+//  4. Key ID        - optional, 8 hex-encoded bytes (16 lowercase hex chars);
+//     the key's Fingerprint, present only when encrypted WithKeyID
+//  5. Data          - hex-encoded ciphertext (non-empty)
 //
 // The pattern is anchored so the whole string must match, every field must be
 // valid lowercase hex, and the ciphertext field may not be empty. The original
 // type is no longer a separate field: it is carried inside the authenticated
 // ciphertext (see encodeInnerPayload) so it cannot be tampered with undetected.
-var regexEncryptedString = regexp.MustCompile(`^[0-9a-f]{2}:[0-9a-f]{64}:[0-9a-f]+$`)
+// The data field contains no colon, and the optional fields differ in length,
+// so the length of the fields between salt and data tells which are present.
+var regexEncryptedString = regexp.MustCompile(`^[0-9a-f]{2}:[0-9a-f]{64}(?::[0-9a-f]{64})?(?::[0-9a-f]{16})?:[0-9a-f]+$`)
+
+// innerTag is the authenticated metadata framed in front of the value: its
+// kind and, when the value was stamped (see WithIssuedAt/WithExpiry), its
+// validity window. Zero times mean "not stamped".
+type innerTag struct {
+	kind      string
+	issuedAt  time.Time
+	expiresAt time.Time
+}
 
 // encodeInnerPayload frames the type tag together with the hex-encoded value so
-// that both are encrypted as a single unit. The layout is "<kind>:<hexPayload>"
-// where kind is a reflect.Kind name (lowercase letters/digits only) and
-// hexPayload is the lowercase-hex value produced by convertValueToHexString.
-// Because the delimiter never appears in a kind name, the first colon splits the
-// two fields unambiguously. Framing the kind here (rather than as a plaintext
-// outer field) means it is covered by the AEAD and cannot be altered without
-// failing decryption.
-func encodeInnerPayload(kind string, hexPayload string) string {
-	return kind + ":" + hexPayload
+// that both are encrypted as a single unit. The layout is "<tag>:<hexPayload>"
+// where tag is a reflect.Kind name (lowercase letters/digits only), optionally
+// followed by ";iat=<unix seconds>" and ";exp=<unix seconds>", and hexPayload
+// is the lowercase-hex value produced by convertValueToHexString. Because the
+// delimiter never appears in a tag, the first colon splits the two fields
+// unambiguously; an unstamped value keeps the original "<kind>:<hexPayload>"
+// layout byte for byte. Framing the tag here (rather than as a plaintext outer
+// field) means it is covered by the AEAD and cannot be altered without failing
+// decryption.
+func encodeInnerPayload(tag innerTag, hexPayload string) string {
+	var b strings.Builder
+	b.WriteString(tag.kind)
+	if !tag.issuedAt.IsZero() {
+		b.WriteString(";iat=" + strconv.FormatInt(tag.issuedAt.Unix(), 10))
+	}
+	if !tag.expiresAt.IsZero() {
+		b.WriteString(";exp=" + strconv.FormatInt(tag.expiresAt.Unix(), 10))
+	}
+	b.WriteString(":")
+	b.WriteString(hexPayload)
+	return b.String()
 }
 
-// decodeInnerPayload splits the decrypted inner payload back into its kind name
-// and hex payload. It returns an error if the delimiter is missing.
-func decodeInnerPayload(s string) (kind string, hexPayload string, err error) {
+// innerPaddingByte fills the padding appended after the hex payload when a
+// Padding is configured. It is never a hex digit, so decodeInnerPayload can
+// strip it unambiguously, and unpadded payloads never contain it.
+const innerPaddingByte = '.'
+
+// padInnerPayload pads an encoded inner payload to the length chosen by p.
+func padInnerPayload(payload string, p Padding) (string, error) {
+	n, err := p.size(int64(len(payload)))
+	if err != nil {
+		return "", err
+	}
+	return payload + strings.Repeat(string(innerPaddingByte), int(n)-len(payload)), nil
+}
+
+// decodeInnerPayload splits the decrypted inner payload back into its tag and
+// hex payload, dropping any padding. It returns an error if the delimiter is
+// missing or a tag parameter is malformed.
+func decodeInnerPayload(s string) (tag innerTag, hexPayload string, err error) {
 	parts := strings.SplitN(s, ":", 2)
 	if len(parts) != 2 {
-		return "", "", fmt.Errorf("malformed payload: missing type tag")
+		return innerTag{}, "", fmt.Errorf("%w: payload is missing its type tag", ErrMalformed)
+	}
+
+	fields := strings.Split(parts[0], ";")
+	tag.kind = fields[0]
+	for _, field := range fields[1:] {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return innerTag{}, "", fmt.Errorf("%w: invalid payload tag parameter %q", ErrMalformed, field)
+		}
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return innerTag{}, "", fmt.Errorf("%w: invalid payload tag parameter %q", ErrMalformed, field)
+		}
+		switch name {
+		case "iat":
+			tag.issuedAt = time.Unix(seconds, 0)
+		case "exp":
+			tag.expiresAt = time.Unix(seconds, 0)
+		default:
+			return innerTag{}, "", fmt.Errorf("%w: unknown payload tag parameter %q", ErrMalformed, name)
+		}
 	}
-	return parts[0], parts[1], nil
+	return tag, strings.TrimRight(parts[1], string(innerPaddingByte)), nil
 }
 
 // convertHexStringToValue converts a hex-encoded payload back to a reflect.Value.
@@ -56,45 +121,45 @@ func decodeInnerPayload(s string) (kind string, hexPayload string, err error) {
 func convertHexStringToValue(s string, k reflect.Kind) (reflect.Value, error) {
 	d, err := hex.DecodeString(s)
 	if err != nil {
-		return reflect.Value{}, fmt.Errorf("cannot decode payload hex: %w", err)
+		return reflect.Value{}, fmt.Errorf("%w: cannot decode payload hex: %w", ErrMalformed, err)
 	}
 
 	switch k {
 	case reflect.Bool:
 		if len(d) != 1 {
-			return reflect.Value{}, fmt.Errorf("cannot decode bool: expected 1 byte, got %d", len(d))
+			return reflect.Value{}, fmt.Errorf("%w: cannot decode bool: expected 1 byte, got %d", ErrMalformed, len(d))
 		}
 		return reflect.ValueOf(d[0] != 0), nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		if len(d) != 8 {
-			return reflect.Value{}, fmt.Errorf("cannot decode %v: expected 8 bytes, got %d", k, len(d))
+			return reflect.Value{}, fmt.Errorf("%w: cannot decode %v: expected 8 bytes, got %d", ErrMalformed, k, len(d))
 		}
 		return intValue(k, int64(binary.BigEndian.Uint64(d)))
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		if len(d) != 8 {
-			return reflect.Value{}, fmt.Errorf("cannot decode %v: expected 8 bytes, got %d", k, len(d))
+			return reflect.Value{}, fmt.Errorf("%w: cannot decode %v: expected 8 bytes, got %d", ErrMalformed, k, len(d))
 		}
 		return uintValue(k, binary.BigEndian.Uint64(d))
 	case reflect.Float32:
 		if len(d) != 4 {
-			return reflect.Value{}, fmt.Errorf("cannot decode float32: expected 4 bytes, got %d", len(d))
+			return reflect.Value{}, fmt.Errorf("%w: cannot decode float32: expected 4 bytes, got %d", ErrMalformed, len(d))
 		}
 		return reflect.ValueOf(math.Float32frombits(binary.BigEndian.Uint32(d))), nil
 	case reflect.Float64:
 		if len(d) != 8 {
-			return reflect.Value{}, fmt.Errorf("cannot decode float64: expected 8 bytes, got %d", len(d))
+			return reflect.Value{}, fmt.Errorf("%w: cannot decode float64: expected 8 bytes, got %d", ErrMalformed, len(d))
 		}
 		return reflect.ValueOf(math.Float64frombits(binary.BigEndian.Uint64(d))), nil
 	case reflect.Complex64:
 		if len(d) != 8 {
-			return reflect.Value{}, fmt.Errorf("cannot decode complex64: expected 8 bytes, got %d", len(d))
+			return reflect.Value{}, fmt.Errorf("%w: cannot decode complex64: expected 8 bytes, got %d", ErrMalformed, len(d))
 		}
 		re := math.Float32frombits(binary.BigEndian.Uint32(d[0:4]))
 		im := math.Float32frombits(binary.BigEndian.Uint32(d[4:8]))
 		return reflect.ValueOf(complex(re, im)), nil
 	case reflect.Complex128:
 		if len(d) != 16 {
-			return reflect.Value{}, fmt.Errorf("cannot decode complex128: expected 16 bytes, got %d", len(d))
+			return reflect.Value{}, fmt.Errorf("%w: cannot decode complex128: expected 16 bytes, got %d", ErrMalformed, len(d))
 		}
 		re := math.Float64frombits(binary.BigEndian.Uint64(d[0:8]))
 		im := math.Float64frombits(binary.BigEndian.Uint64(d[8:16]))
@@ -104,7 +169,7 @@ func convertHexStringToValue(s string, k reflect.Kind) (reflect.Value, error) {
 	case reflect.Slice:
 		return reflect.ValueOf(d), nil
 	default:
-		return reflect.Value{}, fmt.Errorf("unknown type %v", k)
+		return reflect.Value{}, fmt.Errorf("%w: %v", ErrUnsupportedType, k)
 	}
 }
 
@@ -114,7 +179,7 @@ func intValue(k reflect.Kind, n int64) (reflect.Value, error) {
 	case reflect.Int:
 		// int is platform-sized; on 32-bit platforms a value that fits int64 may not fit int.
 		if int64(int(n)) != n {
-			return reflect.Value{}, fmt.Errorf("cannot decode int: value %d overflows int on this platform", n)
+			return reflect.Value{}, fmt.Errorf("%w: cannot decode int: value %d overflows int on this platform", ErrUnsupportedType, n)
 		}
 		return reflect.ValueOf(int(n)), nil
 	case reflect.Int8:
@@ -126,7 +191,7 @@ func intValue(k reflect.Kind, n int64) (reflect.Value, error) {
 	case reflect.Int64:
 		return reflect.ValueOf(n), nil
 	default:
-		return reflect.Value{}, fmt.Errorf("unknown type %v", k)
+		return reflect.Value{}, fmt.Errorf("%w: %v", ErrUnsupportedType, k)
 	}
 }
 
@@ -136,7 +201,7 @@ func uintValue(k reflect.Kind, n uint64) (reflect.Value, error) {
 	case reflect.Uint:
 		// uint is platform-sized; on 32-bit platforms a value that fits uint64 may not fit uint.
 		if uint64(uint(n)) != n {
-			return reflect.Value{}, fmt.Errorf("cannot decode uint: value %d overflows uint on this platform", n)
+			return reflect.Value{}, fmt.Errorf("%w: cannot decode uint: value %d overflows uint on this platform", ErrUnsupportedType, n)
 		}
 		return reflect.ValueOf(uint(n)), nil
 	case reflect.Uint8:
@@ -148,7 +213,7 @@ func uintValue(k reflect.Kind, n uint64) (reflect.Value, error) {
 	case reflect.Uint64:
 		return reflect.ValueOf(n), nil
 	default:
-		return reflect.Value{}, fmt.Errorf("unknown type %v", k)
+		return reflect.Value{}, fmt.Errorf("%w: %v", ErrUnsupportedType, k)
 	}
 }
 
@@ -194,34 +259,38 @@ func convertValueToHexString(v reflect.Value) (string, error) {
 		return hex.EncodeToString([]byte(v.String())), nil
 	case reflect.Slice:
 		if v.Type().Elem().Kind() != reflect.Uint8 {
-			return "", fmt.Errorf("unknown type %v", v.Type())
+			return "", fmt.Errorf("%w: %v", ErrUnsupportedType, v.Type())
 		}
 		// The format does not distinguish a nil []byte from an empty one: both
 		// encode to an empty payload and decode back to an empty, non-nil []byte.
 		return hex.EncodeToString(v.Bytes()), nil
 	default:
-		return "", fmt.Errorf("unknown type %v", v.Kind())
+		return "", fmt.Errorf("%w: %v", ErrUnsupportedType, v.Kind())
 	}
 
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
-// decodeHexString decodes data into the pieces that make up the encrypted data.
-// It takes an encryption key and data string and returns the actual encrypted
-// data as a byte-slice and the encryption config. The original type is not
-// returned here: it lives inside the authenticated ciphertext and is recovered
-// only after decryption (see decodeInnerPayload).
-// It returns an error if the data string is empty or invalid, or any of the steps to get the encrypted data fails.
-func decodeHexString(key []byte, data string) ([]byte, sio.Config, error) {
-	if len(key) == 0 {
-		return nil, sio.Config{}, fmt.Errorf("key is empty")
-	}
+// encodedValue holds the fields of an encoded string, decoded from hex but not
+// yet decrypted. commitment and keyID are nil when the value carries none.
+type encodedValue struct {
+	cipherSuite CipherSuite
+	salt        []byte
+	commitment  []byte
+	keyID       []byte
+	ciphertext  []byte
+}
+
+// parseEncodedString splits an encoded string into its fields. It needs no
+// key, so it also backs Inspect. It returns an error if data does not match
+// the layout or names an unknown cipher suite.
+func parseEncodedString(data string) (encodedValue, error) {
 	if data == "" {
-		return nil, sio.Config{}, fmt.Errorf("value is empty")
+		return encodedValue{}, fmt.Errorf("value is empty")
 	}
 
 	if !regexEncryptedString.MatchString(data) {
-		return nil, sio.Config{}, fmt.Errorf("value is not valid")
+		return encodedValue{}, fmt.Errorf("%w: value is not a valid encoded string", ErrMalformed)
 	}
 
 	var split []string
@@ -230,29 +299,67 @@ func decodeHexString(key []byte, data string) ([]byte, sio.Config, error) {
 	var err error
 	var cipherSuiteBytes []byte
 	if cipherSuiteBytes, err = hex.DecodeString(split[0]); err != nil {
-		return nil, sio.Config{}, fmt.Errorf("cannot decode ciphersuite: %w", err)
+		return encodedValue{}, fmt.Errorf("%w: cannot decode ciphersuite: %w", ErrMalformed, err)
 	}
 	// The suite byte is the only field outside the AEAD, so reject an unknown
 	// value here with a clear error (matching decryptFile) instead of letting it
 	// fail deep inside sio. The regex guarantees exactly one byte.
-	if !CipherSuite(cipherSuiteBytes[0]).isValid() {
-		return nil, sio.Config{}, fmt.Errorf("unknown cipher suite: %d", cipherSuiteBytes[0])
+	v := encodedValue{cipherSuite: CipherSuite(cipherSuiteBytes[0])}
+	if !v.cipherSuite.isValid() {
+		return encodedValue{}, fmt.Errorf("%w: %d", ErrUnknownCipherSuite, cipherSuiteBytes[0])
 	}
 
-	var salt []byte
-	if salt, err = hex.DecodeString(split[1]); err != nil {
-		return nil, sio.Config{}, fmt.Errorf("cannot decode salt: %w", err)
+	if v.salt, err = hex.DecodeString(split[1]); err != nil {
+		return encodedValue{}, fmt.Errorf("%w: cannot decode salt: %w", ErrMalformed, err)
+	}
+
+	for _, field := range split[2 : len(split)-1] {
+		if len(field) == 2*fingerprintLength {
+			if v.keyID, err = hex.DecodeString(field); err != nil {
+				return encodedValue{}, fmt.Errorf("%w: cannot decode key ID: %w", ErrMalformed, err)
+			}
+		} else if v.commitment, err = hex.DecodeString(field); err != nil {
+			return encodedValue{}, fmt.Errorf("%w: cannot decode key commitment: %w", ErrMalformed, err)
+		}
+	}
+
+	if v.ciphertext, err = hex.DecodeString(split[len(split)-1]); err != nil {
+		return encodedValue{}, fmt.Errorf("%w: cannot decode encrypted data: %w", ErrMalformed, err)
+	}
+	return v, nil
+}
+
+// decodeHexString decodes data into the pieces that make up the encrypted data.
+// It takes an encryption key and data string and returns the actual encrypted
+// data as a byte-slice and the encryption config. The original type is not
+// returned here: it lives inside the authenticated ciphertext and is recovered
+// only after decryption (see decodeInnerPayload).
+// A key ID, when present, is checked first, then a key commitment is verified
+// while creating the config, so a wrong key is reported before any
+// decryption; with WithKeyCommitment in o a value without one is rejected.
+// It returns an error if the data string is empty or invalid, or any of the steps to get the encrypted data fails.
+func decodeHexString(key []byte, data string, o *options) ([]byte, sio.Config, error) {
+	if len(key) == 0 {
+		return nil, sio.Config{}, fmt.Errorf("key is empty")
 	}
 
-	var encryptedBytes []byte
-	if encryptedBytes, err = hex.DecodeString(split[2]); err != nil {
-		return nil, sio.Config{}, fmt.Errorf("cannot decode encrypted data: %w", err)
+	v, err := parseEncodedString(data)
+	if err != nil {
+		return nil, sio.Config{}, err
+	}
+	if err = checkKeyID(key, v.keyID); err != nil {
+		return nil, sio.Config{}, err
+	}
+	if v.commitment == nil && o.keyCommitment {
+		// Accepting an uncommitted value here would let an attacker strip the
+		// commitment and downgrade to the ambiguous format.
+		return nil, sio.Config{}, fmt.Errorf("%w: value carries no key commitment", ErrAuthentication)
 	}
 
 	var cryptoConfig sio.Config
-	if cryptoConfig, _, err = createCryptoConfig(key, cipherSuiteBytes, salt, nil); err != nil {
+	if cryptoConfig, _, _, err = createCryptoConfig(nil, key, []byte{byte(v.cipherSuite)}, v.salt, nil, v.commitment); err != nil {
 		return nil, sio.Config{}, fmt.Errorf("cannot create crypto config: %w", err)
 	}
 
-	return encryptedBytes, cryptoConfig, nil
+	return v.ciphertext, cryptoConfig, nil
 }
@@ -261,7 +261,7 @@ func Test_decodeHexString(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotData, gotConfig, err := decodeHexString(tt.args.key, tt.args.data)
+			gotData, gotConfig, err := decodeHexString(tt.args.key, tt.args.data, newOptions(nil))
 			if (err != nil) != tt.wantErr {
 				t.Errorf("decodeHexString() error = %v, wantErr %v", err, tt.wantErr)
 				return
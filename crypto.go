@@ -1,8 +1,10 @@
 package transcrypt
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"io"
@@ -27,12 +29,19 @@ const minKeyLength = 16
 // with ClearKey(key) when no longer needed. For storage or display,
 // hex-encode it: hex.EncodeToString(key).
 func CreateKey(byteSize int) ([]byte, error) {
+	return CreateKeyFrom(rand.Reader, byteSize)
+}
+
+// CreateKeyFrom is CreateKey reading from random instead of crypto/rand. It
+// exists so tests can create reproducible keys or inject RNG failures (see
+// package transcrypttest); production code should use CreateKey.
+func CreateKeyFrom(random io.Reader, byteSize int) ([]byte, error) {
 	if byteSize < 16 {
 		return nil, errors.New("byte size must be at least 16")
 	}
 
 	b := make([]byte, byteSize)
-	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+	if _, err := io.ReadFull(random, b); err != nil {
 		return nil, fmt.Errorf("failed to read random data for key: %w", err)
 	}
 
@@ -42,7 +51,8 @@ func CreateKey(byteSize int) ([]byte, error) {
 // ClearKey zeroes the key material so it does not linger in memory longer
 // than needed. Call this when the key is no longer needed. This is
 // best-effort: it clears the slice's backing array, but cannot reach copies
-// the runtime or earlier code may have made elsewhere.
+// the runtime or earlier code may have made elsewhere, nor keep the key from
+// being swapped to disk; see Secret for that.
 func ClearKey(key []byte) {
 	for i := range key {
 		key[i] = 0
@@ -60,11 +70,16 @@ const saltLength = 32
 // encoded strings always carry a saltLength-byte salt.
 const minSaltLength = 16
 
+// commitmentLength is the size, in bytes, of a key commitment (see
+// createCryptoConfig).
+const commitmentLength = 32
+
 // createCryptoConfig creates a sio.Config from the supplied key, cipher and salt.
 // It derives BOTH the 32-byte encryption key and the 12-byte AEAD nonce from the
 // salt via HKDF-SHA256, and returns the salt that was used so the caller can
-// store it. If salt is nil a fresh random saltLength-byte one is generated (the
-// encryption path); on decryption the salt is passed in from the encoded string.
+// store it. If salt is nil a fresh saltLength-byte one is read from random, or
+// from crypto/rand when random is nil (the encryption path); on decryption the
+// salt is passed in from the encoded string.
 //
 // info is the HKDF info parameter and domain-separates the library's container
 // formats: the encoded-string format passes nil (its original derivation, kept
@@ -77,42 +92,61 @@ const minSaltLength = 16
 // the nonce itself is only 96 bits. This is what raises the safe-message ceiling
 // from the ~2^48 birthday bound of a bare 96-bit nonce to ~2^128.
 //
-// It returns an error if key or cipher is empty, or if a supplied salt is shorter
-// than minSaltLength bytes.
-func createCryptoConfig(key []byte, cipher []byte, salt []byte, info []byte) (sio.Config, []byte, error) {
+// The same HKDF stream continues into a commitmentLength-byte key commitment,
+// which is also returned. AES-GCM and ChaCha20-Poly1305 are not key-committing:
+// a crafted ciphertext can authenticate under two different keys. Storing the
+// commitment beside the salt closes that gap, because finding two keys with the
+// same commitment means finding an HKDF collision (see WithKeyCommitment). When
+// commitment is non-nil (the decryption path of committed ciphertext) it is
+// verified here, so a wrong key fails explicitly before any ciphertext is
+// processed. HKDF output is prefix-consistent, so extending the stream leaves
+// the key and nonce, and with them all existing ciphertext, unchanged.
+//
+// It returns an error if key or cipher is empty, if a supplied salt is shorter
+// than minSaltLength bytes, or if a supplied commitment does not match.
+func createCryptoConfig(random io.Reader, key []byte, cipher []byte, salt []byte, info []byte, commitment []byte) (sio.Config, []byte, []byte, error) {
 	if len(key) == 0 {
-		return sio.Config{}, nil, errors.New("key is empty")
+		return sio.Config{}, nil, nil, errors.New("key is empty")
 	}
 
 	if cipher == nil {
-		return sio.Config{}, nil, errors.New("cipher is empty")
+		return sio.Config{}, nil, nil, errors.New("cipher is empty")
 	}
 
 	var err error
 	// If no salt is supplied, generate a fresh random one for this encryption.
 	if salt == nil {
+		if random == nil {
+			random = rand.Reader
+		}
 		salt = make([]byte, saltLength)
-		if _, err = io.ReadFull(rand.Reader, salt); err != nil {
-			return sio.Config{}, nil, fmt.Errorf("failed to read random data for salt: %w", err)
+		if _, err = io.ReadFull(random, salt); err != nil {
+			return sio.Config{}, nil, nil, fmt.Errorf("failed to read random data for salt: %w", err)
 		}
 	}
 
 	if len(salt) < minSaltLength {
-		return sio.Config{}, nil, fmt.Errorf("salt needs to be at least %d bytes, got %d", minSaltLength, len(salt))
+		return sio.Config{}, nil, nil, fmt.Errorf("salt needs to be at least %d bytes, got %d", minSaltLength, len(salt))
 	}
 
-	// Derive the encryption key and the AEAD nonce from a single HKDF stream: the
-	// first 32 bytes are the key, the next 12 are the nonce.
+	// Derive the encryption key, the AEAD nonce and the key commitment from a
+	// single HKDF stream: the first 32 bytes are the key, the next 12 the
+	// nonce, the last commitmentLength the commitment.
 	kdf := hkdf.New(sha256.New, key, salt, info)
-	var derived [32 + 12]byte
+	var derived [32 + 12 + commitmentLength]byte
 	if _, err = io.ReadFull(kdf, derived[:]); err != nil {
-		return sio.Config{}, nil, fmt.Errorf("failed to derive key material: %w", err)
+		return sio.Config{}, nil, nil, fmt.Errorf("failed to derive key material: %w", err)
+	}
+
+	derivedCommitment := derived[32+12:]
+	if commitment != nil && subtle.ConstantTimeCompare(commitment, derivedCommitment) != 1 {
+		return sio.Config{}, nil, nil, fmt.Errorf("%w: key commitment mismatch", ErrAuthentication)
 	}
 
 	var encKey [32]byte
 	var nonce [12]byte
 	copy(encKey[:], derived[:32])
-	copy(nonce[:], derived[32:])
+	copy(nonce[:], derived[32:44])
 
 	// Pin both directions to DARE 2.0. sio's default accepts legacy 1.0 streams
 	// on decrypt, but 1.0 lacks the final-package flag, so a 1.0 stream could be
@@ -125,7 +159,7 @@ func createCryptoConfig(key []byte, cipher []byte, salt []byte, info []byte) (si
 		CipherSuites: cipher,
 		Key:          encKey[:],
 		Nonce:        &nonce,
-	}, salt, nil
+	}, salt, bytes.Clone(derivedCommitment), nil
 }
 
 // getKindForString converts a stored kind name to its reflect.Kind.
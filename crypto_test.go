@@ -1,8 +1,16 @@
 package transcrypt
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/hkdf"
 )
 
 func Test_CreateKey(t *testing.T) {
@@ -99,7 +107,7 @@ func Test_createCryptoConfig(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cfg, salt, err := createCryptoConfig(tt.args.key, tt.args.cipher, tt.args.salt, nil)
+			cfg, salt, _, err := createCryptoConfig(nil, tt.args.key, tt.args.cipher, tt.args.salt, nil, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("createCryptoConfig() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -250,3 +258,115 @@ func Test_getKindForString(t *testing.T) {
 		})
 	}
 }
+
+// Test_createCryptoConfig_Commitment pins the key commitment: it is
+// deterministic for a key and salt, differs between keys, is verified when
+// supplied, and extending the HKDF stream for it leaves the derived key and
+// nonce (and with them all existing ciphertext) unchanged.
+func Test_createCryptoConfig_Commitment(t *testing.T) {
+	salt := bytes.Repeat([]byte{0x5a}, saltLength)
+	cipher := []byte{byte(AES_256_GCM)}
+
+	cfg, _, commitment, err := createCryptoConfig(nil, testKey, cipher, salt, nil, nil)
+	if err != nil {
+		t.Fatalf("createCryptoConfig() error = %v", err)
+	}
+	if len(commitment) != commitmentLength {
+		t.Fatalf("commitment length = %d, want %d", len(commitment), commitmentLength)
+	}
+
+	var legacy [32 + 12]byte
+	if _, err = io.ReadFull(hkdf.New(sha256.New, testKey, salt, nil), legacy[:]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cfg.Key, legacy[:32]) || !bytes.Equal(cfg.Nonce[:], legacy[32:]) {
+		t.Error("deriving the commitment changed the encryption key or nonce")
+	}
+
+	if _, _, _, err = createCryptoConfig(nil, testKey, cipher, salt, nil, commitment); err != nil {
+		t.Errorf("createCryptoConfig() with the matching commitment error = %v", err)
+	}
+	if _, _, _, err = createCryptoConfig(nil, fileTestKey, cipher, salt, nil, commitment); err == nil {
+		t.Error("createCryptoConfig() with another key's commitment expected error")
+	}
+}
+
+func TestKeyCommitment_String(t *testing.T) {
+	enc, err := Encrypt[string](testKey, AES_256_GCM, "committed", WithKeyCommitment())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	parts := strings.Split(enc, ":")
+	if len(parts) != 4 || len(parts[2]) != 2*commitmentLength {
+		t.Fatalf("committed output %q does not carry a commitment field", enc)
+	}
+	if !regexEncryptedString.MatchString(enc) {
+		t.Fatalf("committed output %q is rejected by the format", enc)
+	}
+
+	// Committed values decrypt with or without requiring the commitment.
+	for _, opts := range [][]Option{nil, {WithKeyCommitment()}} {
+		got, err := Decrypt[string](testKey, enc, opts...)
+		if err != nil || got != "committed" {
+			t.Errorf("Decrypt() = %q, %v; want %q", got, err, "committed")
+		}
+	}
+
+	_, err = Decrypt[string](fileTestKey, enc)
+	if err == nil || !strings.Contains(err.Error(), "commitment") {
+		t.Errorf("Decrypt() with the wrong key error = %v, want a commitment mismatch", err)
+	}
+
+	// Stripping the commitment yields a valid legacy value, which is exactly
+	// the downgrade WithKeyCommitment refuses on decryption.
+	stripped := strings.Join([]string{parts[0], parts[1], parts[3]}, ":")
+	if _, err = Decrypt[string](testKey, stripped, WithKeyCommitment()); err == nil {
+		t.Error("Decrypt() requiring a commitment accepted a value without one")
+	}
+	if _, err = Decrypt[string](testKey, stripped); err != nil {
+		t.Errorf("Decrypt() of an uncommitted value error = %v", err)
+	}
+}
+
+func TestKeyCommitment_File(t *testing.T) {
+	dir := t.TempDir()
+	content := patternBytes(100_000)
+	src := writeTestFile(t, dir, "plain", content)
+	enc := filepath.Join(dir, "enc")
+	dec := filepath.Join(dir, "dec")
+
+	if _, err := Encrypt[File](fileTestKey, CHACHA20_POLY1305, File{Source: src, Target: enc}, WithKeyCommitment()); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	encContent, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encContent[4] != fileFormatVersionCommitted {
+		t.Errorf("format version = %d, want %d", encContent[4], fileFormatVersionCommitted)
+	}
+
+	if _, err = Decrypt[File](fileTestKey, File{Source: enc, Target: dec}, WithKeyCommitment()); err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	got, err := os.ReadFile(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("round trip mismatch")
+	}
+
+	_, err = Decrypt[File](testKey, File{Source: enc, Target: dec})
+	if err == nil || !strings.Contains(err.Error(), "commitment") {
+		t.Errorf("Decrypt() with the wrong key error = %v, want a commitment mismatch", err)
+	}
+
+	plainEnc := filepath.Join(dir, "uncommitted")
+	if _, err = Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: plainEnc}); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if _, err = Decrypt[File](fileTestKey, File{Source: plainEnc, Target: dec}, WithKeyCommitment()); err == nil {
+		t.Error("Decrypt() requiring a commitment accepted a version 1 file")
+	}
+}
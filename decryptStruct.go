@@ -5,142 +5,124 @@ import (
 	"reflect"
 )
 
-// decryptValue transforms an encrypted value back into the plain type
-// plainType, mirroring encryptValue: Ciphertext leaves decrypt, identical
-// types copy verbatim, and matching composite kinds recurse. visiting guards
-// against cyclic values exactly as in encryptValue; callers pass nil.
-func decryptValue(key []byte, enc reflect.Value, plainType reflect.Type, path string, visiting map[uintptr]bool) (reflect.Value, error) {
-	if enc.Type() == plainType {
-		return enc, nil
-	}
-
-	if enc.Type() == ciphertextType {
-		return decryptLeaf(key, enc, plainType, path)
-	}
-
-	if enc.Kind() != plainType.Kind() {
-		return reflect.Value{}, pathErrorf(path, "cannot map encrypted type %s to plain type %s", enc.Type(), plainType)
-	}
-
-	switch enc.Kind() {
-	case reflect.Struct:
-		return decryptStruct(key, enc, plainType, path, visiting)
-	case reflect.Slice:
-		if enc.IsNil() {
-			return reflect.Zero(plainType), nil
+// decrypt writes the plain form of an encrypted value into dst, a settable
+// value of the plain type of p, mirroring encrypt: Ciphertext leaves
+// decrypt, identical types copy verbatim, and composite kinds recurse.
+func (w *structWalk) decrypt(p *plan, enc, dst reflect.Value, path string) error {
+	switch p.kind {
+	case planCopy:
+		dst.Set(enc)
+		return nil
+	case planLeaf:
+		if enc.Len() == 0 && emptyLeaf(dst.Type(), w.o) {
+			dst.SetZero()
+			return nil
 		}
-		out := reflect.MakeSlice(plainType, enc.Len(), enc.Len())
-		for i := 0; i < enc.Len(); i++ {
-			elem, err := decryptValue(key, enc.Index(i), plainType.Elem(), joinPath(path, indexPath(i)), visiting)
-			if err != nil {
-				return reflect.Value{}, err
-			}
-			out.Index(i).Set(elem)
+		l := w.leaf(enc, dst, path)
+		if w.batch != nil {
+			w.batch.add(l)
+			return nil
 		}
-		return out, nil
-	case reflect.Array:
-		if enc.Len() != plainType.Len() {
-			return reflect.Value{}, pathErrorf(path, "array length mismatch: encrypted %d, plain %d", enc.Len(), plainType.Len())
+		return decryptLeaf(l, w.o)
+	case planStruct:
+		return w.decryptStruct(p, enc, dst, path)
+	case planInterface:
+		return w.decryptInterface(p, enc, dst, path)
+	case planSlice:
+		if enc.IsNil() {
+			dst.SetZero()
+			return nil
 		}
-		out := reflect.New(plainType).Elem()
+		w.makeSlice(dst, enc.Len())
+		fallthrough
+	case planArray:
 		for i := 0; i < enc.Len(); i++ {
-			elem, err := decryptValue(key, enc.Index(i), plainType.Elem(), joinPath(path, indexPath(i)), visiting)
-			if err != nil {
-				return reflect.Value{}, err
+			if err := w.decrypt(p.elem, enc.Index(i), dst.Index(i), joinPath(path, indexPath(i))); err != nil {
+				return err
 			}
-			out.Index(i).Set(elem)
-		}
-		return out, nil
-	case reflect.Map:
-		if enc.Type().Key() != plainType.Key() {
-			return reflect.Value{}, pathErrorf(path, "map key types must be identical (keys are never encrypted): encrypted %s, plain %s", enc.Type().Key(), plainType.Key())
 		}
+		return nil
+	case planMap:
 		if enc.IsNil() {
-			return reflect.Zero(plainType), nil
+			dst.SetZero()
+			return nil
 		}
-		out := reflect.MakeMapWithSize(plainType, enc.Len())
+		out := w.makeMap(dst, enc.Len())
 		iter := enc.MapRange()
 		for iter.Next() {
-			elem, err := decryptValue(key, iter.Value(), plainType.Elem(), joinPath(path, keyPath(iter.Key())), visiting)
-			if err != nil {
-				return reflect.Value{}, err
+			elem := reflect.New(p.plain.Elem()).Elem()
+			if err := w.decrypt(p.elem, iter.Value(), elem, joinPath(path, keyPath(iter.Key()))); err != nil {
+				return err
 			}
-			out.SetMapIndex(iter.Key(), elem)
+			w.setMapIndex(out, iter.Key(), elem)
 		}
-		return out, nil
-	case reflect.Pointer:
+		return nil
+	default: // planPointer
 		if enc.IsNil() {
-			return reflect.Zero(plainType), nil
-		}
-		ptr := enc.Pointer()
-		if visiting[ptr] {
-			return reflect.Value{}, pathErrorf(path, "cannot decrypt cyclic value: pointer already visited on this path")
+			dst.SetZero()
+			return nil
 		}
-		if visiting == nil {
-			visiting = make(map[uintptr]bool)
+		if err := w.enter(enc, path, "decrypt"); err != nil {
+			return err
 		}
-		visiting[ptr] = true
-		elem, err := decryptValue(key, enc.Elem(), plainType.Elem(), path, visiting)
-		delete(visiting, ptr)
+		out := w.makePointer(dst)
+		err := w.decrypt(p.elem, enc.Elem(), out.Elem(), path)
+		w.leave(enc)
 		if err != nil {
-			return reflect.Value{}, err
+			return err
 		}
-		out := reflect.New(plainType.Elem())
-		out.Elem().Set(elem)
-		return out, nil
-	default:
-		return reflect.Value{}, pathErrorf(path, "cannot map encrypted type %s to plain type %s", enc.Type(), plainType)
+		dst.Set(out)
+		return nil
 	}
 }
 
-// decryptLeaf decrypts a single Ciphertext field and fits the result into the
-// plain field's type via fitValue: the value's kind comes from inside the
-// authenticated ciphertext, so a ciphertext cannot be relabeled into a field
-// of a different kind.
-func decryptLeaf(key []byte, enc reflect.Value, plainType reflect.Type, path string) (reflect.Value, error) {
-	decrypted, err := decryptScalar(key, enc.String())
+// decryptLeaf decrypts a single Ciphertext field into l.dst, fitting the
+// result into the plain field's type via fitLeaf: the value's kind comes from
+// inside the authenticated ciphertext, so a ciphertext cannot be relabeled
+// into a field of a different kind.
+func decryptLeaf(l leaf, o *options) error {
+	decrypted, err := decryptScalar(l.key, l.src.String(), o)
 	if err != nil {
-		return reflect.Value{}, pathErrorf(path, "decrypt failed: %w", err)
+		return pathErrorf(l.path, "decrypt failed: %w", err)
 	}
 
-	out, err := fitValue(reflect.ValueOf(decrypted), plainType)
+	out, err := fitLeaf(decrypted, l.dst.Type())
 	if err != nil {
-		return reflect.Value{}, pathErrorf(path, "%w", err)
+		return pathErrorf(l.path, "%w", err)
 	}
-	return out, nil
+	l.dst.Set(out)
+	return nil
 }
 
-// decryptStruct maps every exported field of the encrypted struct onto the
-// field with the same name in the plain struct, with the same strict
-// two-directional matching as encryptStruct.
-func decryptStruct(key []byte, enc reflect.Value, plainType reflect.Type, path string, visiting map[uintptr]bool) (reflect.Value, error) {
-	encType := enc.Type()
-	encFields := exportedFieldIndex(encType)
-
-	out := reflect.New(plainType).Elem()
-	for i := 0; i < plainType.NumField(); i++ {
-		plainField := plainType.Field(i)
-		if !plainField.IsExported() {
+// decryptStruct maps every exported field of the encrypted struct onto its
+// counterpart in the plain struct, as matched by the plan.
+func (w *structWalk) decryptStruct(p *plan, enc, dst reflect.Value, path string) error {
+	for _, f := range p.fields {
+		fieldPath := joinPath(path, f.name)
+		from, ok := sourceField(enc, f.encIndex)
+		if !ok {
+			// Promoted through a nil embedded pointer: there is no value,
+			// and nothing is allocated for it on the other side.
+			if to, ok := destField(dst, f.plainIndex, false, false); ok {
+				to.SetZero()
+			}
 			continue
 		}
-		encIndex, ok := encFields[plainField.Name]
+		// A zero value is what encryptStruct writes for a field promoted
+		// through a nil embedded pointer, so it leaves such a pointer nil
+		// rather than allocating it.
+		to, ok := destField(dst, f.plainIndex, !from.IsZero(), false)
 		if !ok {
-			return reflect.Value{}, pathErrorf(joinPath(path, plainField.Name), "plain struct %s has no matching field in encrypted struct %s", plainType, encType)
+			continue
 		}
-		delete(encFields, plainField.Name)
-
-		fieldValue, err := decryptValue(key, enc.Field(encIndex), plainField.Type, joinPath(path, plainField.Name), visiting)
+		err := w.field(f.key, fieldPath, func() error {
+			return w.decrypt(f.plan, from, to, fieldPath)
+		})
 		if err != nil {
-			return reflect.Value{}, err
+			return err
 		}
-		out.Field(i).Set(fieldValue)
 	}
-
-	for name := range encFields {
-		return reflect.Value{}, pathErrorf(joinPath(path, name), "encrypted struct %s has no matching field in plain struct %s", encType, plainType)
-	}
-
-	return out, nil
+	return nil
 }
 
 // indexPath renders a slice/array index for error paths, e.g. "[2]".
@@ -0,0 +1,82 @@
+package transcrypt
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// deriveKeyInfo labels the HKDF info of DeriveKey. It differs from the info
+// values of createCryptoConfig (nil and fileHKDFInfo), so a derived key never
+// coincides with the key material derived to encrypt a single value or file
+// under the master key, whatever the context.
+const deriveKeyInfo = "transcrypt derived key v1"
+
+// derivedKeyLength is the size, in bytes, of the keys DeriveKey returns.
+const derivedKeyLength = 32
+
+// tenantContext is the DeriveKey context of a tenant's key, see WithTenant.
+func tenantContext(id string) string {
+	return "tenant:" + id
+}
+
+// DeriveKey derives a 32-byte subkey from master for context, with
+// HKDF-SHA256. Different contexts yield independent keys: knowing one subkey
+// reveals nothing about master or about the subkeys of other contexts. The
+// same master and context always yield the same key, so nothing but master
+// needs to be stored.
+//
+// context names what the key is for, e.g. "tenant:42" or "backups". It is
+// fed to HKDF behind a fixed label and a zero byte, so the derivation cannot
+// collide with the keys the library derives internally. WithTenant derives
+// the key of a tenant as DeriveKey(master, "tenant:"+id).
+//
+// It returns an error if master is shorter than 16 bytes or context is
+// empty. The derived key is an ordinary []byte; clear it with ClearKey, or
+// move it into a Secret with NewSecretFrom.
+func DeriveKey(master []byte, context string) ([]byte, error) {
+	if len(master) < minKeyLength {
+		return nil, fmt.Errorf("master key must be at least %d bytes, got %d", minKeyLength, len(master))
+	}
+	if context == "" {
+		return nil, errors.New("key derivation context is empty")
+	}
+	info := make([]byte, 0, len(deriveKeyInfo)+1+len(context))
+	info = append(append(append(info, deriveKeyInfo...), 0), context...)
+	key := make([]byte, derivedKeyLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, nil, info), key); err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return key, nil
+}
+
+// callKey returns the key a call encrypts or decrypts under: key itself, or
+// the tenant's key derived from it (see WithTenant). With a tenant, the
+// keyring is replaced by one holding the tenant's keys as well.
+func (o *options) callKey(key []byte) ([]byte, error) {
+	if !o.hasTenant {
+		if o.tenantKeys {
+			return nil, errors.New("a tenant ID is required: pass WithTenant")
+		}
+		return key, nil
+	}
+	context := tenantContext(o.tenant)
+	derived, err := DeriveKey(key, context)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q: %w", o.tenant, err)
+	}
+	if o.keyring != nil {
+		ring := maps.Clone(o.keyring)
+		for id, ringKey := range ring {
+			if ring[id], err = DeriveKey(ringKey, context); err != nil {
+				return nil, fmt.Errorf("tenant %q: keyring key %q: %w", o.tenant, id, err)
+			}
+		}
+		o.keyring = ring
+	}
+	return derived, nil
+}
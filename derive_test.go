@@ -0,0 +1,125 @@
+package transcrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jantytgat/go-transcrypt/transcrypttest"
+)
+
+func TestDeriveKey(t *testing.T) {
+	master := transcrypttest.Key("master", 32)
+
+	// Pinned: changing the derivation would orphan every tenant's data.
+	got, err := DeriveKey(master, "tenant:42")
+	if err != nil {
+		t.Fatalf("DeriveKey() error = %v", err)
+	}
+	if want := "e0edfc6810837dfcde11e50691a86e5eade71e40989e14cd215acf707fa00a55"; hex.EncodeToString(got) != want {
+		t.Errorf("DeriveKey() = %x, want %s", got, want)
+	}
+
+	other, _ := DeriveKey(master, "tenant:43")
+	if bytes.Equal(got, other) || bytes.Equal(got, master) {
+		t.Error("DeriveKey() does not separate contexts")
+	}
+
+	tests := []struct {
+		name    string
+		master  []byte
+		context string
+		want    string
+	}{
+		{"short_master", master[:8], "tenant:42", "at least 16 bytes"},
+		{"empty_context", master, "", "context is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DeriveKey(tt.master, tt.context); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("DeriveKey() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithTenant(t *testing.T) {
+	master := transcrypttest.Key("master", 32)
+	enc, err := Encrypt[string](master, AES_256_GCM, "v", WithTenant("42"))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	if got, err := Decrypt[string](master, enc, WithTenant("42")); err != nil || got != "v" {
+		t.Errorf("Decrypt() = %q, %v", got, err)
+	}
+	tenantKey, _ := DeriveKey(master, "tenant:42")
+	if got, err := Decrypt[string](tenantKey, enc); err != nil || got != "v" {
+		t.Errorf("Decrypt() under the derived key = %q, %v", got, err)
+	}
+	for _, opts := range [][]Option{{WithTenant("43")}, nil} {
+		if _, err := Decrypt[string](master, enc, opts...); !errors.Is(err, ErrAuthentication) {
+			t.Errorf("Decrypt() with %d options error = %v, want ErrAuthentication", len(opts), err)
+		}
+	}
+
+	if _, err = Encrypt[string](master, AES_256_GCM, "v", WithTenant("")); err == nil || !strings.Contains(err.Error(), "tenant ID is empty") {
+		t.Errorf("Encrypt() with an empty tenant error = %v", err)
+	}
+}
+
+func TestWithTenantKeyring(t *testing.T) {
+	master := transcrypttest.Key("master", 32)
+	pci := transcrypttest.Key("pci", 32)
+	type P struct{ Card, Email string }
+	type E struct {
+		Card  Ciphertext `transcrypt:",key=pci"`
+		Email Ciphertext
+	}
+	ring := WithKeyring(Keyring{"pci": pci})
+
+	enc, err := Encrypt[E](master, AES_256_GCM, P{"4111", "a@b.c"}, ring, WithTenant("42"))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	tenantPCI, _ := DeriveKey(pci, "tenant:42")
+	if _, err := Decrypt[string](tenantPCI, enc.Card); err != nil {
+		t.Errorf("Card does not decrypt under the tenant's pci key: %v", err)
+	}
+	if _, err := Decrypt[P](master, enc, ring, WithTenant("43")); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("Decrypt() for another tenant error = %v, want ErrAuthentication", err)
+	}
+	if out, err := Decrypt[P](master, enc, ring, WithTenant("42")); err != nil || out != (P{"4111", "a@b.c"}) {
+		t.Errorf("Decrypt() = %+v, %v", out, err)
+	}
+}
+
+func TestEncryptorTenantKeys(t *testing.T) {
+	e, err := NewEncryptor(transcrypttest.Key("master", 32), WithTenantKeys())
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	if _, err = EncryptWith[string](e, "v"); err == nil || !strings.Contains(err.Error(), "tenant ID is required") {
+		t.Errorf("EncryptWith() without a tenant error = %v", err)
+	}
+	if _, err = e.EncryptField("v"); err == nil {
+		t.Error("EncryptField() without a tenant error = nil")
+	}
+
+	tenant, err := e.With(WithTenant("42"))
+	if err != nil {
+		t.Fatalf("With() error = %v", err)
+	}
+	c, err := tenant.EncryptField("v")
+	if err != nil {
+		t.Fatalf("EncryptField() error = %v", err)
+	}
+	if got, err := DecryptWith[string](tenant, c); err != nil || got != "v" {
+		t.Errorf("DecryptWith() = %q, %v", got, err)
+	}
+	if got, err := DecryptField[string](tenant, c); err != nil || got != "v" {
+		t.Errorf("DecryptField() = %q, %v", got, err)
+	}
+}
@@ -4,140 +4,265 @@ import (
 	"reflect"
 )
 
-// encryptValue transforms a plain value into the encrypted type encType. The
-// encrypted type drives the walk: Ciphertext leaves encrypt, identical types
-// copy verbatim, and matching composite kinds recurse. Any other combination
-// is a mismatch between the plain struct and its mirror and returns an error
-// carrying the field path.
+// structWalk carries the state of one struct encryption or decryption
+// through the walkers below and in decryptStruct.go.
 //
 // visiting holds the pointers on the current descent path so a cyclic value
-// (only reachable through a pointer) fails with an error instead of recursing
-// forever. It is nil until the first pointer is followed; callers pass nil.
-// Pointers are removed on the way back up, so a shared (diamond) substructure
-// is not mistaken for a cycle. Storing bare uintptr addresses is safe against
-// GC address reuse: an address stays in the map only for the duration of the
-// recursive call, and the reflect.Value passed into that call keeps the
-// pointed-to object alive.
-func encryptValue(key []byte, cipherSuite CipherSuite, plain reflect.Value, encType reflect.Type, path string, visiting map[uintptr]bool) (reflect.Value, error) {
-	// Identical types are copied verbatim. This is checked before the
-	// Ciphertext leaf case so a Ciphertext-typed field appearing on both
-	// sides is copied, not encrypted a second time.
-	if plain.Type() == encType {
-		return plain, nil
-	}
+// (reachable through a pointer, or through a slice or map stored in an
+// interface) fails with an error instead of recursing forever. It is nil
+// until the first reference is followed. References are removed on the way
+// back up, so a shared (diamond) substructure is not mistaken for a cycle.
+// Storing bare uintptr addresses is safe against GC address reuse: an
+// address stays in the map only for the duration of the recursive call, and
+// the reflect.Value passed into that call keeps the referenced object alive.
+//
+// batch is nil for a sequential walk, which encrypts or decrypts every leaf
+// as it is reached. With WithConcurrency, leaves are queued in batch instead
+// and run on a worker pool once the walk is done (see concurrency.go).
+type structWalk struct {
+	key         []byte
+	cipherSuite CipherSuite
+	o           *options
+	visiting    map[visit]bool
+	batch       *leafBatch
+	// reuse fills the destination in place (see EncryptInto): slices, maps
+	// and pointers it already holds are reused rather than replaced.
+	reuse bool
+}
 
-	if encType == ciphertextType {
-		encrypted, err := encryptScalar(key, cipherSuite, plain.Interface())
-		if err != nil {
-			return reflect.Value{}, pathErrorf(path, "encrypt failed: %w", err)
-		}
-		return reflect.ValueOf(Ciphertext(encrypted)), nil
-	}
+// visit is a reference on the descent path. The type is part of it because a
+// pointer to an array and a slice of it share an address without forming a
+// cycle.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
 
-	if plain.Kind() != encType.Kind() {
-		return reflect.Value{}, pathErrorf(path, "cannot map plain type %s to encrypted type %s", plain.Type(), encType)
+// newStructWalk returns a walk for a single call with options o.
+func newStructWalk(key []byte, o *options) *structWalk {
+	w := &structWalk{key: key, cipherSuite: o.cipherSuite, o: o, reuse: o.inPlace}
+	if o.concurrency > 1 {
+		w.batch = &leafBatch{}
 	}
+	return w
+}
 
-	switch plain.Kind() {
-	case reflect.Struct:
-		return encryptStruct(key, cipherSuite, plain, encType, path, visiting)
-	case reflect.Slice:
-		if plain.IsNil() {
-			return reflect.Zero(encType), nil
+// encrypt writes the encrypted form of a plain value into dst, a settable
+// value of the encrypted type of p, the compiled plan for the pair (see
+// plan.go). The plan drives the walk: Ciphertext leaves encrypt, identical
+// types copy verbatim, and composite kinds recurse. Mismatches between the
+// plain struct and its mirror were already rejected when the plan was
+// compiled, so the errors left here are about the data, and carry the field
+// path.
+func (w *structWalk) encrypt(p *plan, plain, dst reflect.Value, path string) error {
+	switch p.kind {
+	case planCopy:
+		dst.Set(plain)
+		return nil
+	case planLeaf:
+		// Leaves without a value are left as an empty Ciphertext (see
+		// nullable.go); the others are queued with the value to encrypt.
+		d, err := plainLeaf(plain, w.o)
+		if err != nil {
+			return pathErrorf(path, "encrypt failed: %w", err)
 		}
-		out := reflect.MakeSlice(encType, plain.Len(), plain.Len())
-		for i := 0; i < plain.Len(); i++ {
-			elem, err := encryptValue(key, cipherSuite, plain.Index(i), encType.Elem(), joinPath(path, indexPath(i)), visiting)
-			if err != nil {
-				return reflect.Value{}, err
-			}
-			out.Index(i).Set(elem)
+		if d == nil {
+			dst.SetZero()
+			return nil
 		}
-		return out, nil
-	case reflect.Array:
-		if plain.Len() != encType.Len() {
-			return reflect.Value{}, pathErrorf(path, "array length mismatch: plain %d, encrypted %d", plain.Len(), encType.Len())
+		l := w.leaf(reflect.ValueOf(d), dst, path)
+		if w.batch != nil {
+			w.batch.add(l)
+			return nil
 		}
-		out := reflect.New(encType).Elem()
+		return encryptLeaf(l, w.o)
+	case planStruct:
+		return w.encryptStruct(p, plain, dst, path)
+	case planInterface:
+		return w.encryptInterface(p, plain, dst, path)
+	case planSlice:
+		if plain.IsNil() {
+			dst.SetZero()
+			return nil
+		}
+		w.makeSlice(dst, plain.Len())
+		fallthrough
+	case planArray:
 		for i := 0; i < plain.Len(); i++ {
-			elem, err := encryptValue(key, cipherSuite, plain.Index(i), encType.Elem(), joinPath(path, indexPath(i)), visiting)
-			if err != nil {
-				return reflect.Value{}, err
+			if err := w.encrypt(p.elem, plain.Index(i), dst.Index(i), joinPath(path, indexPath(i))); err != nil {
+				return err
 			}
-			out.Index(i).Set(elem)
-		}
-		return out, nil
-	case reflect.Map:
-		if plain.Type().Key() != encType.Key() {
-			return reflect.Value{}, pathErrorf(path, "map key types must be identical (keys are never encrypted): plain %s, encrypted %s", plain.Type().Key(), encType.Key())
 		}
+		return nil
+	case planMap:
 		if plain.IsNil() {
-			return reflect.Zero(encType), nil
+			dst.SetZero()
+			return nil
 		}
-		out := reflect.MakeMapWithSize(encType, plain.Len())
+		out := w.makeMap(dst, plain.Len())
 		iter := plain.MapRange()
 		for iter.Next() {
-			elem, err := encryptValue(key, cipherSuite, iter.Value(), encType.Elem(), joinPath(path, keyPath(iter.Key())), visiting)
-			if err != nil {
-				return reflect.Value{}, err
+			// Map elements are not addressable, so each is built in a
+			// temporary and stored once its leaves are done.
+			elem := reflect.New(p.enc.Elem()).Elem()
+			if err := w.encrypt(p.elem, iter.Value(), elem, joinPath(path, keyPath(iter.Key()))); err != nil {
+				return err
 			}
-			out.SetMapIndex(iter.Key(), elem)
+			w.setMapIndex(out, iter.Key(), elem)
 		}
-		return out, nil
-	case reflect.Pointer:
+		return nil
+	default: // planPointer
 		if plain.IsNil() {
-			return reflect.Zero(encType), nil
-		}
-		ptr := plain.Pointer()
-		if visiting[ptr] {
-			return reflect.Value{}, pathErrorf(path, "cannot encrypt cyclic value: pointer already visited on this path")
+			dst.SetZero()
+			return nil
 		}
-		if visiting == nil {
-			visiting = make(map[uintptr]bool)
+		if err := w.enter(plain, path, "encrypt"); err != nil {
+			return err
 		}
-		visiting[ptr] = true
-		elem, err := encryptValue(key, cipherSuite, plain.Elem(), encType.Elem(), path, visiting)
-		delete(visiting, ptr)
+		out := w.makePointer(dst)
+		err := w.encrypt(p.elem, plain.Elem(), out.Elem(), path)
+		w.leave(plain)
 		if err != nil {
-			return reflect.Value{}, err
+			return err
 		}
-		out := reflect.New(encType.Elem())
-		out.Elem().Set(elem)
-		return out, nil
-	default:
-		return reflect.Value{}, pathErrorf(path, "cannot map plain type %s to encrypted type %s", plain.Type(), encType)
+		dst.Set(out)
+		return nil
 	}
 }
 
-// encryptStruct maps every exported field of the plain struct onto the field
-// with the same name in the encrypted struct. Matching is strict in both
-// directions so no exported field can be dropped silently.
-func encryptStruct(key []byte, cipherSuite CipherSuite, plain reflect.Value, encType reflect.Type, path string, visiting map[uintptr]bool) (reflect.Value, error) {
-	plainType := plain.Type()
-	plainFields := exportedFieldIndex(plainType)
-
-	out := reflect.New(encType).Elem()
-	for i := 0; i < encType.NumField(); i++ {
-		encField := encType.Field(i)
-		if !encField.IsExported() {
+// encryptStruct maps every exported field of the plain struct onto its
+// counterpart in the encrypted struct, as matched by the plan.
+func (w *structWalk) encryptStruct(p *plan, plain, dst reflect.Value, path string) error {
+	for _, f := range p.fields {
+		fieldPath := joinPath(path, f.name)
+		from, ok := sourceField(plain, f.plainIndex)
+		if !ok {
+			// Promoted through a nil embedded pointer: there is no value,
+			// and nothing is allocated for it on the other side.
+			if to, ok := destField(dst, f.encIndex, false, false); ok {
+				to.SetZero()
+			}
 			continue
 		}
-		plainIndex, ok := plainFields[encField.Name]
-		if !ok {
-			return reflect.Value{}, pathErrorf(joinPath(path, encField.Name), "encrypted struct %s has no matching field in plain struct %s", encType, plainType)
+		to, _ := destField(dst, f.encIndex, true, false)
+		err := w.field(f.key, fieldPath, func() error {
+			return w.encrypt(f.plan, from, to, fieldPath)
+		})
+		if err != nil {
+			return err
 		}
-		delete(plainFields, encField.Name)
+	}
+	return nil
+}
 
-		fieldValue, err := encryptValue(key, cipherSuite, plain.Field(plainIndex), encField.Type, joinPath(path, encField.Name), visiting)
-		if err != nil {
-			return reflect.Value{}, err
+// encryptLeaf encrypts a single value, as returned by plainLeaf, into the
+// Ciphertext l.dst. o is passed explicitly because a concurrent walk hands
+// every leaf its own random source.
+func encryptLeaf(l leaf, o *options) error {
+	encrypted, err := encryptScalar(l.key, l.cipherSuite, l.src.Interface(), o)
+	if err != nil {
+		return pathErrorf(l.path, "encrypt failed: %w", err)
+	}
+	l.dst.SetString(encrypted)
+	return nil
+}
+
+// setMapIndex stores elem under key in m: at once in a sequential walk, after
+// the queued leaves have run in a concurrent one, since elem is a copy that
+// would not see their results.
+func (w *structWalk) setMapIndex(m, key, elem reflect.Value) {
+	if w.batch != nil {
+		w.batch.after(func() { m.SetMapIndex(key, elem) })
+		return
+	}
+	m.SetMapIndex(key, elem)
+}
+
+// enter records the pointer, slice or map v as visited on the current path,
+// failing if it already is. verb names the direction in the error.
+func (w *structWalk) enter(v reflect.Value, path, verb string) error {
+	key := visit{v.Pointer(), v.Type()}
+	if w.visiting[key] {
+		return pathErrorf(path, "%w: cannot %s cyclic value: pointer already visited on this path", ErrUnsupportedType, verb)
+	}
+	if w.visiting == nil {
+		w.visiting = make(map[visit]bool)
+	}
+	w.visiting[key] = true
+	return nil
+}
+
+// leave removes v, entered before, from the current path.
+func (w *structWalk) leave(v reflect.Value) {
+	delete(w.visiting, visit{v.Pointer(), v.Type()})
+}
+
+// set stores v in dst: at once in a sequential walk, after the queued leaves
+// have run in a concurrent one, since v is a copy that would not see their
+// results.
+func (w *structWalk) set(dst, v reflect.Value) {
+	if w.batch != nil {
+		w.batch.after(func() { dst.Set(v) })
+		return
+	}
+	dst.Set(v)
+}
+
+// leaf returns the leaf from src to dst under the walk's current key and
+// cipher suite.
+func (w *structWalk) leaf(src, dst reflect.Value, path string) leaf {
+	return leaf{src: src, dst: dst, path: path, key: w.key, cipherSuite: w.cipherSuite}
+}
+
+// field runs walk, which walks the field at path, under the key and cipher
+// suite its mirror tag selects (see WithKeyring). k is nil for a field
+// without them, which inherits those of its parent.
+func (w *structWalk) field(k *fieldKey, path string, walk func() error) error {
+	if k == nil {
+		return walk()
+	}
+	key, cipherSuite := w.key, w.cipherSuite
+	defer func() { w.key, w.cipherSuite = key, cipherSuite }()
+	if k.id != "" {
+		ringKey, ok := w.o.keyring[k.id]
+		if !ok {
+			return pathErrorf(path, "key %q is not in the keyring", k.id)
 		}
-		out.Field(i).Set(fieldValue)
+		w.key = ringKey
+	}
+	if k.hasSuite {
+		w.cipherSuite = k.cipherSuite
 	}
+	return walk()
+}
+
+// makeSlice sets dst to a slice of length n: the slice dst holds, resliced,
+// when reusing it and its capacity suffices, a new one otherwise.
+func (w *structWalk) makeSlice(dst reflect.Value, n int) {
+	if w.reuse && !dst.IsNil() && dst.Cap() >= n {
+		dst.SetLen(n)
+		return
+	}
+	dst.Set(reflect.MakeSlice(dst.Type(), n, n))
+}
 
-	for name := range plainFields {
-		return reflect.Value{}, pathErrorf(joinPath(path, name), "plain struct %s has no matching field in encrypted struct %s", plainType, encType)
+// makeMap sets dst to an empty map with room for n elements, the map dst
+// holds, cleared, when reusing it, and returns it.
+func (w *structWalk) makeMap(dst reflect.Value, n int) reflect.Value {
+	if w.reuse && !dst.IsNil() {
+		dst.Clear()
+		return dst
 	}
+	out := reflect.MakeMapWithSize(dst.Type(), n)
+	dst.Set(out)
+	return out
+}
 
-	return out, nil
+// makePointer returns the pointer to fill for dst: the one dst holds when
+// reusing it, a new one otherwise. The caller stores it in dst once filled.
+func (w *structWalk) makePointer(dst reflect.Value) reflect.Value {
+	if w.reuse && !dst.IsNil() {
+		return dst
+	}
+	return reflect.New(dst.Type().Elem())
 }
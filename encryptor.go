@@ -0,0 +1,182 @@
+package transcrypt
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Encryptor bundles a key with options, so code that encrypts and decrypts
+// repeatedly configures the cipher suite, encoding and other knobs once
+// instead of on every call:
+//
+//	enc, err := transcrypt.NewEncryptor(key, transcrypt.WithCipherSuite(transcrypt.CHACHA20_POLY1305))
+//	secure, err := transcrypt.EncryptWith[SecureAccount](enc, account)
+//	restored, err := transcrypt.DecryptWith[Account](enc, secure)
+//
+// An Encryptor serves every shape Encrypt and Decrypt serve: single values,
+// structs and files. EncryptWith and DecryptWith name the target as a type
+// parameter like Encrypt and Decrypt; the Encrypt and Decrypt methods take a
+// pointer to the target instead, for callers that hold an Encryptor behind an
+// interface or pick the target type at run time.
+//
+// An Encryptor is immutable and safe for concurrent use. It does not copy the
+// key: clearing the caller's slice with ClearKey clears it for the Encryptor
+// too, after which it can no longer be used. The same holds for a Secret key
+// and Destroy.
+type Encryptor struct {
+	key  []byte
+	opts []Option
+}
+
+// NewEncryptor returns an Encryptor for key configured with opts. The cipher
+// suite defaults to AES_256_GCM (see WithCipherSuite). It returns an error if
+// an option value is invalid; the key itself is checked on use, exactly as by
+// Encrypt and Decrypt, so an Encryptor with a short legacy key can still
+// decrypt.
+func NewEncryptor(key []byte, opts ...Option) (*Encryptor, error) {
+	e := &Encryptor{key: key, opts: slices.Clone(opts)}
+	if err := e.options().validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// With returns a copy of e with opts applied on top of its own options, e.g.
+// to decrypt one value under a max age. e itself is unchanged.
+func (e *Encryptor) With(opts ...Option) (*Encryptor, error) {
+	return NewEncryptor(e.key, slices.Concat(e.opts, opts)...)
+}
+
+// options resolves e's options for a single call.
+func (e *Encryptor) options() *options {
+	return newOptions(e.opts)
+}
+
+// EncryptWith encrypts d into the target type E using e's key and options. It
+// is Encrypt with the key, cipher suite and options taken from e; see Encrypt
+// for the target types.
+func EncryptWith[E any](e *Encryptor, d any) (E, error) {
+	var zero E
+	out, err := e.encrypt(reflect.TypeOf((*E)(nil)).Elem(), d, reflect.Value{}, false)
+	if err != nil {
+		return zero, err
+	}
+	return out.Interface().(E), nil
+}
+
+// DecryptWith decrypts data into the target type P using e's key and options.
+// It is Decrypt with the key and options taken from e; see Decrypt for the
+// target types.
+func DecryptWith[P any](e *Encryptor, data any) (P, error) {
+	var zero P
+	out, err := e.decrypt(reflect.TypeOf((*P)(nil)).Elem(), data, reflect.Value{}, false)
+	if err != nil {
+		return zero, err
+	}
+	return out.Interface().(P), nil
+}
+
+// Encrypt encrypts d into the value dst points to, whose type selects the
+// target exactly like the type parameter of the package-level Encrypt: a
+// *string (or pointer to another string type) for single values, a pointer to
+// a mirror struct for structs, a *File for files. dst is only written on
+// success.
+func (e *Encryptor) Encrypt(dst any, d any) error {
+	target, err := targetOf(dst)
+	if err != nil {
+		return err
+	}
+	out, err := e.encrypt(target.Type(), d, target, false)
+	if err != nil {
+		return err
+	}
+	target.Set(out)
+	return nil
+}
+
+// Decrypt decrypts data into the value dst points to, whose type selects the
+// target exactly like the type parameter of the package-level Decrypt: a
+// pointer to an interface (typically *any) keeps the stored type, a pointer
+// to a concrete type enforces it, a pointer to a plain struct rebuilds a
+// struct, a *File restores a file. dst is only written on success. With
+// WithFields, the fields outside the selection keep the values dst holds.
+func (e *Encryptor) Decrypt(dst any, data any) error {
+	target, err := targetOf(dst)
+	if err != nil {
+		return err
+	}
+	out, err := e.decrypt(target.Type(), data, target, false)
+	if err != nil {
+		return err
+	}
+	target.Set(out)
+	return nil
+}
+
+// EncryptInto is EncryptInto with the key and options taken from e: it fills
+// the value dst points to in place.
+func (e *Encryptor) EncryptInto(dst any, d any) error {
+	target, err := targetOf(dst)
+	if err != nil {
+		return err
+	}
+	out, err := e.encrypt(target.Type(), d, target, true)
+	if err != nil {
+		return err
+	}
+	target.Set(out)
+	return nil
+}
+
+// DecryptInto is DecryptInto with the key and options taken from e: it fills
+// the value dst points to in place.
+func (e *Encryptor) DecryptInto(dst any, data any) error {
+	target, err := targetOf(dst)
+	if err != nil {
+		return err
+	}
+	out, err := e.decrypt(target.Type(), data, target, true)
+	if err != nil {
+		return err
+	}
+	target.Set(out)
+	return nil
+}
+
+// encrypt and decrypt run a call into the destination into, if valid, which
+// inPlace makes them fill directly.
+func (e *Encryptor) encrypt(encType reflect.Type, d any, into reflect.Value, inPlace bool) (reflect.Value, error) {
+	o := e.options()
+	if err := o.validate(); err != nil {
+		return reflect.Value{}, err
+	}
+	o.inPlace = inPlace
+	key, err := o.callKey(e.key)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return encryptTo(key, encType, d, into, o)
+}
+
+func (e *Encryptor) decrypt(plainType reflect.Type, data any, into reflect.Value, inPlace bool) (reflect.Value, error) {
+	o := e.options()
+	if err := o.validate(); err != nil {
+		return reflect.Value{}, err
+	}
+	o.inPlace = inPlace
+	key, err := o.callKey(e.key)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return decryptTo(key, plainType, data, into, o)
+}
+
+// targetOf returns the settable value a non-nil pointer dst points to.
+func targetOf(dst any) (reflect.Value, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return reflect.Value{}, fmt.Errorf("%w: destination must be a non-nil pointer, got %T", ErrUnsupportedType, dst)
+	}
+	return v.Elem(), nil
+}
@@ -0,0 +1,171 @@
+package transcrypt
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncryptor_RoundTrip(t *testing.T) {
+	e, err := NewEncryptor(testKey, WithCipherSuite(CHACHA20_POLY1305))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+
+	enc, err := EncryptWith[string](e, int16(-3))
+	if err != nil {
+		t.Fatalf("EncryptWith() error = %v", err)
+	}
+	if !strings.HasPrefix(enc, "01:") {
+		t.Errorf("EncryptWith() = %q, want the CHACHA20_POLY1305 suite byte", enc)
+	}
+	got, err := DecryptWith[any](e, enc)
+	if err != nil || got != int16(-3) {
+		t.Errorf("DecryptWith() = %v (%T), %v; want -3 (int16)", got, got, err)
+	}
+
+	// The package-level functions read the same format.
+	if got, err = Decrypt[any](testKey, enc); err != nil || got != int16(-3) {
+		t.Errorf("Decrypt() = %v, %v; want -3", got, err)
+	}
+
+	secure, err := EncryptWith[SecureOuter](e, testOuter())
+	if err != nil {
+		t.Fatalf("EncryptWith() struct error = %v", err)
+	}
+	restored, err := DecryptWith[Outer](e, secure)
+	if err != nil {
+		t.Fatalf("DecryptWith() struct error = %v", err)
+	}
+	if !reflect.DeepEqual(restored, testOuter()) {
+		t.Errorf("struct round trip = %+v, want %+v", restored, testOuter())
+	}
+}
+
+func TestEncryptor_Methods(t *testing.T) {
+	e, err := NewEncryptor(testKey)
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+
+	var enc Ciphertext
+	if err = e.Encrypt(&enc, "hello"); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	var typed string
+	if err = e.Decrypt(&typed, enc); err != nil || typed != "hello" {
+		t.Errorf("Decrypt(*string) = %q, %v; want hello", typed, err)
+	}
+	var untyped any
+	if err = e.Decrypt(&untyped, enc); err != nil || untyped != "hello" {
+		t.Errorf("Decrypt(*any) = %v, %v; want hello", untyped, err)
+	}
+
+	var secure SecureInner
+	if err = e.Encrypt(&secure, Inner{Note: "n", Public: 1}); err != nil {
+		t.Fatalf("Encrypt() struct error = %v", err)
+	}
+	var inner Inner
+	if err = e.Decrypt(&inner, secure); err != nil || inner != (Inner{Note: "n", Public: 1}) {
+		t.Errorf("Decrypt() struct = %+v, %v", inner, err)
+	}
+
+	dir := t.TempDir()
+	content := patternBytes(1000)
+	src := writeTestFile(t, dir, "plain", content)
+	var out File
+	if err = e.Encrypt(&out, File{Source: src, Target: filepath.Join(dir, "enc")}); err != nil {
+		t.Fatalf("Encrypt() file error = %v", err)
+	}
+	if err = e.Decrypt(&out, File{Source: out.Target, Target: filepath.Join(dir, "dec")}); err != nil {
+		t.Fatalf("Decrypt() file error = %v", err)
+	}
+	if got, _ := os.ReadFile(out.Target); !bytes.Equal(got, content) {
+		t.Error("file round trip mismatch")
+	}
+
+	// A failed call leaves the destination untouched.
+	typed = "unchanged"
+	if err = e.Decrypt(&typed, "garbage"); err == nil || typed != "unchanged" {
+		t.Errorf("Decrypt() of garbage = %q, %v; want error and untouched destination", typed, err)
+	}
+	for _, dst := range []any{nil, typed, (*string)(nil)} {
+		if err = e.Decrypt(dst, enc); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("Decrypt(%T) error = %v, want ErrUnsupportedType", dst, err)
+		}
+	}
+}
+
+func TestEncryptor_With(t *testing.T) {
+	e, err := NewEncryptor(testKey, WithIssuedAt(), fixedClock(expiryEpoch))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	enc, err := EncryptWith[string](e, "stamped")
+	if err != nil {
+		t.Fatalf("EncryptWith() error = %v", err)
+	}
+
+	strict, err := e.With(WithMaxAge(time.Minute), fixedClock(expiryEpoch.Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("With() error = %v", err)
+	}
+	if _, err = DecryptWith[string](strict, enc); err == nil {
+		t.Error("DecryptWith() past the max age expected error")
+	}
+	// e itself is unaffected by With.
+	if _, err = DecryptWith[string](e, enc); err != nil {
+		t.Errorf("DecryptWith() on the original error = %v", err)
+	}
+
+	if _, err = e.With(WithMaxAge(-time.Second)); err == nil {
+		t.Error("With() an invalid option expected error")
+	}
+	if _, err = NewEncryptor(testKey, WithPadding(PadToBlock(-1))); err == nil {
+		t.Error("NewEncryptor() with an invalid option expected error")
+	}
+}
+
+func TestEncryptor_WithRandom(t *testing.T) {
+	e, err := NewEncryptor(testKey, WithRandom(zeroReader{}))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	first, err := EncryptWith[string](e, "deterministic")
+	if err != nil {
+		t.Fatalf("EncryptWith() error = %v", err)
+	}
+	second, err := EncryptWith[string](e, "deterministic")
+	if err != nil {
+		t.Fatalf("EncryptWith() error = %v", err)
+	}
+	if first != second {
+		t.Errorf("outputs under a fixed random source differ: %q vs %q", first, second)
+	}
+	if want := "00:" + strings.Repeat("00", saltLength) + ":"; !strings.HasPrefix(first, want) {
+		t.Errorf("EncryptWith() = %q, want the salt read from the random source", first)
+	}
+
+	failing, err := NewEncryptor(testKey, WithRandom(bytes.NewReader(nil)))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	if _, err = EncryptWith[string](failing, "x"); err == nil {
+		t.Error("EncryptWith() with an exhausted random source expected error")
+	}
+}
+
+func TestEncrypt_SuiteArgumentWins(t *testing.T) {
+	enc, err := Encrypt[string](testKey, AES_256_GCM, "x", WithCipherSuite(CHACHA20_POLY1305))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !strings.HasPrefix(enc, "00:") {
+		t.Errorf("Encrypt() = %q, want the suite passed as argument", enc)
+	}
+}
@@ -0,0 +1,82 @@
+package transcrypt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/minio/sio"
+)
+
+// Sentinel errors classify failures so callers can react to them with
+// errors.Is instead of matching message text. The errors returned by this
+// package wrap at most one of them, together with the details of the
+// failure; errors about invalid arguments (an empty key, a nil value, an
+// invalid option) wrap none.
+var (
+	// ErrAuthentication reports that a value or file did not authenticate:
+	// it was encrypted under a different key, or it was altered, truncated
+	// or stripped of its key commitment.
+	ErrAuthentication = errors.New("wrong key or tampered data")
+
+	// ErrMalformed reports input that is not in a format this package can
+	// decode, such as a string that is not an encoded value or a token using
+	// features that are not supported.
+	ErrMalformed = errors.New("malformed input")
+
+	// ErrUnknownCipherSuite reports a cipher suite that is not one of the
+	// known CipherSuite values, whether passed by the caller or read from
+	// encrypted data.
+	ErrUnknownCipherSuite = errors.New("unknown cipher suite")
+
+	// ErrUnsupportedType reports a value or target type the requested
+	// operation cannot handle, such as a channel passed to Encrypt or an int
+	// target for Encrypt.
+	ErrUnsupportedType = errors.New("unsupported type")
+
+	// ErrKindMismatch reports that a decrypted value does not fit the
+	// requested type, or that a plain struct and its mirror disagree on a
+	// field's type.
+	ErrKindMismatch = errors.New("kind mismatch")
+
+	// ErrNotTranscryptFile reports that a file passed to Decrypt[File] does
+	// not start with the transcrypt file header.
+	ErrNotTranscryptFile = errors.New("not a transcrypt-encrypted file")
+)
+
+// FieldError reports a failure at a field of a struct being encrypted or
+// decrypted. Path locates the field in the notation of joinPath, e.g.
+// "Inners[2].Note". Err is the underlying failure, so errors.Is still matches
+// the sentinel errors through a FieldError.
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// authReader marks the stream errors of a decrypting sio reader with
+// ErrAuthentication. Streaming file decryption copies from such a reader, and
+// without the mark a failed authentication could not be told apart from a
+// failed write to the destination. sio reports every flaw in the ciphertext
+// stream, from a failed tag to a missing final package, as a sio.Error;
+// errors from the source reader, such as a failing disk, pass through
+// unchanged so they are not mistaken for tampering.
+type authReader struct {
+	r io.Reader
+}
+
+func (a authReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	var streamErr sio.Error
+	if errors.As(err, &streamErr) {
+		err = fmt.Errorf("%w: %w", ErrAuthentication, err)
+	}
+	return n, err
+}
@@ -0,0 +1,168 @@
+package transcrypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestErrorSentinels(t *testing.T) {
+	valid, err := Encrypt[string](testKey, AES_256_GCM, "hello")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	otherKey := []byte("another-key-of-sufficient-length")
+	// Replace the last hex digit of the ciphertext field.
+	last := "0"
+	if strings.HasSuffix(valid, "0") {
+		last = "1"
+	}
+	tampered := valid[:len(valid)-1] + last
+
+	tests := []struct {
+		name string
+		run  func() error
+		want error
+	}{
+		{"wrong_key", func() error { _, err := Decrypt[string](otherKey, valid); return err }, ErrAuthentication},
+		{"tampered", func() error { _, err := Decrypt[string](testKey, tampered); return err }, ErrAuthentication},
+		{"not_encoded", func() error { _, err := Decrypt[string](testKey, "not an encoded value"); return err }, ErrMalformed},
+		{"unknown_suite_encrypt", func() error { _, err := Encrypt[string](testKey, CipherSuite(99), "x"); return err }, ErrUnknownCipherSuite},
+		{"unknown_suite_decrypt", func() error { _, err := Decrypt[string](testKey, "63"+valid[2:]); return err }, ErrUnknownCipherSuite},
+		{"unknown_suite_name", func() error { _, err := GetCipherSuite("ROT13"); return err }, ErrUnknownCipherSuite},
+		{"unsupported_value", func() error { _, err := Encrypt[string](testKey, AES_256_GCM, make(chan int)); return err }, ErrUnsupportedType},
+		{"unsupported_target", func() error { _, err := Encrypt[int](testKey, AES_256_GCM, 1); return err }, ErrUnsupportedType},
+		{"kind_mismatch", func() error { _, err := Decrypt[int64](testKey, valid); return err }, ErrKindMismatch},
+		{"fernet_signature", func() error {
+			token, err := Encrypt[string](jweTestKey, AES_256_GCM, "x", WithEncoding(EncodingFernet))
+			if err != nil {
+				return err
+			}
+			wrong := append([]byte(nil), jweTestKey...)
+			wrong[0] ^= 1
+			_, err = Decrypt[string](wrong, token, WithEncoding(EncodingFernet))
+			return err
+		}, ErrAuthentication},
+		{"jwe_wrong_key", func() error {
+			token, err := Encrypt[string](jweTestKey, AES_256_GCM, "x", WithEncoding(EncodingJWE))
+			if err != nil {
+				return err
+			}
+			wrong := append([]byte(nil), jweTestKey...)
+			wrong[0] ^= 1
+			_, err = Decrypt[string](wrong, token, WithEncoding(EncodingJWE))
+			return err
+		}, ErrAuthentication},
+		{"jwe_malformed", func() error { _, err := Decrypt[string](jweTestKey, "a.b.c", WithEncoding(EncodingJWE)); return err }, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want errors.Is %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorSentinels_File(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", patternBytes(100_000))
+	enc := filepath.Join(dir, "enc")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: enc}); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	data, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 1
+
+	tests := []struct {
+		name    string
+		content []byte
+		key     []byte
+		want    error
+	}{
+		{"foreign", []byte("plain text, not encrypted"), fileTestKey, ErrNotTranscryptFile},
+		{"too_short", []byte("TC"), fileTestKey, ErrNotTranscryptFile},
+		{"truncated_header", data[:10], fileTestKey, ErrMalformed},
+		{"wrong_key", data, testKey, ErrAuthentication},
+		{"tampered", flipped, fileTestKey, ErrAuthentication},
+		{"truncated_stream", data[:fileHeaderLength], fileTestKey, ErrAuthentication},
+		{"truncated_package", data[:len(data)-1000], fileTestKey, ErrAuthentication},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, dir, tt.name, tt.content)
+			_, err := Decrypt[File](tt.key, File{Source: path, Target: filepath.Join(dir, "out")})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want errors.Is %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileErrorSentinels_ReadError(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", patternBytes(200_000))
+	enc := filepath.Join(dir, "enc")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: enc}); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	data, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing source is an I/O error, not tampering, wherever it fails.
+	errDisk := errors.New("disk failure")
+	for _, cut := range []int{fileHeaderLength, fileHeaderLength + 100, fileHeaderLength + darePackageLength + 100} {
+		src := io.MultiReader(bytes.NewReader(data[:cut]), iotest.ErrReader(errDisk))
+		_, err := decryptFileStream(fileTestKey, src, io.Discard, newOptions(nil))
+		if !errors.Is(err, errDisk) || errors.Is(err, ErrAuthentication) {
+			t.Errorf("cut at %d: error = %v, want the read error without ErrAuthentication", cut, err)
+		}
+	}
+	// A stream that ends early still fails authentication.
+	_, err = decryptFileStream(fileTestKey, bytes.NewReader(data[:len(data)-100]), io.Discard, newOptions(nil))
+	if !errors.Is(err, ErrAuthentication) {
+		t.Errorf("truncated stream error = %v, want ErrAuthentication", err)
+	}
+}
+
+func TestFieldError(t *testing.T) {
+	enc, err := Encrypt[SecureOuter](testKey, AES_256_GCM, testOuter())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	enc.Inners[1].Note = "garbage"
+	_, err = Decrypt[Outer](testKey, enc)
+
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Fatalf("error = %v, want *FieldError", err)
+	}
+	if fieldErr.Path != "Inners[1].Note" {
+		t.Errorf("Path = %q, want %q", fieldErr.Path, "Inners[1].Note")
+	}
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("error = %v, want it to wrap ErrMalformed", err)
+	}
+
+	type P struct{ Inner struct{ N int } }
+	type E struct{ Inner struct{ N string } }
+	_, err = Encrypt[E](testKey, AES_256_GCM, P{})
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "Inner.N" {
+		t.Fatalf("error = %v, want *FieldError at Inner.N", err)
+	}
+	if !errors.Is(err, ErrKindMismatch) {
+		t.Errorf("error = %v, want it to wrap ErrKindMismatch", err)
+	}
+}
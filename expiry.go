@@ -0,0 +1,67 @@
+package transcrypt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxClockSkew is how far in the future an issue time may lie before an
+// age-checked decryption rejects it. It tolerates clocks drifting between the
+// encrypting and decrypting hosts, and matches the Fernet reference
+// implementations.
+const maxClockSkew = 60 * time.Second
+
+// ExpiredError is returned by Decrypt when a value is no longer valid: its
+// embedded expiry has passed (see WithExpiry), or it is older than the
+// allowed max age (see WithMaxAge). Test for it with errors.As.
+type ExpiredError struct {
+	// IssuedAt is the value's embedded issue time.
+	IssuedAt time.Time
+	// ExpiredAt is the moment the value became invalid: its embedded expiry,
+	// or its issue time plus the max age, whichever was exceeded.
+	ExpiredAt time.Time
+	// Now is the clock reading the value was checked against.
+	Now time.Time
+}
+
+func (e *ExpiredError) Error() string {
+	return fmt.Sprintf("value issued at %s expired at %s", e.IssuedAt.UTC().Format(time.RFC3339), e.ExpiredAt.UTC().Format(time.RFC3339))
+}
+
+// stamp returns the validity window configured in o for a value encrypted
+// now, as zero times when stamping is off.
+func (o *options) stamp() (issuedAt, expiresAt time.Time) {
+	if !o.issuedAt {
+		return time.Time{}, time.Time{}
+	}
+	issuedAt = o.clock().Truncate(time.Second)
+	if o.expiry > 0 {
+		expiresAt = issuedAt.Add(o.expiry)
+	}
+	return issuedAt, expiresAt
+}
+
+// checkValidity enforces a decrypted value's validity window against the
+// clock: an embedded expiry always, the max age only when one is configured.
+// Zero times mean the value was not stamped. Callers pass only authenticated
+// timestamps.
+func (o *options) checkValidity(issuedAt, expiresAt time.Time) error {
+	now := o.clock()
+	if !expiresAt.IsZero() && !now.Before(expiresAt) {
+		return &ExpiredError{IssuedAt: issuedAt, ExpiredAt: expiresAt, Now: now}
+	}
+	if o.maxAge == 0 {
+		return nil
+	}
+	if issuedAt.IsZero() {
+		return errors.New("value carries no issue time, so its max age cannot be enforced")
+	}
+	if issuedAt.Sub(now) > maxClockSkew {
+		return fmt.Errorf("value issued at %s lies in the future", issuedAt.UTC().Format(time.RFC3339))
+	}
+	if now.Sub(issuedAt) > o.maxAge {
+		return &ExpiredError{IssuedAt: issuedAt, ExpiredAt: issuedAt.Add(o.maxAge), Now: now}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package transcrypt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var expiryEpoch = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestExpiry_MaxAge(t *testing.T) {
+	enc, err := Encrypt[string](testKey, AES_256_GCM, "reset-token", WithIssuedAt(), fixedClock(expiryEpoch))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	decryptAt := func(now time.Time) error {
+		_, err := Decrypt[string](testKey, enc, WithMaxAge(time.Hour), fixedClock(now))
+		return err
+	}
+	if err = decryptAt(expiryEpoch.Add(59 * time.Minute)); err != nil {
+		t.Errorf("value within max age rejected: %v", err)
+	}
+
+	err = decryptAt(expiryEpoch.Add(61 * time.Minute))
+	var expired *ExpiredError
+	if !errors.As(err, &expired) {
+		t.Fatalf("error = %v, want *ExpiredError", err)
+	}
+	if !expired.IssuedAt.Equal(expiryEpoch) || !expired.ExpiredAt.Equal(expiryEpoch.Add(time.Hour)) {
+		t.Errorf("ExpiredError = %+v, want issued %s expired %s", expired, expiryEpoch, expiryEpoch.Add(time.Hour))
+	}
+
+	if err = decryptAt(expiryEpoch.Add(-2 * maxClockSkew)); err == nil {
+		t.Error("value issued in the future accepted")
+	}
+	// Without WithMaxAge the issue time is not enforced.
+	if _, err = Decrypt[string](testKey, enc, fixedClock(expiryEpoch.Add(24*time.Hour))); err != nil {
+		t.Errorf("Decrypt() without max age error = %v", err)
+	}
+}
+
+func TestExpiry_EmbeddedExpiry(t *testing.T) {
+	enc, err := Encrypt[string](testKey, CHACHA20_POLY1305, int64(42), WithExpiry(15*time.Minute), fixedClock(expiryEpoch))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	got, err := Decrypt[int64](testKey, enc, fixedClock(expiryEpoch.Add(14*time.Minute)))
+	if err != nil || got != 42 {
+		t.Fatalf("Decrypt() before expiry = %v, %v; want 42", got, err)
+	}
+
+	// The expiry is enforced without WithMaxAge.
+	_, err = Decrypt[int64](testKey, enc, fixedClock(expiryEpoch.Add(15*time.Minute)))
+	var expired *ExpiredError
+	if !errors.As(err, &expired) {
+		t.Fatalf("error = %v, want *ExpiredError", err)
+	}
+	if !expired.ExpiredAt.Equal(expiryEpoch.Add(15 * time.Minute)) {
+		t.Errorf("ExpiredAt = %s, want %s", expired.ExpiredAt, expiryEpoch.Add(15*time.Minute))
+	}
+}
+
+func TestExpiry_MaxAgeRequiresTimestamp(t *testing.T) {
+	enc, err := Encrypt[string](testKey, AES_256_GCM, "no stamp")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	_, err = Decrypt[string](testKey, enc, WithMaxAge(time.Hour))
+	if err == nil {
+		t.Fatal("Decrypt() of an unstamped value under a max age expected error")
+	}
+	var expired *ExpiredError
+	if errors.As(err, &expired) {
+		t.Error("missing timestamp must not be reported as expiry")
+	}
+}
+
+func TestExpiry_StructLeaves(t *testing.T) {
+	type P struct{ Token string }
+	type E struct{ Token Ciphertext }
+
+	enc, err := Encrypt[E](testKey, AES_256_GCM, P{Token: "t"}, WithExpiry(time.Minute), fixedClock(expiryEpoch))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	_, err = Decrypt[P](testKey, enc, fixedClock(expiryEpoch.Add(time.Hour)))
+	var expired *ExpiredError
+	if !errors.As(err, &expired) {
+		t.Errorf("error = %v, want *ExpiredError", err)
+	}
+}
+
+func TestExpiry_JWE(t *testing.T) {
+	enc, err := Encrypt[string](jweTestKey, AES_256_GCM, "jose", WithEncoding(EncodingJWE), WithExpiry(time.Minute), fixedClock(expiryEpoch))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if _, err = Decrypt[string](jweTestKey, enc, WithEncoding(EncodingJWE), fixedClock(expiryEpoch)); err != nil {
+		t.Errorf("Decrypt() before expiry error = %v", err)
+	}
+	_, err = Decrypt[string](jweTestKey, enc, WithEncoding(EncodingJWE), fixedClock(expiryEpoch.Add(time.Hour)))
+	var expired *ExpiredError
+	if !errors.As(err, &expired) {
+		t.Errorf("error = %v, want *ExpiredError", err)
+	}
+}
+
+func TestInnerPayload_Tag(t *testing.T) {
+	// An unstamped tag keeps the original layout so existing ciphertext and
+	// new unstamped ciphertext are indistinguishable.
+	if got := encodeInnerPayload(innerTag{kind: "string"}, "6869"); got != "string:6869" {
+		t.Errorf("encodeInnerPayload() = %q, want %q", got, "string:6869")
+	}
+
+	stamped := innerTag{kind: "int64", issuedAt: time.Unix(100, 0), expiresAt: time.Unix(160, 0)}
+	encoded := encodeInnerPayload(stamped, "00")
+	if encoded != "int64;iat=100;exp=160:00" {
+		t.Errorf("encodeInnerPayload() = %q", encoded)
+	}
+	tag, payload, err := decodeInnerPayload(encoded)
+	if err != nil {
+		t.Fatalf("decodeInnerPayload() error = %v", err)
+	}
+	if tag.kind != "int64" || !tag.issuedAt.Equal(stamped.issuedAt) || !tag.expiresAt.Equal(stamped.expiresAt) || payload != "00" {
+		t.Errorf("decodeInnerPayload() = %+v, %q", tag, payload)
+	}
+
+	for _, malformed := range []string{"string;iat:00", "string;iat=x:00", "string;foo=1:00", "string"} {
+		if _, _, err = decodeInnerPayload(malformed); err == nil {
+			t.Errorf("decodeInnerPayload(%q) expected error", malformed)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package transcrypt
+
+// This file holds the Fernet encoding of single values, selected with
+// WithEncoding(EncodingFernet). A Fernet token is the URL-safe base64 (with
+// padding) of:
+//
+//	offset 0:  version 0x80 (1 byte)
+//	offset 1:  timestamp, seconds since the Unix epoch (8 bytes, big endian)
+//	offset 9:  AES-CBC IV (16 bytes)
+//	offset 25: AES-128-CBC ciphertext of the PKCS#7-padded plaintext
+//	end - 32:  HMAC-SHA256 over all preceding bytes
+//
+// Fernet fixes its own cryptography, so it differs from the transcrypt format
+// in three ways callers must be aware of:
+//
+//   - the key is the raw 32-byte Fernet key (the base64url-decoded form of a
+//     key from Python's Fernet.generate_key()) and is used directly, without
+//     HKDF: the first half signs, the second half encrypts;
+//   - the CipherSuite argument is not used;
+//   - the token carries raw bytes and no type tag, so only string and []byte
+//     values can be encoded. A decrypted token yields a []byte (see rawBytes),
+//     which any string-kind or []byte target accepts.
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+const (
+	fernetVersion   byte = 0x80
+	fernetKeyLength      = 32
+	// fernetOverhead is the fixed part of a decoded token: version, timestamp,
+	// IV and HMAC. The ciphertext adds at least one AES block.
+	fernetOverhead = 1 + 8 + aes.BlockSize + sha256.Size
+)
+
+// fernetPlaintext extracts the raw bytes a Fernet token can carry: the
+// content of a string-kind value or of a []byte.
+func fernetPlaintext(d any) ([]byte, error) {
+	v := reflect.ValueOf(d)
+	switch {
+	case v.Kind() == reflect.String:
+		return []byte(v.String()), nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return v.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("%w: fernet tokens carry raw bytes: cannot encode %T, only string and []byte values", ErrUnsupportedType, d)
+	}
+}
+
+// encryptFernet encodes d into a Fernet token stamped with the current time
+// of the configured clock. The format has no room for an expiry.
+func encryptFernet(key []byte, d any, o *options) (string, error) {
+	if o.expiry > 0 {
+		return "", errors.New("fernet tokens cannot carry an expiry: use WithMaxAge on decryption instead")
+	}
+	plaintext, err := fernetPlaintext(d)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err = io.ReadFull(o.rand(), iv); err != nil {
+		return "", fmt.Errorf("failed to read random data for iv: %w", err)
+	}
+	return encodeFernet(key, plaintext, iv, o.clock())
+}
+
+// encodeFernet builds a Fernet token from its parts. It is split from
+// encryptFernet so the IV and timestamp can be pinned against the
+// specification's test vectors.
+func encodeFernet(key, plaintext, iv []byte, now time.Time) (string, error) {
+	if len(key) != fernetKeyLength {
+		return "", fmt.Errorf("fernet key must be %d bytes, got %d", fernetKeyLength, len(key))
+	}
+
+	block, err := aes.NewCipher(key[16:])
+	if err != nil {
+		return "", err
+	}
+
+	padLength := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(bytes.Clone(plaintext), bytes.Repeat([]byte{byte(padLength)}, padLength)...)
+
+	token := make([]byte, 0, fernetOverhead+len(padded))
+	token = append(token, fernetVersion)
+	token = binary.BigEndian.AppendUint64(token, uint64(now.Unix()))
+	token = append(token, iv...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	token = append(token, ciphertext...)
+
+	mac := hmac.New(sha256.New, key[:16])
+	mac.Write(token)
+	token = mac.Sum(token)
+
+	return base64.URLEncoding.EncodeToString(token), nil
+}
+
+// decryptFernet verifies and decrypts a Fernet token. When o carries a max
+// age, the token's timestamp must lie within it (and not more than
+// maxClockSkew in the future). The signature is verified before the
+// timestamp is looked at, so an unauthenticated timestamp never influences
+// the outcome.
+func decryptFernet(key []byte, token string, o *options) (rawBytes, error) {
+	if len(key) != fernetKeyLength {
+		return nil, fmt.Errorf("fernet key must be %d bytes, got %d", fernetKeyLength, len(key))
+	}
+
+	data, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: value is not a valid fernet token: %w", ErrMalformed, err)
+	}
+	if len(data) < fernetOverhead+aes.BlockSize || (len(data)-fernetOverhead)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: value is not a valid fernet token: invalid length", ErrMalformed)
+	}
+	if data[0] != fernetVersion {
+		return nil, fmt.Errorf("%w: unsupported fernet version 0x%02x", ErrMalformed, data[0])
+	}
+
+	signed, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	mac := hmac.New(sha256.New, key[:16])
+	mac.Write(signed)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return nil, fmt.Errorf("decrypt failed: %w: fernet signature mismatch", ErrAuthentication)
+	}
+
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(data[1:9])), 0)
+	if err = o.checkValidity(issuedAt, time.Time{}); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key[16:])
+	if err != nil {
+		return nil, err
+	}
+	iv := signed[9 : 9+aes.BlockSize]
+	plaintext := make([]byte, len(signed)-9-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, signed[9+aes.BlockSize:])
+
+	// The padding is covered by the HMAC, so a malformed one means a buggy
+	// producer rather than tampering; it is still checked in constant time.
+	padLength := int(plaintext[len(plaintext)-1])
+	if padLength == 0 || padLength > aes.BlockSize {
+		return nil, fmt.Errorf("%w: invalid fernet padding", ErrMalformed)
+	}
+	if subtle.ConstantTimeCompare(plaintext[len(plaintext)-padLength:], bytes.Repeat([]byte{byte(padLength)}, padLength)) != 1 {
+		return nil, fmt.Errorf("%w: invalid fernet padding", ErrMalformed)
+	}
+	return rawBytes(plaintext[:len(plaintext)-padLength]), nil
+}
@@ -0,0 +1,199 @@
+package transcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fernetSpec holds the vector from the Fernet specification's generate.json
+// and verify.json (https://github.com/fernet/spec): the token below is what
+// any conforming implementation produces for these inputs, so matching it is
+// what makes tokens exchangeable with other stacks.
+var fernetSpec = struct {
+	token  string
+	now    time.Time
+	iv     []byte
+	src    string
+	secret string
+}{
+	token:  "gAAAAAAdwJ6wAAECAwQFBgcICQoLDA0ODy021cpGVWKZ_eEwCGM4BLLF_5CV9dOPmrhuVUPgJobwOz7JcbmrR64jVmpU4IwqDA==",
+	now:    time.Date(1985, 10, 26, 1, 20, 0, 0, time.FixedZone("", -7*60*60)),
+	iv:     []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	src:    "hello",
+	secret: "cw_0x689RpI-jtRR7oE8h_eQsKImvJapLeSbXpwF4e4=",
+}
+
+func fernetSpecKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := base64.URLEncoding.DecodeString(fernetSpec.secret)
+	if err != nil {
+		t.Fatalf("cannot decode spec secret: %v", err)
+	}
+	return key
+}
+
+func fixedClock(t time.Time) Option {
+	return WithClock(func() time.Time { return t })
+}
+
+func TestFernet_SpecGenerate(t *testing.T) {
+	got, err := encodeFernet(fernetSpecKey(t), []byte(fernetSpec.src), fernetSpec.iv, fernetSpec.now)
+	if err != nil {
+		t.Fatalf("encodeFernet() error = %v", err)
+	}
+	if got != fernetSpec.token {
+		t.Errorf("encodeFernet() = %s, want %s", got, fernetSpec.token)
+	}
+}
+
+func TestFernet_SpecVerify(t *testing.T) {
+	got, err := Decrypt[string](fernetSpecKey(t), fernetSpec.token,
+		WithEncoding(EncodingFernet), WithMaxAge(60*time.Second), fixedClock(fernetSpec.now))
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if got != fernetSpec.src {
+		t.Errorf("Decrypt() = %q, want %q", got, fernetSpec.src)
+	}
+}
+
+func TestFernet_RoundTrip(t *testing.T) {
+	key := fernetSpecKey(t)
+	for _, in := range []any{"hello fernet", "", []byte{0xde, 0xad, 0xbe, 0xef}, strings.Repeat("x", 16)} {
+		token, err := Encrypt[string](key, AES_256_GCM, in, WithEncoding(EncodingFernet))
+		if err != nil {
+			t.Fatalf("Encrypt(%v) error = %v", in, err)
+		}
+		if !strings.HasPrefix(token, "gAAAAA") {
+			t.Errorf("token %q does not carry the Fernet version prefix", token)
+		}
+		got, err := Decrypt[[]byte](key, token, WithEncoding(EncodingFernet))
+		if err != nil {
+			t.Fatalf("Decrypt(%v) error = %v", in, err)
+		}
+		var want []byte
+		switch v := in.(type) {
+		case string:
+			want = []byte(v)
+		case []byte:
+			want = v
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("round trip = %x, want %x", got, want)
+		}
+	}
+}
+
+func TestFernet_DecryptAnyYieldsBytes(t *testing.T) {
+	got, err := Decrypt[any](fernetSpecKey(t), fernetSpec.token, WithEncoding(EncodingFernet))
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	b, ok := got.([]byte)
+	if !ok {
+		t.Fatalf("Decrypt[any]() returned %T, want []byte", got)
+	}
+	if string(b) != fernetSpec.src {
+		t.Errorf("Decrypt[any]() = %q, want %q", b, fernetSpec.src)
+	}
+	if _, err = Decrypt[int](fernetSpecKey(t), fernetSpec.token, WithEncoding(EncodingFernet)); err == nil {
+		t.Error("Decrypt[int]() of an untyped token expected error, got nil")
+	}
+}
+
+func TestFernet_TTL(t *testing.T) {
+	key := fernetSpecKey(t)
+	decrypt := func(now time.Time) error {
+		_, err := Decrypt[string](key, fernetSpec.token,
+			WithEncoding(EncodingFernet), WithMaxAge(60*time.Second), fixedClock(now))
+		return err
+	}
+
+	if err := decrypt(fernetSpec.now.Add(59 * time.Second)); err != nil {
+		t.Errorf("token within TTL rejected: %v", err)
+	}
+	var expired *ExpiredError
+	if err := decrypt(fernetSpec.now.Add(61 * time.Second)); !errors.As(err, &expired) {
+		t.Errorf("expired token: error = %v, want *ExpiredError", err)
+	}
+	if err := decrypt(fernetSpec.now.Add(-2 * maxClockSkew)); err == nil {
+		t.Error("token from the far future accepted")
+	}
+	// Without a max age the timestamp is not checked at all.
+	if _, err := Decrypt[string](key, fernetSpec.token, WithEncoding(EncodingFernet)); err != nil {
+		t.Errorf("Decrypt() without max age error = %v", err)
+	}
+}
+
+func TestFernet_Invalid(t *testing.T) {
+	key := fernetSpecKey(t)
+	tampered := []byte(fernetSpec.token)
+	tampered[40] ^= 1
+
+	tests := []struct {
+		name  string
+		key   []byte
+		token string
+	}{
+		{"wrong_key", bytes.Repeat([]byte{1}, 32), fernetSpec.token},
+		{"short_key", key[:16], fernetSpec.token},
+		{"tampered", key, string(tampered)},
+		{"truncated", key, fernetSpec.token[:40]},
+		{"not_base64", key, "gAAAAA!!"},
+		{"transcrypt_format", key, "00:" + strings.Repeat("00", 32) + ":00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt[string](tt.key, tt.token, WithEncoding(EncodingFernet)); err == nil {
+				t.Error("Decrypt() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestFernet_EncryptRejects(t *testing.T) {
+	key := fernetSpecKey(t)
+	if _, err := Encrypt[string](key, AES_256_GCM, 42, WithEncoding(EncodingFernet)); err == nil {
+		t.Error("Encrypt(int) expected error: Fernet carries no type tag")
+	}
+	if _, err := Encrypt[string](testKey, AES_256_GCM, "x", WithEncoding(EncodingFernet)); err == nil {
+		t.Error("Encrypt() with a non-32-byte key expected error")
+	}
+	if _, err := Encrypt[string](key, AES_256_GCM, "x", WithEncoding(Encoding(99))); err == nil {
+		t.Error("Encrypt() with an unknown encoding expected error")
+	}
+	if _, err := Encrypt[string](key, AES_256_GCM, "x", WithEncoding(EncodingFernet), WithExpiry(time.Hour)); err == nil {
+		t.Error("Encrypt() with an expiry expected error: Fernet has no expiry field")
+	}
+	if _, err := Encrypt[File](key, AES_256_GCM, File{Source: "unused"}, WithEncoding(EncodingFernet)); err == nil {
+		t.Error("Encrypt[File]() with Fernet encoding expected error")
+	}
+}
+
+func TestFernet_StructLeaves(t *testing.T) {
+	type P struct {
+		Name string
+		Blob []byte
+	}
+	type E struct {
+		Name Ciphertext
+		Blob Ciphertext
+	}
+	key := fernetSpecKey(t)
+	in := P{Name: "alice", Blob: []byte{1, 2, 3}}
+	enc, err := Encrypt[E](key, AES_256_GCM, in, WithEncoding(EncodingFernet))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	out, err := Decrypt[P](key, enc, WithEncoding(EncodingFernet))
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if out.Name != in.Name || !bytes.Equal(out.Blob, in.Blob) {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+}
@@ -0,0 +1,122 @@
+package transcrypt
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// This file holds the runtime half of the code emitted by cmd/transcrypt-gen.
+// Generated EncryptX/DecryptX functions resolve a FieldCodec once, walk a
+// struct with ordinary field accesses and hand every leaf to it, which runs
+// the same scalar path as the reflection walker, so generated code and
+// Encrypt[E] produce the same ciphertexts and the same errors.
+
+// FieldCodec encrypts and decrypts single struct fields with an Encryptor's
+// options and key, resolved once like Encrypt resolves them per call: the
+// options are validated and, under WithTenant, the tenant key derived. It is
+// meant for generated code; use Encryptor.FieldCodec to get one.
+type FieldCodec struct {
+	o   *options
+	key []byte
+}
+
+// FieldCodec returns a FieldCodec for a single encryption or decryption with
+// e's key and options. Options that cannot be used report an error here, as
+// they do from Encrypt.
+func (e *Encryptor) FieldCodec() (*FieldCodec, error) {
+	o := e.options()
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	key, err := o.callKey(e.key)
+	if err != nil {
+		return nil, err
+	}
+	return &FieldCodec{o: o, key: key}, nil
+}
+
+// Encrypt encrypts v, the value of a single struct field, into a Ciphertext,
+// exactly as Encrypt does for a plain field whose mirror is typed
+// Ciphertext, including leaving a value without one empty (see
+// WithZeroAsEmpty). PrefixPath turns its errors into the *FieldError Encrypt
+// would report.
+func (c *FieldCodec) Encrypt(v any) (Ciphertext, error) {
+	d, err := plainLeaf(reflect.ValueOf(v), c.o)
+	if err != nil {
+		return "", fmt.Errorf("encrypt failed: %w", err)
+	}
+	if d == nil {
+		return "", nil
+	}
+	encrypted, err := encryptScalar(c.key, c.o.cipherSuite, d, c.o)
+	if err != nil {
+		return "", fmt.Errorf("encrypt failed: %w", err)
+	}
+	return Ciphertext(encrypted), nil
+}
+
+// DecryptFieldWith decrypts a single Ciphertext field into the plain field
+// type T, exactly as Decrypt does for a mirror field typed Ciphertext: the
+// kind stored inside the ciphertext must fit T.
+func DecryptFieldWith[T any](c *FieldCodec, ct Ciphertext) (T, error) {
+	var zero T
+	target := reflect.TypeFor[T]()
+	if ct == "" && emptyLeaf(target, c.o) {
+		return zero, nil
+	}
+	decrypted, err := decryptScalar(c.key, string(ct), c.o)
+	if err != nil {
+		return zero, fmt.Errorf("decrypt failed: %w", err)
+	}
+	// The common case of an exact type match needs no reflection. Interface
+	// targets go through fitLeaf like they do in the walker.
+	if v, ok := decrypted.(T); ok && target.Kind() != reflect.Interface {
+		return v, nil
+	}
+	out, err := fitLeaf(decrypted, target)
+	if err != nil {
+		return zero, err
+	}
+	return out.Interface().(T), nil
+}
+
+// EncryptField encrypts v, the value of a single struct field, with e's key
+// and options; see FieldCodec.Encrypt. It resolves the options and key on
+// every call, so code encrypting many fields should use a FieldCodec.
+func (e *Encryptor) EncryptField(v any) (Ciphertext, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		return "", fmt.Errorf("encrypt failed: %w", err)
+	}
+	return c.Encrypt(v)
+}
+
+// DecryptField decrypts a single Ciphertext field into the plain field type T
+// with e's key and options; see DecryptFieldWith. Like EncryptField, it
+// resolves the options and key on every call.
+func DecryptField[T any](e *Encryptor, ct Ciphertext) (T, error) {
+	c, err := e.FieldCodec()
+	if err != nil {
+		var zero T
+		return zero, fmt.Errorf("decrypt failed: %w", err)
+	}
+	return DecryptFieldWith[T](c, ct)
+}
+
+// PrefixPath locates err at the field path formed by elems, in the notation of
+// FieldError, e.g. PrefixPath(err, "Inners", "[2]"). If err already is a
+// *FieldError, elems are prepended to its path, so nested calls build the
+// same path the reflection walker reports. It returns nil for a nil err.
+func PrefixPath(err error, elems ...string) error {
+	if err == nil {
+		return nil
+	}
+	var path string
+	for _, elem := range elems {
+		path = joinPath(path, elem)
+	}
+	if fieldErr, ok := err.(*FieldError); ok {
+		return &FieldError{Path: joinPath(path, fieldErr.Path), Err: fieldErr.Err}
+	}
+	return pathErrorf(path, "%w", err)
+}
@@ -0,0 +1,100 @@
+package transcrypt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncryptField_DecryptField(t *testing.T) {
+	e, err := NewEncryptor(testKey)
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	type level int
+	c, err := e.EncryptField(level(3))
+	if err != nil {
+		t.Fatalf("EncryptField() error = %v", err)
+	}
+	// Named types convert like they do in the walker.
+	if got, err := DecryptField[level](e, c); err != nil || got != 3 {
+		t.Errorf("DecryptField[level]() = %v, %v; want 3", got, err)
+	}
+	if got, err := DecryptField[int](e, c); err != nil || got != 3 {
+		t.Errorf("DecryptField[int]() = %v, %v; want 3", got, err)
+	}
+	if _, err = DecryptField[string](e, c); !errors.Is(err, ErrKindMismatch) {
+		t.Errorf("DecryptField[string]() error = %v, want ErrKindMismatch", err)
+	}
+	if _, err = DecryptField[int](e, "garbage"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("DecryptField() of garbage error = %v, want ErrMalformed", err)
+	}
+	if _, err = e.EncryptField(struct{}{}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("EncryptField() of a struct error = %v, want ErrUnsupportedType", err)
+	}
+}
+
+func TestFieldCodec(t *testing.T) {
+	e, err := NewEncryptor(testKey, WithTenant("acme"))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	c, err := e.FieldCodec()
+	if err != nil {
+		t.Fatalf("FieldCodec() error = %v", err)
+	}
+	encrypted, err := c.Encrypt("v")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	// The codec holds the derived tenant key, so the Encryptor decrypts it.
+	if got, err := DecryptField[string](e, encrypted); err != nil || got != "v" {
+		t.Errorf("DecryptField() = %q, %v; want v", got, err)
+	}
+	if got, err := DecryptFieldWith[string](c, encrypted); err != nil || got != "v" {
+		t.Errorf("DecryptFieldWith() = %q, %v; want v", got, err)
+	}
+
+	// Options are validated like Encrypt validates them, even on an
+	// Encryptor NewEncryptor would have refused.
+	invalid := &Encryptor{key: testKey, opts: []Option{WithMaxAge(-time.Second)}}
+	if _, err = invalid.FieldCodec(); err == nil {
+		t.Error("FieldCodec() with a negative max age error = nil")
+	}
+	if _, err = invalid.EncryptField("v"); err == nil {
+		t.Error("EncryptField() with a negative max age error = nil")
+	}
+	if _, err = DecryptField[string](invalid, encrypted); err == nil {
+		t.Error("DecryptField() with a negative max age error = nil")
+	}
+}
+
+func TestPrefixPath(t *testing.T) {
+	nested := &FieldError{Path: "Note", Err: ErrMalformed}
+	tests := []struct {
+		name  string
+		err   error
+		elems []string
+		want  string
+	}{
+		{"plain", ErrMalformed, []string{"Name"}, "Name"},
+		{"nested", nested, []string{"Inners", "[2]"}, "Inners[2].Note"},
+		{"index_first", &FieldError{Path: "[1]", Err: ErrMalformed}, []string{"Tags"}, "Tags[1]"},
+		{"no_elems", nested, nil, "Note"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PrefixPath(tt.err, tt.elems...)
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Path != tt.want {
+				t.Errorf("PrefixPath() = %v, want a FieldError at %q", err, tt.want)
+			}
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("PrefixPath() = %v, want it to wrap ErrMalformed", err)
+			}
+		})
+	}
+	if PrefixPath(nil, "Name") != nil {
+		t.Error("PrefixPath(nil) != nil")
+	}
+}
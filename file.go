@@ -11,7 +11,20 @@ package transcrypt
 //	offset 4:  format version (1 byte)
 //	offset 5:  cipher suite (1 byte, the CipherSuite enum)
 //	offset 6:  HKDF salt (saltLength bytes)
-//	offset 38: raw DARE ciphertext stream produced by sio
+//	offset 38: version 3: flags (1 byte, see fileFlagCommitment)
+//	then:      versions 2 and 3: key commitment (commitmentLength bytes)
+//	then:      version 3: key ID (fingerprintLength bytes)
+//	then:      raw DARE ciphertext stream produced by sio
+//
+// Version 1 files carry neither optional field and version 2 files a key
+// commitment. Version 3 files announce the fields they carry in the flags
+// byte, so later optional fields need no new version; it is written when
+// encrypting WithKeyID, while files with just a key commitment keep version 2
+// so older releases can read them. Only files carrying a commitment are
+// accepted when decrypting WithKeyCommitment.
+//
+// The plaintext stream starts with a sentinel byte (see filePlaintextSentinel)
+// and, when padded, a length prefix (see filePaddedSentinel).
 //
 // Everything after the header is protected exactly like the string format:
 // tampering the cipher-suite or salt bytes changes the derived key and fails
@@ -25,9 +38,11 @@ package transcrypt
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -55,8 +70,32 @@ var fileMagic = [4]byte{'T', 'C', 'R', 'F'}
 // in the header so the layout can evolve without breaking old files.
 const fileFormatVersion byte = 1
 
-// fileHeaderLength is the size of the plaintext file header: magic, version,
-// cipher suite, then the HKDF salt. The DARE stream starts right after.
+// fileFormatVersionCommitted is the format version whose header additionally
+// carries a key commitment after the salt.
+const fileFormatVersionCommitted byte = 2
+
+// fileFormatVersionFlags is the format version whose header carries a flags
+// byte after the salt, followed by the optional fields it announces.
+const fileFormatVersionFlags byte = 3
+
+// The flags of a version 3 header. Unknown flags are rejected, as the fields
+// they announce could not be skipped.
+const (
+	// fileFlagCommitment announces a key commitment.
+	fileFlagCommitment byte = 1 << iota
+	// fileFlagKeyID announces a key ID, after the commitment if both are
+	// present.
+	fileFlagKeyID
+
+	fileFlagsKnown = fileFlagCommitment | fileFlagKeyID
+)
+
+// fileVersionOffset is the offset of the format version in the file header.
+const fileVersionOffset = int64(len(fileMagic))
+
+// fileHeaderLength is the size of the version 1 plaintext file header: magic,
+// version, cipher suite, then the HKDF salt. The DARE stream starts right
+// after. Later versions append the flags byte and the optional fields.
 const fileHeaderLength = len(fileMagic) + 1 + 1 + saltLength
 
 // fileHKDFInfo is the HKDF info parameter for file keys. The encoded-string
@@ -73,6 +112,35 @@ var fileHKDFInfo = []byte("transcrypt/file")
 // content without any authentication failure.
 const filePlaintextSentinel byte = 0x01
 
+// filePaddedSentinel replaces filePlaintextSentinel when the file is padded
+// (see WithPadding). The sentinel is authenticated, so it doubles as the flag
+// selecting the padded plaintext layout:
+//
+//	sentinel 0x02 (1 byte) | content length (8 bytes, big endian) | content |
+//	zero padding
+//
+// The length prefix lets decryption stop writing at the end of the content
+// without buffering, while still reading (and so authenticating) the padding.
+const filePaddedSentinel byte = 0x02
+
+// filePaddedPrefixLength is the size of the padded layout's sentinel and
+// length prefix.
+const filePaddedPrefixLength = 1 + 8
+
+// checkFileOptions rejects options the file format cannot honor. Encodings
+// other than the default are single-value string formats with no streaming
+// counterpart, and the file header carries no timestamp; silently ignoring
+// either would surprise the caller.
+func (o *options) checkFileOptions() error {
+	if o.encoding != EncodingTranscrypt {
+		return fmt.Errorf("encoding %s does not apply to files", o.encoding)
+	}
+	if o.issuedAt || o.maxAge > 0 {
+		return errors.New("timestamps and max age do not apply to files")
+	}
+	return nil
+}
+
 // resolve validates the paths and applies the in-place default.
 func (f File) resolve() (File, error) {
 	if f.Source == "" {
@@ -87,12 +155,15 @@ func (f File) resolve() (File, error) {
 // encryptFile streams the file at f.Source into an encrypted file at f.Target.
 // It enforces the same key floor as encryptScalar and returns the File with
 // its resolved Target.
-func encryptFile(key []byte, cipherSuite CipherSuite, f File) (File, error) {
+func encryptFile(key []byte, cipherSuite CipherSuite, f File, o *options) (File, error) {
 	if len(key) < minKeyLength {
 		return File{}, fmt.Errorf("key must be at least %d bytes", minKeyLength)
 	}
 	if !cipherSuite.isValid() {
-		return File{}, fmt.Errorf("unknown cipher suite: %d", cipherSuite)
+		return File{}, fmt.Errorf("%w: %d", ErrUnknownCipherSuite, cipherSuite)
+	}
+	if err := o.checkFileOptions(); err != nil {
+		return File{}, err
 	}
 
 	f, err := f.resolve()
@@ -104,24 +175,46 @@ func encryptFile(key []byte, cipherSuite CipherSuite, f File) (File, error) {
 		// A nil salt makes createCryptoConfig generate a fresh random one per
 		// call; it is stored in the header so decryption can re-derive the key
 		// and nonce from it.
-		cryptoConfig, salt, err := createCryptoConfig(key, []byte{byte(cipherSuite)}, nil, fileHKDFInfo)
+		cryptoConfig, salt, commitment, err := createCryptoConfig(o.rand(), key, []byte{byte(cipherSuite)}, nil, fileHKDFInfo, nil)
 		if err != nil {
 			return err
 		}
 
-		header := make([]byte, 0, fileHeaderLength)
+		version := fileFormatVersion
+		var flags byte
+		if o.keyCommitment {
+			version = fileFormatVersionCommitted
+			flags |= fileFlagCommitment
+		}
+		if o.keyID {
+			version = fileFormatVersionFlags
+			flags |= fileFlagKeyID
+		}
+		header := make([]byte, 0, fileHeaderLength+1+commitmentLength+fingerprintLength)
 		header = append(header, fileMagic[:]...)
-		header = append(header, fileFormatVersion, byte(cipherSuite))
+		header = append(header, version, byte(cipherSuite))
 		header = append(header, salt...)
+		if version == fileFormatVersionFlags {
+			header = append(header, flags)
+		}
+		if o.keyCommitment {
+			header = append(header, commitment...)
+		}
+		if o.keyID {
+			header = append(header, fingerprintBytes(key)...)
+		}
 		if _, err = dst.Write(header); err != nil {
 			return fmt.Errorf("cannot write file header: %w", err)
 		}
 
-		plaintext := io.MultiReader(bytes.NewReader([]byte{filePlaintextSentinel}), src)
-		if _, err = sio.Encrypt(dst, plaintext, cryptoConfig); err != nil {
-			return fmt.Errorf("encrypt failed: %w", err)
+		if o.padding.scheme == paddingNone {
+			plaintext := io.MultiReader(bytes.NewReader([]byte{filePlaintextSentinel}), src)
+			if _, err = sio.Encrypt(dst, plaintext, cryptoConfig); err != nil {
+				return fmt.Errorf("encrypt failed: %w", err)
+			}
+			return nil
 		}
-		return nil
+		return encryptPaddedFile(dst, src, cryptoConfig, o.padding)
 	})
 	if err != nil {
 		return File{}, err
@@ -135,10 +228,13 @@ func encryptFile(key []byte, cipherSuite CipherSuite, f File) (File, error) {
 // authenticates the final DARE package only at end of stream, so success is
 // known only once the whole file has been processed — which is why the result
 // reaches Target exclusively via transformFile's rename-on-success.
-func decryptFile(key []byte, f File) (File, error) {
+func decryptFile(key []byte, f File, o *options) (File, error) {
 	if len(key) == 0 {
 		return File{}, errors.New("key is empty")
 	}
+	if err := o.checkFileOptions(); err != nil {
+		return File{}, err
+	}
 
 	f, err := f.resolve()
 	if err != nil {
@@ -146,48 +242,253 @@ func decryptFile(key []byte, f File) (File, error) {
 	}
 
 	err = transformFile(f, func(src, dst *os.File) error {
-		var header [fileHeaderLength]byte
-		if _, err := io.ReadFull(src, header[:]); err != nil {
-			return fmt.Errorf("cannot read file header: %w", err)
-		}
-		if !bytes.Equal(header[:len(fileMagic)], fileMagic[:]) {
-			return errors.New("not a transcrypt-encrypted file")
+		_, err := decryptFileStream(key, src, dst, o)
+		return err
+	})
+	if err != nil {
+		return File{}, err
+	}
+	return f, nil
+}
+
+// decryptFileStream reads an encrypted file from src, header first, and
+// writes the decrypted content to dst. On failure it also returns the offset
+// in src of the failing part: the header field at fault, or the start of the
+// DARE package that did not authenticate. Non-final packages always hold
+// exactly dareMaxPayloadLength bytes (sio rejects anything else), so the
+// package follows from the amount of plaintext read before the failure.
+func decryptFileStream(key []byte, src io.Reader, dst io.Writer, o *options) (int64, error) {
+	header, err := readFileHeader(src)
+	if err != nil {
+		return 0, err
+	}
+	if header.commitment == nil && o.keyCommitment {
+		return fileVersionOffset, fmt.Errorf("%w: file carries no key commitment", ErrAuthentication)
+	}
+	if err = checkKeyID(key, header.keyID); err != nil {
+		return header.length() - fingerprintLength, err
+	}
+
+	// A committed header is verified here, so a wrong key fails before
+	// any of the (possibly large) ciphertext is streamed.
+	cryptoConfig, _, _, err := createCryptoConfig(nil, key, []byte{byte(header.cipherSuite)}, header.salt, fileHKDFInfo, header.commitment)
+	if err != nil {
+		return header.fieldsOffset(), err
+	}
+
+	decrypted, err := sio.DecryptReader(src, cryptoConfig)
+	if err != nil {
+		return header.length(), fmt.Errorf("decrypt failed: %w", err)
+	}
+	counted := &countingReader{r: decrypted}
+	failedAt := func() int64 {
+		return header.length() + counted.n/dareMaxPayloadLength*darePackageLength
+	}
+	plaintext := authReader{counted}
+	// The sentinel doubles as the emptiness guard: an empty ciphertext
+	// stream yields no plaintext at all, so a file truncated to its header
+	// fails here instead of decrypting to an empty file.
+	var sentinel [1]byte
+	if _, err = io.ReadFull(plaintext, sentinel[:]); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("%w: %w", ErrAuthentication, err)
 		}
-		if header[4] != fileFormatVersion {
-			return fmt.Errorf("unsupported file format version %d", header[4])
+		return failedAt(), fmt.Errorf("decrypt failed: %w", err)
+	}
+	switch sentinel[0] {
+	case filePlaintextSentinel:
+		if _, err = io.Copy(dst, plaintext); err != nil {
+			return failedAt(), fmt.Errorf("decrypt failed: %w", err)
 		}
-		if !CipherSuite(header[5]).isValid() {
-			return fmt.Errorf("unknown cipher suite: %d", header[5])
+		return 0, nil
+	case filePaddedSentinel:
+		if err = decryptPaddedFile(dst, plaintext); err != nil {
+			return failedAt(), err
 		}
+		return 0, nil
+	default:
+		return failedAt(), fmt.Errorf("%w: invalid plaintext sentinel", ErrMalformed)
+	}
+}
 
-		cryptoConfig, _, err := createCryptoConfig(key, []byte{header[5]}, header[6:], fileHKDFInfo)
-		if err != nil {
-			return err
-		}
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
 
-		plaintext, err := sio.DecryptReader(src, cryptoConfig)
-		if err != nil {
-			return fmt.Errorf("decrypt failed: %w", err)
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// fileHeader holds the fields of an encrypted file's plaintext header.
+// commitment and keyID are nil in headers without them.
+type fileHeader struct {
+	version     byte
+	cipherSuite CipherSuite
+	salt        []byte
+	commitment  []byte
+	keyID       []byte
+}
+
+// fieldsOffset returns the offset of the first optional field, after the
+// flags byte of a version 3 header.
+func (h fileHeader) fieldsOffset() int64 {
+	if h.version == fileFormatVersionFlags {
+		return int64(fileHeaderLength) + 1
+	}
+	return int64(fileHeaderLength)
+}
+
+// length returns the size of the header on disk; the DARE stream starts
+// right after it.
+func (h fileHeader) length() int64 {
+	return h.fieldsOffset() + int64(len(h.commitment)+len(h.keyID))
+}
+
+// readFileHeader reads and validates the plaintext header at the start of an
+// encrypted file, leaving r positioned at the start of the DARE stream. It
+// needs no key, so it also backs InspectFile.
+func readFileHeader(r io.Reader) (fileHeader, error) {
+	var raw [fileHeaderLength]byte
+	n, err := io.ReadFull(r, raw[:])
+	// A file too short to hold the magic cannot be a transcrypt file at all;
+	// one that holds it but not the rest is truncated.
+	if n < len(fileMagic) || !bytes.Equal(raw[:len(fileMagic)], fileMagic[:]) {
+		return fileHeader{}, ErrNotTranscryptFile
+	}
+	if err != nil {
+		return fileHeader{}, fmt.Errorf("%w: cannot read file header: %w", ErrMalformed, err)
+	}
+
+	h := fileHeader{version: raw[4], cipherSuite: CipherSuite(raw[5]), salt: raw[6:]}
+	switch h.version {
+	case fileFormatVersion:
+	case fileFormatVersionCommitted:
+		h.commitment = make([]byte, commitmentLength)
+	case fileFormatVersionFlags:
+		var flags [1]byte
+		if _, err = io.ReadFull(r, flags[:]); err != nil {
+			return fileHeader{}, fmt.Errorf("%w: cannot read file header: %w", ErrMalformed, err)
 		}
-		// The sentinel doubles as the emptiness guard: an empty ciphertext
-		// stream yields no plaintext at all, so a file truncated to its header
-		// fails here instead of decrypting to an empty file.
-		var sentinel [1]byte
-		if _, err = io.ReadFull(plaintext, sentinel[:]); err != nil {
-			return fmt.Errorf("decrypt failed: %w", err)
+		if flags[0]&^fileFlagsKnown != 0 {
+			return fileHeader{}, fmt.Errorf("%w: unsupported file header flags %#02x", ErrMalformed, flags[0])
 		}
-		if sentinel[0] != filePlaintextSentinel {
-			return errors.New("decrypt failed: invalid plaintext sentinel")
+		if flags[0]&fileFlagCommitment != 0 {
+			h.commitment = make([]byte, commitmentLength)
 		}
-		if _, err = io.Copy(dst, plaintext); err != nil {
-			return fmt.Errorf("decrypt failed: %w", err)
+		if flags[0]&fileFlagKeyID != 0 {
+			h.keyID = make([]byte, fingerprintLength)
 		}
-		return nil
-	})
+	default:
+		return fileHeader{}, fmt.Errorf("%w: unsupported file format version %d", ErrMalformed, h.version)
+	}
+	for _, field := range [][]byte{h.commitment, h.keyID} {
+		if _, err = io.ReadFull(r, field); err != nil {
+			return fileHeader{}, fmt.Errorf("%w: cannot read file header: %w", ErrMalformed, err)
+		}
+	}
+	if !h.cipherSuite.isValid() {
+		return fileHeader{}, fmt.Errorf("%w: %d", ErrUnknownCipherSuite, raw[5])
+	}
+	return h, nil
+}
+
+// encryptPaddedFile encrypts src in the padded plaintext layout (see
+// filePaddedSentinel). The content length is taken from src's size up front,
+// so a source that changes size while being read fails the encryption rather
+// than producing a file whose content disagrees with its length prefix.
+func encryptPaddedFile(dst io.Writer, src *os.File, cryptoConfig sio.Config, padding Padding) error {
+	info, err := src.Stat()
 	if err != nil {
-		return File{}, err
+		return fmt.Errorf("cannot stat source file: %w", err)
 	}
-	return f, nil
+	size := info.Size()
+	// The padded size is known up front, so a size that cannot be padded
+	// fails before anything is written.
+	padded, err := padding.size(filePaddedPrefixLength + size)
+	if err != nil {
+		return fmt.Errorf("encrypt failed: %w", err)
+	}
+
+	// Hide dst's Close from sio: closing the encrypting writer would close the
+	// temporary file, which transformFile still has to sync and rename.
+	w, err := sio.EncryptWriter(struct{ io.Writer }{dst}, cryptoConfig)
+	if err != nil {
+		return fmt.Errorf("encrypt failed: %w", err)
+	}
+
+	var prefix [filePaddedPrefixLength]byte
+	prefix[0] = filePaddedSentinel
+	binary.BigEndian.PutUint64(prefix[1:], uint64(size))
+	if _, err = w.Write(prefix[:]); err != nil {
+		return fmt.Errorf("encrypt failed: %w", err)
+	}
+	if _, err = io.CopyN(w, src, size); err != nil {
+		return fmt.Errorf("encrypt failed: source changed while reading: %w", err)
+	}
+	if n, _ := src.Read(make([]byte, 1)); n > 0 {
+		return errors.New("encrypt failed: source changed while reading")
+	}
+
+	if _, err = io.CopyN(w, zeroReader{}, padded-filePaddedPrefixLength-size); err != nil {
+		return fmt.Errorf("encrypt failed: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("encrypt failed: %w", err)
+	}
+	return nil
+}
+
+// decryptPaddedFile writes the content of a padded plaintext stream, whose
+// sentinel has already been consumed, to dst. The padding is read to the end
+// so the final package is authenticated, and must be all zeros.
+func decryptPaddedFile(dst io.Writer, plaintext io.Reader) error {
+	var length [8]byte
+	if _, err := io.ReadFull(plaintext, length[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: missing content length", ErrMalformed)
+		}
+		return fmt.Errorf("decrypt failed: %w", err)
+	}
+	size := binary.BigEndian.Uint64(length[:])
+	if size > math.MaxInt64 {
+		return fmt.Errorf("%w: invalid content length", ErrMalformed)
+	}
+	if _, err := io.CopyN(dst, plaintext, int64(size)); err != nil {
+		// The stream is authenticated up to its final package, so running out
+		// of content means the length prefix was wrong, not that data was cut.
+		if err == io.EOF {
+			return fmt.Errorf("%w: invalid content length", ErrMalformed)
+		}
+		return fmt.Errorf("decrypt failed: %w", err)
+	}
+	if _, err := io.Copy(zeroChecker{}, plaintext); err != nil {
+		return fmt.Errorf("decrypt failed: %w", err)
+	}
+	return nil
+}
+
+// zeroReader is an endless source of zero bytes for padding.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// zeroChecker discards padding, failing on any non-zero byte.
+type zeroChecker struct{}
+
+func (zeroChecker) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != 0 {
+			return 0, fmt.Errorf("%w: invalid padding", ErrMalformed)
+		}
+	}
+	return len(p), nil
 }
 
 // transformFile streams f.Source through transform into a temporary file and
@@ -0,0 +1,50 @@
+package transcrypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// fingerprintLabel is the HMAC message of key fingerprints; the key is the
+// HMAC key.
+const fingerprintLabel = "transcrypt key fingerprint v1"
+
+// fingerprintLength is the size, in bytes, of a fingerprint before hex
+// encoding.
+const fingerprintLength = 8
+
+// Fingerprint returns a short, printable identifier of key, so two services
+// can confirm they hold the same key, or a log can name the key in use,
+// without revealing it: the first 8 bytes of HMAC-SHA256 keyed by key over a
+// fixed label, as 16 lowercase hex digits. The same key always has the same
+// fingerprint, on every system and version.
+//
+// A fingerprint cannot be reversed, but it can confirm a guess: a key that
+// could be guessed, such as a password, should not have its fingerprint
+// published. Keys from CreateKey cannot be guessed. See WithKeyID to stamp the
+// fingerprint into encrypted output.
+func Fingerprint(key []byte) string {
+	return hex.EncodeToString(fingerprintBytes(key))
+}
+
+// fingerprintBytes returns the fingerprint of key before hex encoding.
+func fingerprintBytes(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(fingerprintLabel))
+	return mac.Sum(nil)[:fingerprintLength]
+}
+
+// checkKeyID verifies a key ID stamped into encrypted data (see WithKeyID)
+// against the key given to decrypt it, so a wrong key fails with both
+// fingerprints named rather than an opaque authentication failure.
+func checkKeyID(key, keyID []byte) error {
+	if keyID == nil {
+		return nil
+	}
+	if got := fingerprintBytes(key); !hmac.Equal(got, keyID) {
+		return fmt.Errorf("%w: encrypted under key %x, you supplied key %x", ErrAuthentication, keyID, got)
+	}
+	return nil
+}
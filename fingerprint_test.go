@@ -0,0 +1,146 @@
+package transcrypt
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jantytgat/go-transcrypt/transcrypttest"
+)
+
+func TestFingerprint(t *testing.T) {
+	// Pinned: fingerprints are compared across services and versions.
+	if got, want := Fingerprint(transcrypttest.Key("master", 32)), "0d5dd13b8ebd71c2"; got != want {
+		t.Errorf("Fingerprint() = %s, want %s", got, want)
+	}
+	if Fingerprint(testKey) == Fingerprint(fileTestKey) {
+		t.Error("Fingerprint() is the same for different keys")
+	}
+	if got := Fingerprint(testKey); len(got) != 16 || strings.Trim(got, "0123456789abcdef") != "" {
+		t.Errorf("Fingerprint() = %q, want 16 hex digits", got)
+	}
+}
+
+func TestWithKeyID(t *testing.T) {
+	for _, opts := range [][]Option{{WithKeyID()}, {WithKeyID(), WithKeyCommitment()}} {
+		enc, err := Encrypt[string](testKey, AES_256_GCM, "v", opts...)
+		if err != nil {
+			t.Fatalf("Encrypt() error = %v", err)
+		}
+		if !strings.Contains(enc, ":"+Fingerprint(testKey)+":") {
+			t.Errorf("Encrypt() = %s, want the key's fingerprint stamped", enc)
+		}
+		// Decryption reads the stamp without the option.
+		if got, err := Decrypt[string](testKey, enc); err != nil || got != "v" {
+			t.Errorf("Decrypt() = %q, %v", got, err)
+		}
+		_, err = Decrypt[string](fileTestKey, enc)
+		want := "encrypted under key " + Fingerprint(testKey) + ", you supplied key " + Fingerprint(fileTestKey)
+		if !errors.Is(err, ErrAuthentication) || !strings.Contains(err.Error(), want) {
+			t.Errorf("Decrypt() with another key error = %v, want %q", err, want)
+		}
+	}
+
+	if _, err := Encrypt[string](jweTestKey, AES_256_GCM, "v", WithKeyID(), WithEncoding(EncodingJWE)); err == nil || !strings.Contains(err.Error(), "key ID does not apply") {
+		t.Errorf("Encrypt() JWE with a key ID error = %v", err)
+	}
+}
+
+func TestWithKeyIDFieldKeys(t *testing.T) {
+	pci := transcrypttest.Key("pci", 32)
+	type P struct{ Card, Email string }
+	type E struct {
+		Card  Ciphertext `transcrypt:",key=pci"`
+		Email Ciphertext
+	}
+	ring := WithKeyring(Keyring{"pci": pci})
+	enc, err := Encrypt[E](testKey, AES_256_GCM, P{"4111", "a@b.c"}, ring, WithKeyID())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	// Every field is stamped with the key it was encrypted under.
+	for _, c := range []struct {
+		value Ciphertext
+		key   []byte
+	}{{enc.Card, pci}, {enc.Email, testKey}} {
+		if info, err := Inspect(string(c.value)); err != nil || info.KeyID != Fingerprint(c.key) {
+			t.Errorf("Inspect().KeyID = %q, %v; want %s", info.KeyID, err, Fingerprint(c.key))
+		}
+	}
+	var fieldErr *FieldError
+	_, err = Decrypt[P](testKey, enc, WithKeyring(Keyring{"pci": testKey}))
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "Card" || !strings.Contains(err.Error(), "you supplied key "+Fingerprint(testKey)) {
+		t.Errorf("Decrypt() with a wrong pci key error = %v", err)
+	}
+}
+
+func TestWithKeyIDFile(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", patternBytes(1000))
+	enc := filepath.Join(dir, "enc")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: enc}, WithKeyID()); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if _, err := Decrypt[File](fileTestKey, File{Source: enc, Target: filepath.Join(dir, "dec")}); err != nil {
+		t.Errorf("Decrypt() error = %v", err)
+	}
+	_, err := Decrypt[File](testKey, File{Source: enc, Target: filepath.Join(dir, "wrong")})
+	if !errors.Is(err, ErrAuthentication) || !strings.Contains(err.Error(), "encrypted under key "+Fingerprint(fileTestKey)) {
+		t.Errorf("Decrypt() with another key error = %v", err)
+	}
+	assertNoTempLitter(t, dir)
+}
+
+func TestFileHeaderFlags(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", patternBytes(1000))
+	committed := filepath.Join(dir, "committed")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: committed}, WithKeyCommitment()); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	both := filepath.Join(dir, "both")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: both}, WithKeyCommitment(), WithKeyID()); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	v2, err := os.ReadFile(committed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v3, err := os.ReadFile(both)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v3[fileVersionOffset] != fileFormatVersionFlags || v3[fileHeaderLength] != fileFlagCommitment|fileFlagKeyID {
+		t.Fatalf("header = version %d, flags %#02x; want %d, %#02x", v3[fileVersionOffset], v3[fileHeaderLength], fileFormatVersionFlags, fileFlagCommitment|fileFlagKeyID)
+	}
+
+	// Version 3 announces each field by its flag, so a commitment alone is
+	// read like version 2's.
+	reframed := slices.Concat(v2[:fileHeaderLength], []byte{fileFlagCommitment}, v2[fileHeaderLength:])
+	reframed[fileVersionOffset] = fileFormatVersionFlags
+	unknown := bytes.Clone(v3)
+	unknown[fileHeaderLength] |= 0x80
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"commitment_only", reframed, nil},
+		{"unknown_flag", unknown, ErrMalformed},
+		{"truncated_flags", v3[:fileHeaderLength], ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, dir, tt.name, tt.data)
+			_, err := Decrypt[File](fileTestKey, File{Source: path, Target: path + ".dec"}, WithKeyCommitment())
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Decrypt() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,5 @@ go 1.25.0
 require (
 	github.com/minio/sio v0.5.1
 	golang.org/x/crypto v0.54.0
+	golang.org/x/sys v0.47.0
 )
-
-require golang.org/x/sys v0.47.0 // indirect
@@ -0,0 +1,144 @@
+package transcrypt
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jantytgat/go-transcrypt/transcrypttest"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenKey and the seeded random source make encryption reproducible, so
+// the outputs below are fixtures: a change to any of them breaks existing
+// ciphertext and must be deliberate.
+var goldenKey = transcrypttest.Key("golden", 32)
+
+func TestGolden_String(t *testing.T) {
+	tests := []struct {
+		name  string
+		suite CipherSuite
+		value any
+		opts  []Option
+		want  string
+	}{
+		{"aes_string", AES_256_GCM, "hello world", nil,
+			"00:711a493339979f505404ea49014a65c6690287a11f30f93ff282406218317321:20001c00dc4aee2baa62df592b5af8e2b0c7277b24757c12b485d229f0869ab82866fbfd6b782d114f70d9609bb38cf220c66445ad3bef0bc1669849bb"},
+		{"chacha_int64", CHACHA20_POLY1305, int64(-42), nil,
+			"01:8551a9be2fe45ff6566cac6746700b80098e2ecabae8d2aca386d38cbb2334d6:20011500eecbd8be31096eb80d2915cf65320b4b0028e9d4fa99c79d363dbaecd309af29d64b6abc35034ddf833b4bc057a8a3c40e31"},
+		{"aes_bytes_committed", AES_256_GCM, []byte{0, 1, 2, 3}, []Option{WithKeyCommitment()},
+			"00:9f6969ca18237226ec35a35bcde0e5b55b2d976a6b380580237570978f87fb4f:d94ecb1da8987cd9165519639d6652f2c1f813a3e7880a55b6d37eae9250c8d8:20000d00e0097ae3388e62cba55f676e99028dae4355ea1af2f2359774331e53f4dde35c67eca4c897d956443847"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append(tt.opts, WithRandom(transcrypttest.NewReader(tt.name)))
+			got, err := Encrypt[string](goldenKey, tt.suite, tt.value, opts...)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Encrypt() = %s\nwant        %s", got, tt.want)
+			}
+			// The fixture must stay decryptable, independent of the random
+			// source.
+			if _, err = Decrypt[any](goldenKey, tt.want); err != nil {
+				t.Errorf("Decrypt() of the fixture error = %v", err)
+			}
+		})
+	}
+}
+
+func TestGolden_File(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", patternBytes(70_000))
+	enc := filepath.Join(dir, "enc")
+	if _, err := Encrypt[File](goldenKey, AES_256_GCM, File{Source: src, Target: enc}, WithRandom(transcrypttest.NewReader("file"))); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	got, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "golden.tcrf")
+	if *updateGolden {
+		if err = os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encrypted file differs from %s; run go test -update if the change is deliberate", golden)
+	}
+
+	// The fixture must stay decryptable, independent of the random source.
+	out, err := Decrypt[File](goldenKey, File{Source: golden, Target: filepath.Join(dir, "dec")})
+	if err != nil {
+		t.Fatalf("Decrypt() of the golden file error = %v", err)
+	}
+	if restored, _ := os.ReadFile(out.Target); !bytes.Equal(restored, patternBytes(70_000)) {
+		t.Error("golden file decrypts to the wrong content")
+	}
+}
+
+func TestCreateKeyFrom(t *testing.T) {
+	a, err := CreateKeyFrom(transcrypttest.NewReader("k"), 32)
+	if err != nil {
+		t.Fatalf("CreateKeyFrom() error = %v", err)
+	}
+	b, _ := CreateKeyFrom(transcrypttest.NewReader("k"), 32)
+	if !bytes.Equal(a, b) {
+		t.Error("CreateKeyFrom() with equal sources produced different keys")
+	}
+	if _, err = CreateKeyFrom(transcrypttest.FailingReader(transcrypttest.NewReader("k"), 8, os.ErrClosed), 32); err == nil {
+		t.Error("CreateKeyFrom() with a failing source expected error")
+	}
+}
+
+func TestRandomFailure(t *testing.T) {
+	failing := transcrypttest.FailingReader(transcrypttest.NewReader("r"), 0, os.ErrClosed)
+	if _, err := Encrypt[string](testKey, AES_256_GCM, "x", WithRandom(failing)); err == nil {
+		t.Error("Encrypt() with a failing random source expected error")
+	}
+	if _, err := Encrypt[string](jweTestKey, AES_256_GCM, "x", WithRandom(failing), WithEncoding(EncodingJWE)); err == nil {
+		t.Error("Encrypt() JWE with a failing random source expected error")
+	}
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", []byte("content"))
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: filepath.Join(dir, "enc")}, WithRandom(failing)); err == nil {
+		t.Error("Encrypt() file with a failing random source expected error")
+	}
+	assertNoTempLitter(t, dir)
+}
+
+func TestGolden_KeyFile(t *testing.T) {
+	got, err := ExportKey(goldenKey, []byte("golden passphrase"), WithArgon2(keyFileTestParams), WithRandom(transcrypttest.NewReader("keyfile")))
+	if err != nil {
+		t.Fatalf("ExportKey() error = %v", err)
+	}
+
+	golden := filepath.Join("testdata", "golden.key")
+	if *updateGolden {
+		if err = os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("key file differs from %s; run go test -update if the change is deliberate", golden)
+	}
+
+	// The fixture must stay importable, independent of the random source.
+	if key, err := ImportKey(want, []byte("golden passphrase")); err != nil || !bytes.Equal(key, goldenKey) {
+		t.Errorf("ImportKey() of the golden key file = %x, %v", key, err)
+	}
+}
@@ -0,0 +1,162 @@
+package transcrypt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/minio/sio"
+)
+
+// Info describes an encoded string or an encrypted file as far as it can be
+// known without the key, for tooling, audits and migrations. Everything in it
+// is read from the unauthenticated framing, so it describes what the data
+// claims to be; only decryption proves the claim.
+type Info struct {
+	// CipherSuite is the suite the value was encrypted with.
+	CipherSuite CipherSuite
+	// Version is the format version recorded in a file's header: 1, 2 with
+	// a key commitment, or 3 with a flags byte announcing a commitment, a
+	// key ID or both. Encoded strings carry no version field, so theirs is
+	// 0; Committed and KeyID describe either.
+	Version int
+	// Committed reports whether the value carries a key commitment.
+	Committed bool
+	// Salt is the HKDF salt the value's key and nonce derive from.
+	Salt []byte
+	// Commitment is the key commitment, or nil if the value carries none
+	// (see WithKeyCommitment).
+	Commitment []byte
+	// CiphertextLength is the size in bytes of the DARE ciphertext stream,
+	// after hex decoding for encoded strings and excluding the header for
+	// files.
+	CiphertextLength int64
+	// Packages is the number of DARE packages in the ciphertext stream. Each
+	// holds up to 64 KiB of plaintext.
+	Packages int
+	// KeyID is the Fingerprint of the key the value was encrypted under, if
+	// it was stamped WithKeyID, and empty otherwise.
+	KeyID string
+}
+
+// Inspect describes the encoded string s without decrypting it. Only the
+// default transcrypt encoding can be inspected. It returns an error wrapping
+// ErrMalformed if s is not an encoded string or its ciphertext stream is not
+// well-formed, and ErrUnknownCipherSuite if it names an unknown suite.
+func Inspect(s string) (Info, error) {
+	v, err := parseEncodedString(s)
+	if err != nil {
+		return Info{}, err
+	}
+	packages, err := darePackages(bytes.NewReader(v.ciphertext), int64(len(v.ciphertext)), v.cipherSuite)
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Info{
+		CipherSuite:      v.cipherSuite,
+		Salt:             v.salt,
+		Committed:        v.commitment != nil,
+		Commitment:       v.commitment,
+		CiphertextLength: int64(len(v.ciphertext)),
+		Packages:         packages,
+		KeyID:            hex.EncodeToString(v.keyID),
+	}, nil
+}
+
+// InspectFile describes the encrypted file at path without decrypting it. It
+// reads the header and walks the package headers of the ciphertext stream,
+// skipping their content, so it is fast regardless of file size. It returns
+// ErrNotTranscryptFile if the file has no transcrypt header, and an error
+// wrapping ErrMalformed if the header or the stream is not well-formed (which
+// includes a truncated stream).
+func InspectFile(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, fmt.Errorf("cannot open file: %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return Info{}, fmt.Errorf("cannot stat file: %w", err)
+	}
+	header, err := readFileHeader(f)
+	if err != nil {
+		return Info{}, err
+	}
+	length := stat.Size() - header.length()
+	packages, err := darePackages(f, length, header.cipherSuite)
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Info{
+		CipherSuite:      header.cipherSuite,
+		Version:          int(header.version),
+		Salt:             header.salt,
+		Committed:        header.commitment != nil,
+		Commitment:       header.commitment,
+		CiphertextLength: length,
+		Packages:         packages,
+		KeyID:            hex.EncodeToString(header.keyID),
+	}, nil
+}
+
+// DARE 2.0 package framing, see github.com/minio/sio/DARE.md: every package
+// is a 16-byte header, up to 64 KiB of ciphertext and a 16-byte tag. The
+// header holds the version, the cipher suite, the payload length minus one
+// (little endian) and a nonce whose top bit flags the final package.
+const (
+	dareHeaderLength     = 16
+	dareTagLength        = 16
+	dareMaxPayloadLength = 1 << 16
+	darePackageLength    = dareHeaderLength + dareMaxPayloadLength + dareTagLength
+	dareFinalFlag        = 0x80
+)
+
+// darePackages walks the package headers of a DARE 2.0 stream of size bytes
+// read from r, skipping the payloads, and returns the number of packages. It
+// checks the framing only — version, cipher suite, lengths, and that exactly
+// the last package is flagged final — since the content cannot be
+// authenticated without the key.
+func darePackages(r io.ReadSeeker, size int64, cipherSuite CipherSuite) (int, error) {
+	var header [dareHeaderLength]byte
+	var packages int
+	for offset := int64(0); ; {
+		if offset == size {
+			// Reaching the end without a final package means the stream
+			// was cut at a package boundary.
+			return 0, fmt.Errorf("%w: ciphertext stream is truncated after %d packages", ErrMalformed, packages)
+		}
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return 0, fmt.Errorf("%w: ciphertext stream is truncated at offset %d", ErrMalformed, offset)
+		}
+		if header[0] != sio.Version20 {
+			return 0, fmt.Errorf("%w: unsupported package version 0x%02x at offset %d", ErrMalformed, header[0], offset)
+		}
+		if CipherSuite(header[1]) != cipherSuite {
+			return 0, fmt.Errorf("%w: package at offset %d uses cipher suite %d, not %s", ErrMalformed, offset, header[1], cipherSuite)
+		}
+		payload := int64(binary.LittleEndian.Uint16(header[2:4])) + 1
+		next := offset + dareHeaderLength + payload + dareTagLength
+		if next > size {
+			return 0, fmt.Errorf("%w: ciphertext stream is truncated at offset %d", ErrMalformed, offset)
+		}
+		packages++
+
+		if header[4]&dareFinalFlag != 0 {
+			if next != size {
+				return 0, fmt.Errorf("%w: %d bytes follow the final package", ErrMalformed, size-next)
+			}
+			return packages, nil
+		}
+		if _, err := r.Seek(payload+dareTagLength, io.SeekCurrent); err != nil {
+			return 0, fmt.Errorf("cannot skip package at offset %d: %w", offset, err)
+		}
+		offset = next
+	}
+}
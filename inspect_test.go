@@ -0,0 +1,180 @@
+package transcrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name      string
+		suite     CipherSuite
+		value     any
+		opts      []Option
+		committed bool
+		keyID     bool
+		packages  int
+	}{
+		{"aes", AES_256_GCM, "hello", nil, false, false, 1},
+		{"chacha", CHACHA20_POLY1305, int64(7), nil, false, false, 1},
+		{"committed", AES_256_GCM, true, []Option{WithKeyCommitment()}, true, false, 1},
+		{"key_id", AES_256_GCM, "hello", []Option{WithKeyID()}, false, true, 1},
+		{"committed_key_id", CHACHA20_POLY1305, "hello", []Option{WithKeyCommitment(), WithKeyID()}, true, true, 1},
+		{"multi_package", AES_256_GCM, make([]byte, 40_000), nil, false, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := Encrypt[string](testKey, tt.suite, tt.value, tt.opts...)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			info, err := Inspect(enc)
+			if err != nil {
+				t.Fatalf("Inspect() error = %v", err)
+			}
+			fields := strings.Split(enc, ":")
+			// Encoded strings have no version field.
+			if info.CipherSuite != tt.suite || info.Version != 0 || info.Packages != tt.packages {
+				t.Errorf("Inspect() = suite %s, version %d, packages %d; want %s, 0, %d",
+					info.CipherSuite, info.Version, info.Packages, tt.suite, tt.packages)
+			}
+			if hex.EncodeToString(info.Salt) != fields[1] {
+				t.Errorf("Salt = %x, want %s", info.Salt, fields[1])
+			}
+			if info.CiphertextLength != int64(len(fields[len(fields)-1])/2) {
+				t.Errorf("CiphertextLength = %d, want %d", info.CiphertextLength, len(fields[len(fields)-1])/2)
+			}
+			if info.Committed != tt.committed || (info.Commitment != nil) != tt.committed {
+				t.Errorf("Committed = %t, Commitment = %x; want committed %t", info.Committed, info.Commitment, tt.committed)
+			}
+			if (info.KeyID == Fingerprint(testKey)) != tt.keyID || (info.KeyID == "") == tt.keyID {
+				t.Errorf("KeyID = %q, want one %t", info.KeyID, tt.keyID)
+			}
+		})
+	}
+}
+
+func TestInspect_Errors(t *testing.T) {
+	enc, err := Encrypt[string](testKey, AES_256_GCM, "hello")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	fernet, err := Encrypt[string](jweTestKey, AES_256_GCM, "hello", WithEncoding(EncodingFernet))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	tests := []struct {
+		name  string
+		value string
+		want  error
+	}{
+		{"garbage", "not encoded", ErrMalformed},
+		{"fernet", fernet, ErrMalformed},
+		{"unknown_suite", "63" + enc[2:], ErrUnknownCipherSuite},
+		{"truncated", enc[:len(enc)-40], ErrMalformed},
+		{"trailing", enc + "00", ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Inspect(tt.value); !errors.Is(err, tt.want) {
+				t.Errorf("Inspect() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name        string
+		size        int
+		opts        []Option
+		wantVersion int
+		committed   bool
+		keyID       bool
+		packages    int
+	}{
+		{"empty", 0, nil, 1, false, false, 1},
+		{"two_packages", 70_000, nil, 1, false, false, 2},
+		{"four_packages", 200_000, nil, 1, false, false, 4},
+		{"committed", 10, []Option{WithKeyCommitment()}, 2, true, false, 1},
+		{"key_id", 10, []Option{WithKeyID()}, 3, false, true, 1},
+		{"committed_key_id", 70_000, []Option{WithKeyCommitment(), WithKeyID()}, 3, true, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := writeTestFile(t, dir, tt.name, patternBytes(tt.size))
+			enc := filepath.Join(dir, tt.name+".enc")
+			if _, err := Encrypt[File](fileTestKey, CHACHA20_POLY1305, File{Source: src, Target: enc}, tt.opts...); err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			info, err := InspectFile(enc)
+			if err != nil {
+				t.Fatalf("InspectFile() error = %v", err)
+			}
+			stat, _ := os.Stat(enc)
+			headerLength := int64(fileHeaderLength + len(info.Commitment) + len(info.KeyID)/2)
+			if info.Version == int(fileFormatVersionFlags) {
+				headerLength++
+			}
+			if info.CipherSuite != CHACHA20_POLY1305 || info.Version != tt.wantVersion || info.Packages != tt.packages {
+				t.Errorf("InspectFile() = suite %s, version %d, packages %d; want %s, %d, %d",
+					info.CipherSuite, info.Version, info.Packages, CHACHA20_POLY1305, tt.wantVersion, tt.packages)
+			}
+			if info.CiphertextLength != stat.Size()-headerLength {
+				t.Errorf("CiphertextLength = %d, want %d", info.CiphertextLength, stat.Size()-headerLength)
+			}
+			if len(info.Salt) != saltLength {
+				t.Errorf("Salt length = %d, want %d", len(info.Salt), saltLength)
+			}
+			if info.Committed != tt.committed || (info.Commitment != nil) != tt.committed {
+				t.Errorf("Committed = %t, Commitment = %x; want committed %t", info.Committed, info.Commitment, tt.committed)
+			}
+			if (info.KeyID == Fingerprint(fileTestKey)) != tt.keyID {
+				t.Errorf("KeyID = %q, want one %t", info.KeyID, tt.keyID)
+			}
+		})
+	}
+}
+
+func TestInspectFile_Errors(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", patternBytes(100_000))
+	enc := filepath.Join(dir, "enc")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: enc}); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	data, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstPackage := fileHeaderLength + dareHeaderLength + 1<<16 + dareTagLength
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    error
+	}{
+		{"foreign", []byte("hello"), ErrNotTranscryptFile},
+		{"header_only", data[:fileHeaderLength], ErrMalformed},
+		{"cut_mid_package", data[:len(data)-10], ErrMalformed},
+		{"cut_at_boundary", data[:firstPackage], ErrMalformed},
+		{"trailing", append(bytes.Clone(data), 0), ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, dir, tt.name, tt.content)
+			if _, err := InspectFile(path); !errors.Is(err, tt.want) {
+				t.Errorf("InspectFile() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if _, err := InspectFile(filepath.Join(dir, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("InspectFile() of a missing file error = %v, want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,132 @@
+package transcrypt
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Interface fields are mapped by the value they hold at run time, as their
+// static type says nothing about what needs encrypting.
+//
+// A plain interface mirrored by a Ciphertext is a leaf (see isLeafType): its
+// dynamic value is encrypted like any single value, and decrypting recovers
+// the stored type, as Decrypt[any] does. A nil interface is left as an empty
+// Ciphertext and decrypts back to nil.
+//
+// A plain interface mirrored by an interface is walked by encryptInterface
+// and decryptInterface below. The mirror's interface holds, for a dynamic
+// value that is
+//
+//   - nil: nil;
+//   - a single value: its Ciphertext;
+//   - a registered struct, or a pointer to one: its mirror (see Register);
+//   - a slice, array or map reaching interfaces, such as a []any or a
+//     map[string]any: a value of the same type, its interfaces walked in
+//     turn.
+//
+// Any other dynamic value is an error rather than copied verbatim, since it
+// could hold data that must not be stored unencrypted.
+
+// encryptInterface encrypts the dynamic value of the plain interface plain
+// into the mirror interface dst.
+func (w *structWalk) encryptInterface(p *plan, plain, dst reflect.Value, path string) error {
+	if plain.IsNil() {
+		dst.SetZero()
+		return nil
+	}
+	v := plain.Elem()
+	var encType reflect.Type
+	switch t := v.Type(); {
+	case isLeafType(t):
+		encType = ciphertextType
+	case holdsInterface(t, nil):
+		encType = t
+	default:
+		var ok bool
+		if encType, ok = counterpart(t, &mirrors); !ok {
+			return pathErrorf(path, "%w: interface holds %s, which is not a single value and has no registered mirror", ErrUnsupportedType, t)
+		}
+	}
+	if !encType.Implements(p.enc) {
+		return pathErrorf(path, "%w: %s, the encrypted form of %s, does not implement %s", ErrKindMismatch, encType, v.Type(), p.enc)
+	}
+	return w.walkDynamic(v, encType, dst, path, true)
+}
+
+// decryptInterface decrypts the dynamic value of the mirror interface enc
+// into the plain interface dst.
+func (w *structWalk) decryptInterface(p *plan, enc, dst reflect.Value, path string) error {
+	if enc.IsNil() {
+		dst.SetZero()
+		return nil
+	}
+	v := enc.Elem()
+	var plainType reflect.Type
+	switch t := v.Type(); {
+	case t == ciphertextType:
+		// The stored type is only known once decrypted: the leaf is
+		// decrypted into the plain interface itself, which takes it.
+		plainType = p.plain
+	case holdsInterface(t, nil):
+		plainType = t
+	default:
+		var ok bool
+		if plainType, ok = counterpart(t, &plainsByMirror); !ok {
+			return pathErrorf(path, "%w: interface holds %s, which is neither a Ciphertext nor a registered mirror", ErrUnsupportedType, t)
+		}
+	}
+	if !plainType.Implements(p.plain) {
+		return pathErrorf(path, "%w: %s, the plain form of %s, does not implement %s", ErrKindMismatch, plainType, v.Type(), p.plain)
+	}
+	return w.walkDynamic(v, plainType, dst, path, false)
+}
+
+// walkDynamic encrypts or decrypts v into a new value of type to, following
+// the plan for the pair, and stores it in the interface dst.
+// Slices and maps are recorded as visited, since through an interface they
+// can contain themselves.
+func (w *structWalk) walkDynamic(v reflect.Value, to reflect.Type, dst reflect.Value, path string, encrypt bool) error {
+	plainType, encType, verb := v.Type(), to, "encrypt"
+	if !encrypt {
+		plainType, encType, verb = to, v.Type(), "decrypt"
+	}
+	p, err := planFor(plainType, encType, w.o.matching)
+	if err != nil {
+		return PrefixPath(err, path)
+	}
+
+	if k := v.Kind(); (k == reflect.Slice || k == reflect.Map) && !v.IsNil() {
+		if err = w.enter(v, path, verb); err != nil {
+			return err
+		}
+		defer w.leave(v)
+	}
+	// The value is built outside the interface, where it is settable, and
+	// stored once its leaves are done.
+	out := reflect.New(to).Elem()
+	if encrypt {
+		err = w.encrypt(p, v, out, path)
+	} else {
+		err = w.decrypt(p, v, out, path)
+	}
+	if err != nil {
+		return err
+	}
+	w.set(dst, out)
+	return nil
+}
+
+// counterpart looks up the registered counterpart of t in registry, which
+// maps struct types one way or the other (see mirrors); a pointer to a
+// registered struct maps to a pointer to its counterpart.
+func counterpart(t reflect.Type, registry *sync.Map) (reflect.Type, bool) {
+	if c, ok := registry.Load(t); ok {
+		return c.(reflect.Type), true
+	}
+	if t.Kind() == reflect.Pointer {
+		if c, ok := registry.Load(t.Elem()); ok {
+			return reflect.PointerTo(c.(reflect.Type)), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,187 @@
+package transcrypt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestInterfaceLeafFields(t *testing.T) {
+	type P struct{ Payload any }
+	type E struct{ Payload Ciphertext }
+
+	for _, in := range []any{nil, "text", 42, int8(-3), 2.5, true, []byte{1, 2}, uint64(7)} {
+		t.Run(fmt.Sprintf("%T", in), func(t *testing.T) {
+			enc, err := Encrypt[E](testKey, AES_256_GCM, P{in})
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if (in == nil) != (enc.Payload == "") {
+				t.Errorf("Encrypt() Payload = %q for %v", enc.Payload, in)
+			}
+			out, err := Decrypt[P](testKey, enc)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			// The stored type is recovered, not just the value.
+			if !reflect.DeepEqual(out.Payload, in) {
+				t.Errorf("Decrypt() Payload = %#v, want %#v", out.Payload, in)
+			}
+		})
+	}
+
+	// The recovered type must implement a narrower interface.
+	type PStringer struct{ S fmt.Stringer }
+	type EStringer struct{ S Ciphertext }
+	enc, err := Encrypt[E](testKey, AES_256_GCM, P{42})
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if _, err = Decrypt[PStringer](testKey, EStringer{S: enc.Payload}); !errors.Is(err, ErrKindMismatch) {
+		t.Errorf("Decrypt() into fmt.Stringer error = %v, want ErrKindMismatch", err)
+	}
+
+	if _, err = Encrypt[E](testKey, AES_256_GCM, P{struct{ A int }{1}}); err == nil {
+		t.Error("Encrypt() of a struct into a Ciphertext leaf succeeded")
+	}
+}
+
+type eventUser struct {
+	Email string
+	Age   int
+}
+
+type secureEventUser struct {
+	Email Ciphertext
+	Age   int
+}
+
+func TestInterfaceDynamicFields(t *testing.T) {
+	if err := Register[eventUser, secureEventUser](); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	type Event struct {
+		Kind    string
+		Payload any
+	}
+	type SecureEvent struct {
+		Kind    string
+		Payload any
+	}
+
+	tests := []struct {
+		name  string
+		in    any
+		check func(t *testing.T, enc any)
+	}{
+		{"nil", nil, func(t *testing.T, enc any) {
+			if enc != nil {
+				t.Errorf("Payload = %#v, want nil", enc)
+			}
+		}},
+		{"leaf", "secret", func(t *testing.T, enc any) {
+			if _, ok := enc.(Ciphertext); !ok {
+				t.Errorf("Payload = %T, want Ciphertext", enc)
+			}
+		}},
+		{"registered_struct", eventUser{"a@b.c", 30}, func(t *testing.T, enc any) {
+			if u, ok := enc.(secureEventUser); !ok || u.Age != 30 || u.Email == "" {
+				t.Errorf("Payload = %#v, want a secureEventUser", enc)
+			}
+		}},
+		{"registered_pointer", &eventUser{"a@b.c", 30}, func(t *testing.T, enc any) {
+			if _, ok := enc.(*secureEventUser); !ok {
+				t.Errorf("Payload = %T, want *secureEventUser", enc)
+			}
+		}},
+		{"json_like", map[string]any{
+			"name": "n",
+			"tags": []any{"x", 1, nil},
+			"user": eventUser{Email: "u@v.w"},
+		}, func(t *testing.T, enc any) {
+			m, ok := enc.(map[string]any)
+			if !ok {
+				t.Fatalf("Payload = %T, want map[string]any", enc)
+			}
+			if _, ok = m["name"].(Ciphertext); !ok {
+				t.Errorf(`Payload["name"] = %T, want Ciphertext`, m["name"])
+			}
+			if tags := m["tags"].([]any); tags[2] != nil {
+				t.Errorf("nil element = %#v, want nil", tags[2])
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := Event{Kind: "k", Payload: tt.in}
+			enc, err := Encrypt[SecureEvent](testKey, AES_256_GCM, in)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			tt.check(t, enc.Payload)
+			out, err := Decrypt[Event](testKey, enc)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if !reflect.DeepEqual(out, in) {
+				t.Errorf("Decrypt() = %#v, want %#v", out, in)
+			}
+		})
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		// One key only: map order, and with it the order random bytes are
+		// drawn in, varies between walks.
+		in := Event{Payload: map[string]any{"a": []any{"x", eventUser{Email: "e"}, 1.5}}}
+		matchesSequential[Event, SecureEvent](t, testKey, AES_256_GCM, in)
+	})
+}
+
+func TestInterfaceDynamicFieldErrors(t *testing.T) {
+	type P struct{ Payload any }
+	type E struct{ Payload any }
+	type unregistered struct{ A string }
+
+	cyclic := []any{nil}
+	cyclic[0] = cyclic
+
+	tests := []struct {
+		name    string
+		encrypt bool
+		value   any
+		path    string
+		want    error
+	}{
+		{"unregistered_struct", true, unregistered{"x"}, "Payload", ErrUnsupportedType},
+		{"unregistered_nested", true, []any{1, unregistered{}}, "Payload[1]", ErrUnsupportedType},
+		{"cyclic", true, cyclic, "Payload[0]", ErrUnsupportedType},
+		// A value that is not a Ciphertext was never encrypted.
+		{"plain_in_mirror", false, "not encrypted", "Payload", ErrUnsupportedType},
+		{"tampered", false, Ciphertext("garbage"), "Payload", ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.encrypt {
+				_, err = Encrypt[E](testKey, AES_256_GCM, P{tt.value})
+			} else {
+				_, err = Decrypt[P](testKey, E{tt.value})
+			}
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Path != tt.path || !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v at %q", err, tt.want, tt.path)
+			}
+		})
+	}
+
+	// The mirror's interface must be able to hold the encrypted form.
+	type PErr struct{ Err error }
+	type EErr struct{ Err error }
+	if _, err := Encrypt[EErr](testKey, AES_256_GCM, PErr{errors.New("boom")}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Encrypt() of an error value error = %v, want ErrUnsupportedType", err)
+	}
+	if out, err := Encrypt[EErr](testKey, AES_256_GCM, PErr{}); err != nil || out.Err != nil {
+		t.Errorf("Encrypt() of a nil error = %v, %v", out, err)
+	}
+}
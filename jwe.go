@@ -0,0 +1,234 @@
+package transcrypt
+
+// This file holds the JWE encoding of single values, selected with
+// WithEncoding(EncodingJWE). The output is a JWE compact serialization
+// (RFC 7516) using direct key agreement ("alg":"dir"):
+//
+//	BASE64URL(protected header) . (empty encrypted key) . BASE64URL(IV) .
+//	BASE64URL(ciphertext) . BASE64URL(tag)
+//
+// The content encryption is chosen by the CipherSuite: AES_256_GCM maps to
+// "A256GCM" (RFC 7518) and CHACHA20_POLY1305 to "C20P" (the ChaCha20-Poly1305
+// identifier of draft-amringer-jose-chacha, which JOSE libraries implement
+// under that name where they support it). The protected header is the AEAD's
+// additional data, so the transcrypt type tag travels there as the private
+// header parameter "tc_kind" and stays authenticated, just as inside the
+// transcrypt format's ciphertext; the payload is the value's binary form.
+//
+// With "dir", the key IS the content encryption key, so it must be exactly 32
+// bytes and is used without HKDF, and the 96-bit IV is random per value. That
+// puts the usual birthday bound of ~2^32 values per key on this encoding,
+// unlike the transcrypt format's per-value derived keys; prefer the default
+// encoding where JOSE interoperability is not needed.
+//
+// Tokens produced elsewhere without a "tc_kind" header decrypt to untyped
+// rawBytes.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const jweKeyLength = 32
+
+// jweHeader is the protected header. Field order is fixed by the struct, so
+// the serialized header (and with it the AAD) is deterministic.
+//
+// Stamped values (see WithIssuedAt/WithExpiry) carry their validity window as
+// the registered JWT claims "iat" and "exp", replicated as header parameters
+// as RFC 7519 section 5.3 describes.
+type jweHeader struct {
+	Alg  string   `json:"alg"`
+	Enc  string   `json:"enc"`
+	Kind string   `json:"tc_kind,omitempty"`
+	Iat  int64    `json:"iat,omitempty"`
+	Exp  int64    `json:"exp,omitempty"`
+	Zip  string   `json:"zip,omitempty"`
+	Crit []string `json:"crit,omitempty"`
+}
+
+// unixOrZero converts a header timestamp, where 0 means absent.
+func unixOrZero(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// zeroOrUnix is the inverse of unixOrZero.
+func zeroOrUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// jweEnc returns the "enc" identifier of a cipher suite.
+func jweEnc(c CipherSuite) (string, error) {
+	switch c {
+	case AES_256_GCM:
+		return "A256GCM", nil
+	case CHACHA20_POLY1305:
+		return "C20P", nil
+	default:
+		return "", fmt.Errorf("%w: %d", ErrUnknownCipherSuite, c)
+	}
+}
+
+// jweAEAD builds the content cipher for an "enc" identifier.
+func jweAEAD(enc string, key []byte) (cipher.AEAD, error) {
+	switch enc {
+	case "A256GCM":
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case "C20P":
+		return chacha20poly1305.New(key)
+	default:
+		return nil, fmt.Errorf("%w: unsupported jwe content encryption %q", ErrUnknownCipherSuite, enc)
+	}
+}
+
+// encryptJWE encodes d into a JWE compact serialization, carrying its kind
+// (and validity window, if stamped) in the protected header.
+func encryptJWE(key []byte, cipherSuite CipherSuite, d any, o *options) (string, error) {
+	if len(key) != jweKeyLength {
+		return "", fmt.Errorf("jwe key must be %d bytes, got %d", jweKeyLength, len(key))
+	}
+
+	hexPayload, err := convertValueToHexString(reflect.ValueOf(d))
+	if err != nil {
+		return "", err
+	}
+	// The converter's hex form is the transcrypt inner payload; JWE carries
+	// the binary value itself.
+	payload, err := hex.DecodeString(hexPayload)
+	if err != nil {
+		return "", err
+	}
+
+	enc, err := jweEnc(cipherSuite)
+	if err != nil {
+		return "", err
+	}
+	aead, err := jweAEAD(enc, key)
+	if err != nil {
+		return "", err
+	}
+
+	issuedAt, expiresAt := o.stamp()
+	header, err := json.Marshal(jweHeader{
+		Alg:  "dir",
+		Enc:  enc,
+		Kind: reflect.TypeOf(d).Kind().String(),
+		Iat:  zeroOrUnix(issuedAt),
+		Exp:  zeroOrUnix(expiresAt),
+	})
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+
+	iv := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(o.rand(), iv); err != nil {
+		return "", fmt.Errorf("failed to read random data for iv: %w", err)
+	}
+	sealed := aead.Seal(nil, iv, payload, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		"",
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// decryptJWE parses and decrypts a JWE compact serialization produced with
+// "alg":"dir". A "tc_kind" header restores the stored type; without one the
+// payload is returned as rawBytes. The validity window, if any, is checked
+// once the header is authenticated.
+func decryptJWE(key []byte, token string, o *options) (any, error) {
+	if len(key) != jweKeyLength {
+		return nil, fmt.Errorf("jwe key must be %d bytes, got %d", jweKeyLength, len(key))
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("%w: value is not a jwe compact serialization: %d segments, want 5", ErrMalformed, len(parts))
+	}
+	if parts[1] != "" {
+		return nil, fmt.Errorf("%w: value is not a direct-key jwe: encrypted key must be empty", ErrMalformed)
+	}
+
+	var segments [4][]byte
+	for i, part := range []string{parts[0], parts[2], parts[3], parts[4]} {
+		b, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot decode jwe segment %d: %w", ErrMalformed, i, err)
+		}
+		segments[i] = b
+	}
+	headerJSON, iv, ciphertext, tag := segments[0], segments[1], segments[2], segments[3]
+
+	var header jweHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("%w: cannot decode jwe header: %w", ErrMalformed, err)
+	}
+	if header.Alg != "dir" {
+		return nil, fmt.Errorf("%w: unsupported jwe key management %q, only \"dir\"", ErrMalformed, header.Alg)
+	}
+	// RFC 7516 requires rejecting critical extensions the recipient does not
+	// understand; none are understood here. Compression is not implemented.
+	if len(header.Crit) > 0 {
+		return nil, fmt.Errorf("%w: unsupported critical jwe header parameters %q", ErrMalformed, header.Crit)
+	}
+	if header.Zip != "" {
+		return nil, fmt.Errorf("%w: unsupported jwe compression %q", ErrMalformed, header.Zip)
+	}
+
+	aead, err := jweAEAD(header.Enc, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid jwe iv length %d, want %d", ErrMalformed, len(iv), aead.NonceSize())
+	}
+	if len(tag) != aead.Overhead() {
+		return nil, fmt.Errorf("%w: invalid jwe tag length %d, want %d", ErrMalformed, len(tag), aead.Overhead())
+	}
+
+	payload, err := aead.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt failed: %w: %w", ErrAuthentication, err)
+	}
+	if err = o.checkValidity(unixOrZero(header.Iat), unixOrZero(header.Exp)); err != nil {
+		return nil, err
+	}
+
+	if header.Kind == "" {
+		return rawBytes(payload), nil
+	}
+	kind := getKindForString(header.Kind)
+	if kind == reflect.Invalid {
+		return nil, fmt.Errorf("%w: cannot decode kind %q", ErrUnsupportedType, header.Kind)
+	}
+	v, err := convertHexStringToValue(hex.EncodeToString(payload), kind)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
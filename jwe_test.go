@@ -0,0 +1,161 @@
+package transcrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var jweTestKey = bytes.Repeat([]byte{0x42}, jweKeyLength)
+
+// foreignJWE builds a direct-key A256GCM token the way a third-party JOSE
+// library would, with the given protected header and no transcrypt kind.
+func foreignJWE(t *testing.T, header string, payload []byte) string {
+	t.Helper()
+	block, err := aes.NewCipher(jweTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := base64.RawURLEncoding.EncodeToString([]byte(header))
+	iv := make([]byte, aead.NonceSize())
+	sealed := aead.Seal(nil, iv, payload, []byte(protected))
+	n := len(sealed) - aead.Overhead()
+	return strings.Join([]string{
+		protected, "",
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(sealed[:n]),
+		base64.RawURLEncoding.EncodeToString(sealed[n:]),
+	}, ".")
+}
+
+func TestJWE_RoundTrip(t *testing.T) {
+	values := []any{"hello jose", true, -42, int8(-8), uint64(1 << 63), float32(1.5), 2.25, complex(1, -1), []byte{1, 2, 3}}
+	for _, suite := range []CipherSuite{AES_256_GCM, CHACHA20_POLY1305} {
+		for _, in := range values {
+			token, err := Encrypt[string](jweTestKey, suite, in, WithEncoding(EncodingJWE))
+			if err != nil {
+				t.Fatalf("%s: Encrypt(%T) error = %v", suite, in, err)
+			}
+			got, err := Decrypt[any](jweTestKey, token, WithEncoding(EncodingJWE))
+			if err != nil {
+				t.Fatalf("%s: Decrypt(%T) error = %v", suite, in, err)
+			}
+			if !reflect.DeepEqual(got, in) {
+				t.Errorf("%s: round trip = %v (%T), want %v (%T)", suite, got, got, in, in)
+			}
+		}
+	}
+}
+
+func TestJWE_Header(t *testing.T) {
+	tests := []struct {
+		suite CipherSuite
+		enc   string
+	}{
+		{AES_256_GCM, "A256GCM"},
+		{CHACHA20_POLY1305, "C20P"},
+	}
+	for _, tt := range tests {
+		token, err := Encrypt[string](jweTestKey, tt.suite, int64(7), WithEncoding(EncodingJWE))
+		if err != nil {
+			t.Fatalf("Encrypt() error = %v", err)
+		}
+		parts := strings.Split(token, ".")
+		if len(parts) != 5 || parts[1] != "" {
+			t.Fatalf("token %q is not a direct-key compact serialization", token)
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+		if err != nil {
+			t.Fatalf("cannot decode header: %v", err)
+		}
+		var header map[string]any
+		if err = json.Unmarshal(raw, &header); err != nil {
+			t.Fatalf("cannot parse header: %v", err)
+		}
+		want := map[string]any{"alg": "dir", "enc": tt.enc, "tc_kind": "int64"}
+		if !reflect.DeepEqual(header, want) {
+			t.Errorf("header = %v, want %v", header, want)
+		}
+	}
+}
+
+func TestJWE_ForeignTokenIsUntyped(t *testing.T) {
+	token := foreignJWE(t, `{"alg":"dir","enc":"A256GCM"}`, []byte("from elsewhere"))
+
+	got, err := Decrypt[string](jweTestKey, token, WithEncoding(EncodingJWE))
+	if err != nil {
+		t.Fatalf("Decrypt[string]() error = %v", err)
+	}
+	if got != "from elsewhere" {
+		t.Errorf("Decrypt[string]() = %q", got)
+	}
+	anyValue, err := Decrypt[any](jweTestKey, token, WithEncoding(EncodingJWE))
+	if err != nil {
+		t.Fatalf("Decrypt[any]() error = %v", err)
+	}
+	if _, ok := anyValue.([]byte); !ok {
+		t.Errorf("Decrypt[any]() returned %T, want []byte", anyValue)
+	}
+}
+
+func TestJWE_KindIsAuthenticated(t *testing.T) {
+	token, err := Encrypt[string](jweTestKey, AES_256_GCM, int64(4614256656552045848), WithEncoding(EncodingJWE))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	parts := strings.Split(token, ".")
+	parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"dir","enc":"A256GCM","tc_kind":"float64"}`))
+	if _, err = Decrypt[any](jweTestKey, strings.Join(parts, "."), WithEncoding(EncodingJWE)); err == nil {
+		t.Error("Decrypt() accepted a relabeled kind header")
+	}
+}
+
+func TestJWE_Invalid(t *testing.T) {
+	valid, err := Encrypt[string](jweTestKey, AES_256_GCM, "x", WithEncoding(EncodingJWE))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	parts := strings.Split(valid, ".")
+	withKey := strings.Join([]string{parts[0], "AAAA", parts[2], parts[3], parts[4]}, ".")
+
+	tests := []struct {
+		name  string
+		key   []byte
+		token string
+	}{
+		{"wrong_key", bytes.Repeat([]byte{0x43}, jweKeyLength), valid},
+		{"short_key", jweTestKey[:16], valid},
+		{"segments", jweTestKey, "a.b.c"},
+		{"encrypted_key", jweTestKey, withKey},
+		{"other_alg", jweTestKey, foreignJWE(t, `{"alg":"A256KW","enc":"A256GCM"}`, []byte("x"))},
+		{"crit", jweTestKey, foreignJWE(t, `{"alg":"dir","enc":"A256GCM","crit":["exp"],"exp":1}`, []byte("x"))},
+		{"zip", jweTestKey, foreignJWE(t, `{"alg":"dir","enc":"A256GCM","zip":"DEF"}`, []byte("x"))},
+		{"unknown_enc", jweTestKey, foreignJWE(t, `{"alg":"dir","enc":"A128CBC-HS256"}`, []byte("x"))},
+		{"unknown_kind", jweTestKey, foreignJWE(t, `{"alg":"dir","enc":"A256GCM","tc_kind":"map"}`, []byte("x"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt[any](tt.key, tt.token, WithEncoding(EncodingJWE)); err == nil {
+				t.Error("Decrypt() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestJWE_EncryptRejects(t *testing.T) {
+	if _, err := Encrypt[string](testKey, AES_256_GCM, "x", WithEncoding(EncodingJWE)); err == nil {
+		t.Error("Encrypt() with a non-32-byte key expected error")
+	}
+	if _, err := Encrypt[string](jweTestKey, AES_256_GCM, []int{1}, WithEncoding(EncodingJWE)); err == nil {
+		t.Error("Encrypt() of an unsupported type expected error")
+	}
+}
@@ -0,0 +1,210 @@
+package transcrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/minio/sio"
+	"golang.org/x/crypto/argon2"
+)
+
+// A key file holds a key encrypted under a passphrase, as a PEM block whose
+// headers, in the alphabetical order encoding/pem writes them, describe how
+// to decrypt it:
+//
+//	-----BEGIN TRANSCRYPT KEY-----
+//	Cipher-Suite: AES_256_GCM
+//	Fingerprint: <fingerprint of the key>
+//	KDF: argon2id
+//	KDF-Params: t=3,m=65536,p=4
+//	KDF-Salt: <saltLength bytes in hex>
+//	Version: 1
+//
+//	<base64 DARE ciphertext of the key>
+//	-----END TRANSCRYPT KEY-----
+//
+// Argon2id stretches the passphrase into a key-encryption key, from which
+// createCryptoConfig derives the DARE key and nonce as for any other value,
+// salted with KDF-Salt and domain-separated by keyFileHKDFInfo. Altering any
+// header but the fingerprint changes the derived key and fails
+// authentication; the fingerprint is checked against the decrypted key.
+const (
+	keyFileType    = "TRANSCRYPT KEY"
+	keyFileVersion = "1"
+	keyFileKDF     = "argon2id"
+)
+
+// keyFileHKDFInfo is the HKDF info parameter for key files, see fileHKDFInfo.
+var keyFileHKDFInfo = []byte("transcrypt/keyfile")
+
+// Argon2Params are the Argon2id parameters that turn a passphrase into the
+// key protecting a key file; see WithArgon2.
+type Argon2Params struct {
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is the memory used, in KiB.
+	Memory uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+}
+
+// DefaultArgon2Params are the parameters ExportKey uses by default: the
+// second recommended option of RFC 9106, 3 passes over 64 MiB with 4
+// threads.
+var DefaultArgon2Params = Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// maxArgon2Params bound the parameters ImportKey accepts from a key file.
+// Key files are untrusted input, so a crafted one must not make ImportKey
+// allocate more than 1 GiB or run many more passes than the default; the
+// bound is checked before any derivation starts. ExportKey refuses the same
+// parameters, so every file it writes can be imported.
+var maxArgon2Params = Argon2Params{Time: 8, Memory: 1024 * 1024, Threads: 255}
+
+// validate reports whether p can be used.
+func (p Argon2Params) validate() error {
+	if p.Time < 1 || p.Threads < 1 || p.Memory < 8*uint32(p.Threads) {
+		return fmt.Errorf("invalid Argon2 parameters %s: need t >= 1, p >= 1 and m >= 8p", p)
+	}
+	if p.Time > maxArgon2Params.Time || p.Memory > maxArgon2Params.Memory {
+		return fmt.Errorf("invalid Argon2 parameters %s: exceed %s", p, maxArgon2Params)
+	}
+	return nil
+}
+
+// String formats p as in the KDF-Params header.
+func (p Argon2Params) String() string {
+	return fmt.Sprintf("t=%d,m=%d,p=%d", p.Time, p.Memory, p.Threads)
+}
+
+// ExportKey encrypts key under passphrase into a key file (see the format
+// above), for storing a key on disk or in a secret store instead of as raw
+// hex. ImportKey reverses it. The file names the key's fingerprint in the
+// clear, so the key it holds can be identified without the passphrase.
+//
+// opts select the cipher suite (WithCipherSuite, AES_256_GCM by default), the
+// Argon2id cost (WithArgon2) and, for tests, the random source (WithRandom);
+// other options are ignored. It returns an error if key or passphrase is
+// empty or an option is invalid.
+func ExportKey(key, passphrase []byte, opts ...Option) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errors.New("key is empty")
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+	o := newOptions(opts)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if !o.cipherSuite.isValid() {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCipherSuite, o.cipherSuite)
+	}
+	params := DefaultArgon2Params
+	if o.argon2 != nil {
+		params = *o.argon2
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(o.rand(), salt); err != nil {
+		return nil, fmt.Errorf("failed to read random data for salt: %w", err)
+	}
+	kek := argon2.IDKey(passphrase, salt, params.Time, params.Memory, params.Threads, 32)
+	defer ClearKey(kek)
+	cryptoConfig, _, _, err := createCryptoConfig(nil, kek, []byte{byte(o.cipherSuite)}, salt, keyFileHKDFInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ciphertext bytes.Buffer
+	if _, err = sio.Encrypt(&ciphertext, bytes.NewReader(key), cryptoConfig); err != nil {
+		return nil, fmt.Errorf("encrypt failed: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type: keyFileType,
+		Headers: map[string]string{
+			"Version":      keyFileVersion,
+			"Cipher-Suite": o.cipherSuite.String(),
+			"KDF":          keyFileKDF,
+			"KDF-Params":   params.String(),
+			"KDF-Salt":     hex.EncodeToString(salt),
+			"Fingerprint":  Fingerprint(key),
+		},
+		Bytes: ciphertext.Bytes(),
+	}), nil
+}
+
+// ImportKey decrypts the key held by a key file written by ExportKey. Text
+// before the PEM block is ignored.
+//
+// It returns an error wrapping ErrAuthentication if the passphrase is wrong
+// or the file was altered, and one wrapping ErrMalformed if data is not a
+// key file of a supported version, or asks for Argon2id parameters beyond
+// 8 passes or 1 GiB of memory.
+func ImportKey(data, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != keyFileType {
+		return nil, fmt.Errorf("%w: no %s block found", ErrMalformed, keyFileType)
+	}
+	h := block.Headers
+	if h["Version"] != keyFileVersion {
+		return nil, fmt.Errorf("%w: unsupported key file version %q", ErrMalformed, h["Version"])
+	}
+	if h["KDF"] != keyFileKDF {
+		return nil, fmt.Errorf("%w: unsupported key file KDF %q", ErrMalformed, h["KDF"])
+	}
+	cipherSuite, err := GetCipherSuite(h["Cipher-Suite"])
+	if err != nil {
+		return nil, err
+	}
+	params, err := parseArgon2Params(h["KDF-Params"])
+	if err != nil {
+		return nil, err
+	}
+	salt, err := hex.DecodeString(h["KDF-Salt"])
+	if err != nil || len(salt) != saltLength {
+		return nil, fmt.Errorf("%w: key file salt must be %d bytes in hex", ErrMalformed, saltLength)
+	}
+
+	kek := argon2.IDKey(passphrase, salt, params.Time, params.Memory, params.Threads, 32)
+	defer ClearKey(kek)
+	cryptoConfig, _, _, err := createCryptoConfig(nil, kek, []byte{byte(cipherSuite)}, salt, keyFileHKDFInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+	var key bytes.Buffer
+	if _, err = sio.Decrypt(&key, bytes.NewReader(block.Bytes), cryptoConfig); err != nil {
+		return nil, fmt.Errorf("%w: wrong passphrase or altered key file: %w", ErrAuthentication, err)
+	}
+	if key.Len() == 0 {
+		return nil, fmt.Errorf("%w: key file holds no key", ErrAuthentication)
+	}
+	if got := Fingerprint(key.Bytes()); got != h["Fingerprint"] {
+		ClearKey(key.Bytes())
+		return nil, fmt.Errorf("%w: key file names fingerprint %q, but holds key %s", ErrAuthentication, h["Fingerprint"], got)
+	}
+	return key.Bytes(), nil
+}
+
+// parseArgon2Params parses a KDF-Params header within maxArgon2Params.
+func parseArgon2Params(s string) (Argon2Params, error) {
+	var t, m, p uint64
+	if _, err := fmt.Sscanf(s, "t=%d,m=%d,p=%d", &t, &m, &p); err != nil || s != (Argon2Params{uint32(t), uint32(m), uint8(p)}).String() {
+		return Argon2Params{}, fmt.Errorf("%w: key file KDF parameters %s", ErrMalformed, strconv.Quote(s))
+	}
+	if t > uint64(maxArgon2Params.Time) || m > uint64(maxArgon2Params.Memory) || p > uint64(maxArgon2Params.Threads) {
+		return Argon2Params{}, fmt.Errorf("%w: key file KDF parameters %s exceed %s", ErrMalformed, s, maxArgon2Params)
+	}
+	params := Argon2Params{Time: uint32(t), Memory: uint32(m), Threads: uint8(p)}
+	if err := params.validate(); err != nil {
+		return Argon2Params{}, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return params, nil
+}
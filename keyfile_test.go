@@ -0,0 +1,161 @@
+package transcrypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keyFileTestParams keep Argon2id cheap in tests.
+var keyFileTestParams = Argon2Params{Time: 1, Memory: 64, Threads: 1}
+
+func TestExportKeyRoundTrip(t *testing.T) {
+	passphrase := []byte("correct horse battery staple")
+	for _, suite := range []CipherSuite{AES_256_GCM, CHACHA20_POLY1305} {
+		t.Run(suite.String(), func(t *testing.T) {
+			data, err := ExportKey(testKey, passphrase, WithCipherSuite(suite), WithArgon2(keyFileTestParams))
+			if err != nil {
+				t.Fatalf("ExportKey() error = %v", err)
+			}
+			for _, header := range []string{
+				"-----BEGIN TRANSCRYPT KEY-----",
+				"Version: 1",
+				"Cipher-Suite: " + suite.String(),
+				"KDF: argon2id",
+				"KDF-Params: t=1,m=64,p=1",
+				"Fingerprint: " + Fingerprint(testKey),
+			} {
+				if !strings.Contains(string(data), header+"\n") {
+					t.Errorf("key file lacks %q:\n%s", header, data)
+				}
+			}
+
+			key, err := ImportKey(data, passphrase)
+			if err != nil || !bytes.Equal(key, testKey) {
+				t.Errorf("ImportKey() = %x, %v; want the key", key, err)
+			}
+			if _, err = ImportKey(data, []byte("wrong")); !errors.Is(err, ErrAuthentication) {
+				t.Errorf("ImportKey() with a wrong passphrase error = %v, want ErrAuthentication", err)
+			}
+		})
+	}
+
+	// Two exports of one key differ, by their salt.
+	a, _ := ExportKey(testKey, passphrase, WithArgon2(keyFileTestParams))
+	b, _ := ExportKey(testKey, passphrase, WithArgon2(keyFileTestParams))
+	if bytes.Equal(a, b) {
+		t.Error("ExportKey() twice produced the same key file")
+	}
+}
+
+func TestExportKeyDefaultParams(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Argon2id with the default parameters uses 64 MiB")
+	}
+	data, err := ExportKey(testKey, []byte("p"))
+	if err != nil {
+		t.Fatalf("ExportKey() error = %v", err)
+	}
+	if !strings.Contains(string(data), "KDF-Params: "+DefaultArgon2Params.String()+"\n") {
+		t.Errorf("key file does not use the default parameters:\n%s", data)
+	}
+	if key, err := ImportKey(data, []byte("p")); err != nil || !bytes.Equal(key, testKey) {
+		t.Errorf("ImportKey() = %x, %v", key, err)
+	}
+}
+
+func TestImportKeyTampered(t *testing.T) {
+	passphrase := []byte("p")
+	data, err := ExportKey(testKey, passphrase, WithArgon2(keyFileTestParams))
+	if err != nil {
+		t.Fatalf("ExportKey() error = %v", err)
+	}
+	salt := strings.SplitN(strings.SplitN(string(data), "KDF-Salt: ", 2)[1], "\n", 2)[0]
+
+	tests := []struct {
+		name     string
+		old, new string
+		is       error
+	}{
+		{"params", "t=1,m=64,p=1", "t=2,m=64,p=1", ErrAuthentication},
+		{"salt", salt, strings.Repeat("0", len(salt)), ErrAuthentication},
+		{"suite", "AES_256_GCM", "CHACHA20_POLY1305", ErrAuthentication},
+		{"fingerprint", "Fingerprint: " + Fingerprint(testKey), "Fingerprint: 0000000000000000", ErrAuthentication},
+		{"version", "Version: 1", "Version: 2", ErrMalformed},
+		{"kdf", "KDF: argon2id", "KDF: scrypt", ErrMalformed},
+		{"params_syntax", "t=1,m=64,p=1", "t=1,m=64", ErrMalformed},
+		{"params_costly", "t=1,m=64,p=1", "t=1,m=999999999,p=1", ErrMalformed},
+		{"params_memory", "t=1,m=64,p=1", "t=1,m=1048577,p=1", ErrMalformed},
+		{"params_time", "t=1,m=64,p=1", "t=9,m=64,p=1", ErrMalformed},
+		{"params_invalid", "t=1,m=64,p=1", "t=0,m=64,p=1", ErrMalformed},
+		{"salt_short", salt, "00", ErrMalformed},
+		{"type", "TRANSCRYPT KEY", "PRIVATE KEY", ErrMalformed},
+		{"suite_unknown", "AES_256_GCM", "ROT13", ErrUnknownCipherSuite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := strings.ReplaceAll(string(data), tt.old, tt.new)
+			if tampered == string(data) {
+				t.Fatalf("%q not found in the key file", tt.old)
+			}
+			if _, err := ImportKey([]byte(tampered), passphrase); !errors.Is(err, tt.is) {
+				t.Errorf("ImportKey() error = %v, want %v", err, tt.is)
+			}
+		})
+	}
+}
+
+// TestImportKeyOverLimit checks that a key file asking for more than
+// maxArgon2Params is refused from its headers alone: a derivation at these
+// costs would take seconds and allocate gigabytes.
+func TestImportKeyOverLimit(t *testing.T) {
+	passphrase := []byte("correct horse")
+	data, err := ExportKey(testKey, passphrase, WithArgon2(keyFileTestParams))
+	if err != nil {
+		t.Fatalf("ExportKey() error = %v", err)
+	}
+	for _, params := range []Argon2Params{
+		{Time: maxArgon2Params.Time + 1, Memory: 64, Threads: 1},
+		{Time: 1, Memory: maxArgon2Params.Memory + 1024, Threads: 1},
+		{Time: 1000, Memory: 4 * 1024 * 1024, Threads: 255},
+	} {
+		t.Run(params.String(), func(t *testing.T) {
+			costly := strings.Replace(string(data), "t=1,m=64,p=1", params.String(), 1)
+			start := time.Now()
+			_, err := ImportKey([]byte(costly), passphrase)
+			if !errors.Is(err, ErrMalformed) || !strings.Contains(err.Error(), "exceed") {
+				t.Errorf("ImportKey() error = %v, want ErrMalformed for parameters beyond %s", err, maxArgon2Params)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("ImportKey() took %s to refuse the file", elapsed)
+			}
+		})
+	}
+}
+
+func TestExportKeyArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		key, pass []byte
+		opts      []Option
+		want      string
+	}{
+		{"empty_key", nil, []byte("p"), nil, "key is empty"},
+		{"empty_passphrase", testKey, nil, nil, "passphrase is empty"},
+		{"bad_params", testKey, []byte("p"), []Option{WithArgon2(Argon2Params{Time: 1, Memory: 8, Threads: 4})}, "invalid Argon2 parameters"},
+		{"costly_params", testKey, []byte("p"), []Option{WithArgon2(Argon2Params{Time: 1, Memory: 2 * 1024 * 1024, Threads: 4})}, "exceed"},
+		{"bad_suite", testKey, []byte("p"), []Option{WithCipherSuite(CipherSuite(9))}, "unknown cipher suite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ExportKey(tt.key, tt.pass, tt.opts...); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ExportKey() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := ImportKey([]byte("not a key file"), []byte("p")); !errors.Is(err, ErrMalformed) {
+		t.Errorf("ImportKey() of garbage error = %v, want ErrMalformed", err)
+	}
+}
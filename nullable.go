@@ -0,0 +1,100 @@
+package transcrypt
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// A leaf may be left as an empty Ciphertext instead of being encrypted, when
+// it holds no value:
+//
+//   - a nil interface;
+//   - a nullable struct, such as sql.NullString, sql.NullInt64 or
+//     sql.Null[T], that is not valid;
+//   - any zero value, under WithZeroAsEmpty.
+//
+// An empty Ciphertext decrypts back to the zero value in those cases, and is
+// an error otherwise. A nullable struct is one that implements
+// driver.Valuer, with sql.Scanner on its pointer: a valid one encrypts the
+// value Value returns, and decrypting hands the stored value to Scan.
+//
+// Only nullable structs shaped like the sql.Null* types, a Valid bool beside
+// a single value field, can be mirrored by a Ciphertext, and only when the
+// value field has a kind isLeafType accepts. sql.NullString, sql.NullInt64,
+// sql.NullInt32, sql.NullInt16, sql.NullByte, sql.NullFloat64, sql.NullBool
+// and sql.Null[T] of such a T qualify; sql.NullTime does not, as a time.Time
+// cannot be encoded, and is rejected when the plan is compiled.
+
+var (
+	valuerType  = reflect.TypeFor[driver.Valuer]()
+	scannerType = reflect.TypeFor[sql.Scanner]()
+)
+
+// isNullable reports whether t is a nullable struct.
+func isNullable(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.Implements(valuerType) && reflect.PointerTo(t).Implements(scannerType)
+}
+
+// nullableLeaf reports whether the nullable struct t can be encrypted into a
+// single Ciphertext: its fields are a Valid bool and one value field of a
+// leaf kind other than an interface, whose values Value returns.
+func nullableLeaf(t reflect.Type) bool {
+	var value reflect.Type
+	for i := range t.NumField() {
+		f := t.Field(i)
+		switch {
+		case f.Name == "Valid" && f.Type.Kind() == reflect.Bool:
+		case value != nil:
+			return false
+		default:
+			value = f.Type
+		}
+	}
+	return value != nil && value.Kind() != reflect.Interface && isLeafType(value)
+}
+
+// plainLeaf returns the value the plain leaf v encrypts, or nil if v is left
+// as an empty Ciphertext.
+func plainLeaf(v reflect.Value, o *options) (any, error) {
+	switch {
+	case !v.IsValid():
+		return nil, errors.New("data is nil")
+	case v.Kind() == reflect.Interface && v.IsNil():
+		return nil, nil
+	case o.zeroAsEmpty && v.IsZero():
+		return nil, nil
+	case isNullable(v.Type()):
+		d, err := v.Interface().(driver.Valuer).Value()
+		if err != nil {
+			return nil, fmt.Errorf("%s.Value failed: %w", v.Type(), err)
+		}
+		return d, nil
+	default:
+		return v.Interface(), nil
+	}
+}
+
+// emptyLeaf reports whether an empty Ciphertext decrypts to the zero value
+// of the plain type t rather than failing.
+func emptyLeaf(t reflect.Type, o *options) bool {
+	return o.zeroAsEmpty || t.Kind() == reflect.Interface || isNullable(t)
+}
+
+// fitLeaf fits a decrypted value into the plain leaf type target: through
+// Scan for a nullable struct, through fitValue otherwise.
+func fitLeaf(decrypted any, target reflect.Type) (reflect.Value, error) {
+	if !isNullable(target) {
+		return fitValue(reflect.ValueOf(decrypted), target)
+	}
+	if raw, ok := decrypted.(rawBytes); ok {
+		decrypted = []byte(raw)
+	}
+	out := reflect.New(target)
+	if err := out.Interface().(sql.Scanner).Scan(decrypted); err != nil {
+		return reflect.Value{}, fmt.Errorf("%w: decrypted value of type %T does not fit %s: %w", ErrKindMismatch, decrypted, target, err)
+	}
+	return out.Elem(), nil
+}
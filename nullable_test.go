@@ -0,0 +1,205 @@
+package transcrypt
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptionalPointerFields(t *testing.T) {
+	type P struct{ Phone *string }
+	type E struct{ Phone *Ciphertext }
+
+	phone := "555-0100"
+	for _, in := range []P{{}, {Phone: &phone}} {
+		enc, err := Encrypt[E](testKey, AES_256_GCM, in)
+		if err != nil {
+			t.Fatalf("Encrypt() error = %v", err)
+		}
+		if (in.Phone == nil) != (enc.Phone == nil) {
+			t.Errorf("Encrypt() Phone = %v, want nil only for a nil plain pointer", enc.Phone)
+		}
+		out, err := Decrypt[P](testKey, enc)
+		if err != nil || !reflect.DeepEqual(out, in) {
+			t.Errorf("round trip = %+v, %v; want %+v", out, err, in)
+		}
+	}
+}
+
+func TestNullableFields(t *testing.T) {
+	type P struct {
+		Name  sql.NullString
+		Count sql.NullInt64
+		Ratio sql.Null[float64]
+		On    sql.NullBool
+	}
+	type E struct {
+		Name  Ciphertext
+		Count Ciphertext
+		Ratio Ciphertext
+		On    Ciphertext
+	}
+
+	tests := []struct {
+		name string
+		in   P
+	}{
+		{"valid", P{
+			Name:  sql.NullString{String: "n", Valid: true},
+			Count: sql.NullInt64{Int64: 7, Valid: true},
+			Ratio: sql.Null[float64]{V: 0.5, Valid: true},
+			On:    sql.NullBool{Bool: false, Valid: true},
+		}},
+		{"null", P{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := Encrypt[E](testKey, AES_256_GCM, tt.in)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			// A null value is left empty; a valid one, even holding a zero
+			// value, is encrypted.
+			if got, want := enc.On == "", !tt.in.On.Valid; got != want {
+				t.Errorf("Encrypt() On = %q, want empty %v", enc.On, want)
+			}
+			out, err := Decrypt[P](testKey, enc)
+			if err != nil || !reflect.DeepEqual(out, tt.in) {
+				t.Errorf("round trip = %+v, %v; want %+v", out, err, tt.in)
+			}
+		})
+	}
+
+	// The stored value must fit the nullable type.
+	type PNum struct{ Name sql.NullInt64 }
+	enc, err := Encrypt[E](testKey, AES_256_GCM, P{Name: sql.NullString{String: "abc", Valid: true}})
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	type ENum struct{ Name Ciphertext }
+	if _, err = Decrypt[PNum](testKey, ENum{enc.Name}); !errors.Is(err, ErrKindMismatch) {
+		t.Errorf("Decrypt() of a string into sql.NullInt64 error = %v, want ErrKindMismatch", err)
+	}
+}
+
+// twoValues is a nullable struct with more than one value field, which
+// cannot be mirrored by a single Ciphertext.
+type twoValues struct {
+	A, B  string
+	Valid bool
+}
+
+func (v twoValues) Value() (driver.Value, error) { return v.A + v.B, nil }
+func (v *twoValues) Scan(any) error              { return nil }
+
+func TestNullableSupportedTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		plain reflect.Type
+		ok    bool
+	}{
+		{"NullString", reflect.TypeFor[sql.NullString](), true},
+		{"NullInt32", reflect.TypeFor[sql.NullInt32](), true},
+		{"NullInt16", reflect.TypeFor[sql.NullInt16](), true},
+		{"NullByte", reflect.TypeFor[sql.NullByte](), true},
+		{"NullFloat64", reflect.TypeFor[sql.NullFloat64](), true},
+		{"Null[[]byte]", reflect.TypeFor[sql.Null[[]byte]](), true},
+		{"NullTime", reflect.TypeFor[sql.NullTime](), false},
+		{"Null[time.Time]", reflect.TypeFor[sql.Null[time.Time]](), false},
+		{"Null[any]", reflect.TypeFor[sql.Null[any]](), false},
+		{"two_values", reflect.TypeFor[twoValues](), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := reflect.StructOf([]reflect.StructField{{Name: "When", Type: tt.plain}})
+			enc := reflect.StructOf([]reflect.StructField{{Name: "When", Type: ciphertextType}})
+			err := CheckMirror(plain, enc)
+			if tt.ok != (err == nil) || (err != nil && !errors.Is(err, ErrUnsupportedType)) {
+				t.Errorf("CheckMirror() error = %v, want supported %t", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNullTime(t *testing.T) {
+	type P struct{ When sql.NullTime }
+	type E struct{ When Ciphertext }
+	// Rejected when the plan is compiled, whether or not the value is valid,
+	// rather than by the first valid value encrypted.
+	if err := Register[P, E](); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Register() error = %v, want ErrUnsupportedType", err)
+	}
+	var fieldErr *FieldError
+	for _, in := range []P{{}, {When: sql.NullTime{Time: time.Unix(0, 0), Valid: true}}} {
+		if _, err := Encrypt[E](testKey, AES_256_GCM, in); !errors.As(err, &fieldErr) || fieldErr.Path != "When" || !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("Encrypt(%+v) error = %v, want ErrUnsupportedType at When", in, err)
+		}
+	}
+	if _, err := Decrypt[P](testKey, E{}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Decrypt() error = %v, want ErrUnsupportedType", err)
+	}
+}
+
+func TestZeroAsEmpty(t *testing.T) {
+	type P struct {
+		Name  string
+		Count int
+		Data  []byte
+	}
+	type E struct {
+		Name  Ciphertext
+		Count Ciphertext
+		Data  Ciphertext
+	}
+	in := P{Count: 3}
+
+	enc, err := Encrypt[E](testKey, AES_256_GCM, in, WithZeroAsEmpty())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if enc.Name != "" || enc.Data != "" || enc.Count == "" {
+		t.Errorf("Encrypt() = %+v, want only Count encrypted", enc)
+	}
+	out, err := Decrypt[P](testKey, enc, WithZeroAsEmpty())
+	if err != nil || !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip = %+v, %v; want %+v", out, err, in)
+	}
+
+	// Without the option, an empty Ciphertext is not a valid field, and zero
+	// values are encrypted like any other.
+	var fieldErr *FieldError
+	if _, err = Decrypt[P](testKey, enc); !errors.As(err, &fieldErr) || fieldErr.Path != "Name" {
+		t.Errorf("Decrypt() without WithZeroAsEmpty error = %v, want a FieldError at Name", err)
+	}
+	if enc, err = Encrypt[E](testKey, AES_256_GCM, in); err != nil || enc.Name == "" {
+		t.Errorf("Encrypt() without WithZeroAsEmpty = %+v, %v", enc, err)
+	}
+
+	// Skipped fields draw no randomness in either walk.
+	matchesSequential[P, E](t, testKey, AES_256_GCM, in, WithZeroAsEmpty())
+}
+
+func TestNullableEncryptField(t *testing.T) {
+	e, err := NewEncryptor(testKey, WithZeroAsEmpty())
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	for _, v := range []any{sql.NullString{}, 0, ""} {
+		if c, err := e.EncryptField(v); err != nil || c != "" {
+			t.Errorf("EncryptField(%#v) = %q, %v; want empty", v, c, err)
+		}
+	}
+	c, err := e.EncryptField(sql.NullString{String: "s", Valid: true})
+	if err != nil {
+		t.Fatalf("EncryptField() error = %v", err)
+	}
+	if got, err := DecryptField[sql.NullString](e, c); err != nil || got != (sql.NullString{String: "s", Valid: true}) {
+		t.Errorf("DecryptField() = %+v, %v", got, err)
+	}
+	if got, err := DecryptField[int](e, ""); err != nil || got != 0 {
+		t.Errorf("DecryptField() of an empty Ciphertext = %v, %v", got, err)
+	}
+}
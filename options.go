@@ -0,0 +1,426 @@
+package transcrypt
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// Option configures optional behavior of Encrypt and Decrypt, or of an
+// Encryptor. Options are passed as trailing arguments; without any, both
+// functions behave exactly as they always have. An option that only concerns
+// one direction (e.g. WithMaxAge, which is checked on decryption) is ignored
+// by the other.
+type Option func(*options)
+
+// options holds the resolved configuration of a single Encrypt or Decrypt
+// call. The zero value is the default behavior.
+type options struct {
+	// cipherSuite is the suite new values are encrypted with; the zero value
+	// is AES_256_GCM. Decryption reads the suite from the data instead.
+	cipherSuite CipherSuite
+	encoding    Encoding
+	maxAge      time.Duration
+	// issuedAt and expiry stamp encrypted values with a validity window; an
+	// expiry implies issuedAt.
+	issuedAt bool
+	expiry   time.Duration
+	padding  Padding
+	// keyCommitment emits a key commitment on encryption and requires one on
+	// decryption.
+	keyCommitment bool
+	// keyID stamps the key's fingerprint into encrypted values and files.
+	keyID bool
+	// now is the clock used for timestamps and time-based checks; nil means
+	// time.Now.
+	now func() time.Time
+	// random is the source of salts and IVs; nil means crypto/rand.
+	random io.Reader
+	// fields holds the field paths of WithFields; nil decrypts every field.
+	fields []string
+	// concurrency is the number of workers encrypting or decrypting the
+	// leaves of a struct; 0 and 1 walk sequentially.
+	concurrency int
+	// matching relaxes how struct fields are matched to their mirror.
+	matching Matching
+	// zeroAsEmpty leaves zero struct fields as an empty Ciphertext.
+	zeroAsEmpty bool
+	// keyring holds the keys mirror field tags select by ID.
+	keyring Keyring
+	// tenant names the tenant whose keys, derived from the given ones, a
+	// call uses, if hasTenant; tenantKeys requires one.
+	tenant     string
+	hasTenant  bool
+	tenantKeys bool
+	// argon2 overrides DefaultArgon2Params for ExportKey.
+	argon2 *Argon2Params
+	// inPlace is set by EncryptInto and DecryptInto, not by an Option: a
+	// struct is walked directly into the destination, reusing its slices,
+	// maps and pointers.
+	inPlace bool
+}
+
+// newOptions applies opts over the defaults.
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// validate rejects option values that cannot be honored, so a bad option fails
+// up front rather than deep inside an encoder.
+func (o *options) validate() error {
+	if !o.encoding.isValid() {
+		return fmt.Errorf("unknown encoding: %d", o.encoding)
+	}
+	if o.maxAge < 0 {
+		return fmt.Errorf("max age must not be negative, got %s", o.maxAge)
+	}
+	if o.expiry < 0 {
+		return fmt.Errorf("expiry must not be negative, got %s", o.expiry)
+	}
+	if !o.padding.isValid() {
+		return fmt.Errorf("invalid padding %s", o.padding)
+	}
+	// Other implementations would not strip the padding from Fernet or JWE
+	// payloads, so it is only offered where this library decodes.
+	if o.padding.scheme != paddingNone && o.encoding != EncodingTranscrypt {
+		return fmt.Errorf("padding does not apply to encoding %s", o.encoding)
+	}
+	if o.fields != nil {
+		if _, err := parseSelection(o.fields); err != nil {
+			return err
+		}
+	}
+	if o.concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative, got %d", o.concurrency)
+	}
+	if o.matching&^IgnoreUnmatched != 0 {
+		return fmt.Errorf("unknown matching mode: %d", o.matching)
+	}
+	if o.keyCommitment && o.encoding != EncodingTranscrypt {
+		return fmt.Errorf("key commitment does not apply to encoding %s", o.encoding)
+	}
+	if o.keyID && o.encoding != EncodingTranscrypt {
+		return fmt.Errorf("key ID does not apply to encoding %s", o.encoding)
+	}
+	if o.hasTenant && o.tenant == "" {
+		return errors.New("tenant ID is empty")
+	}
+	if o.argon2 != nil {
+		if err := o.argon2.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rand returns the configured source of randomness.
+func (o *options) rand() io.Reader {
+	if o.random != nil {
+		return o.random
+	}
+	return rand.Reader
+}
+
+// clock returns the current time from the configured clock.
+func (o *options) clock() time.Time {
+	if o.now != nil {
+		return o.now()
+	}
+	return time.Now()
+}
+
+// WithCipherSuite selects the cipher suite an Encryptor encrypts with; the
+// default is AES_256_GCM. Encrypt takes the suite as an argument, which
+// overrides this option. Decryption always uses the suite recorded in the
+// data.
+func WithCipherSuite(c CipherSuite) Option {
+	return func(o *options) {
+		o.cipherSuite = c
+	}
+}
+
+// WithRandom replaces crypto/rand as the source of the salts and IVs drawn
+// for every encrypted value. It exists for tests that need reproducible
+// output and for injecting RNG failures; r must be cryptographically secure
+// in production, since reusing a salt under the same key reuses the derived
+// key and nonce.
+func WithRandom(r io.Reader) Option {
+	return func(o *options) {
+		o.random = r
+	}
+}
+
+// WithEncoding selects the format single values are encoded into (see
+// Encoding). Decryption must be given the same encoding the value was
+// produced with.
+func WithEncoding(e Encoding) Option {
+	return func(o *options) {
+		o.encoding = e
+	}
+}
+
+// WithMaxAge makes decryption reject values whose embedded issue time is older
+// than d with an *ExpiredError, and values without an issue time (see
+// WithIssuedAt) with a plain error. For Fernet tokens, which always carry one,
+// it is the TTL check. Zero (the default) disables the check.
+func WithMaxAge(d time.Duration) Option {
+	return func(o *options) {
+		o.maxAge = d
+	}
+}
+
+// WithIssuedAt stamps every encrypted value with its issue time, taken from
+// the clock (see WithClock) and truncated to whole seconds, so WithMaxAge can
+// enforce an age limit on decryption. The stamp is authenticated together
+// with the value and cannot be altered.
+func WithIssuedAt() Option {
+	return func(o *options) {
+		o.issuedAt = true
+	}
+}
+
+// WithExpiry stamps every encrypted value with its issue time and an expiry d
+// later. Decryption rejects the value with an *ExpiredError once the expiry
+// has passed, whether or not WithMaxAge is given. Fernet tokens cannot carry
+// an expiry.
+func WithExpiry(d time.Duration) Option {
+	return func(o *options) {
+		o.issuedAt = true
+		o.expiry = d
+	}
+}
+
+// WithPadding pads every encrypted value (and file) with the given scheme to
+// hide its exact length; see Padding. Decryption removes padding
+// automatically and needs no option. A PadToBlock size beyond 1 GiB is
+// rejected as invalid.
+func WithPadding(p Padding) Option {
+	return func(o *options) {
+		o.padding = p
+	}
+}
+
+// WithKeyCommitment makes encryption store a key commitment beside the salt
+// (see createCryptoConfig) in encoded strings and files, and makes decryption
+// require one. AES-GCM and ChaCha20-Poly1305 alone are not key-committing: a
+// crafted ciphertext can decrypt validly under two different keys, which
+// matters as soon as one value may be tried against several keys. A committed
+// value decrypted with the wrong key fails immediately with an explicit error,
+// even before a large file is streamed. Values stored without a commitment
+// stay readable without this option.
+func WithKeyCommitment() Option {
+	return func(o *options) {
+		o.keyCommitment = true
+	}
+}
+
+// WithKeyID stamps the Fingerprint of the key into encoded strings and files,
+// beside the salt. Decrypting stamped data with another key then fails
+// straight away with an error wrapping ErrAuthentication that names both
+// fingerprints, "encrypted under key X, you supplied key Y", instead of a
+// failed authentication that could as well mean tampering; Inspect and
+// InspectFile report the stamp as Info.KeyID. Decryption reads the stamp
+// whether or not this option is given.
+//
+// The stamp is not authenticated: altering it can only turn a successful
+// decryption into a failed one. It does link every value to its key for
+// anyone who sees them, so leave it off where that matters.
+func WithKeyID() Option {
+	return func(o *options) {
+		o.keyID = true
+	}
+}
+
+// WithConcurrency encrypts or decrypts the Ciphertext fields of a struct on
+// up to workers goroutines instead of one after the other, for structs with
+// many fields or long slices of records. The output is identical to a
+// sequential walk: every field lands in its place, and under a deterministic
+// random source (see WithRandom) even the ciphertexts are byte for byte the
+// same. On failure the error is the one a sequential walk reports, for the
+// first failing field in field order. The clock of WithClock may then be
+// called from several goroutines at once.
+//
+// workers of 0 or 1 walk sequentially, the default. Single values and files
+// are unaffected.
+func WithConcurrency(workers int) Option {
+	return func(o *options) {
+		o.concurrency = workers
+	}
+}
+
+// WithFields makes decrypting a struct decrypt only the fields at paths and
+// leave every other field of the result zero, for callers that need one or
+// two fields of a large record. Paths use the notation of FieldError, e.g.
+// "Email", "Address.City", "Inners[2].Note" or "Meta[k1]"; "Inners[].Note"
+// selects the Note of every element. A path selects its whole subtree.
+//
+// Fields outside the selection need not exist in the plain type, so the
+// target can be a struct holding only the selected fields:
+//
+//	type contact struct{ Email string }
+//	c, err := transcrypt.Decrypt[contact](key, secureUser, transcrypt.WithFields("Email"))
+//
+// Encryptor.Decrypt starts from the value dst points to instead, so fields
+// outside the selection keep their values. Selected fields must exist on both
+// sides and match as they would in a full decryption. Fields present on both
+// sides must map onto each other even when not selected, as the pair is
+// compiled and cached as a whole like in a full decryption. Encryption, and
+// decryption of single values and files, ignore WithFields.
+func WithFields(paths ...string) Option {
+	return func(o *options) {
+		// A non-nil empty list selects nothing, rather than everything.
+		o.fields = append(slices.Clip(o.fields), paths...)
+		if o.fields == nil {
+			o.fields = []string{}
+		}
+	}
+}
+
+// WithMatching relaxes the strict matching of struct fields to the fields of
+// their encrypted mirror, so records written under an older or newer schema
+// still decrypt, and structs still encrypt while only one side of a pair has
+// been changed. See Matching for the modes.
+func WithMatching(m Matching) Option {
+	return func(o *options) {
+		o.matching = m
+	}
+}
+
+// WithZeroAsEmpty leaves struct fields holding the zero value of their type
+// as an empty Ciphertext instead of encrypting them, and decrypts an empty
+// Ciphertext back to the zero value. An empty string then stays empty rather
+// than growing into a full ciphertext. The trade-off is that whether a field
+// is zero is visible without the key, and that an empty field carries no
+// authentication: anyone able to modify the stored record can reset such a
+// field to its zero value unnoticed. Use it on both ends.
+//
+// Nil interfaces and nullable values such as an invalid sql.NullString are
+// always left empty; single values are always encrypted.
+func WithZeroAsEmpty() Option {
+	return func(o *options) {
+		o.zeroAsEmpty = true
+	}
+}
+
+// Keyring maps key IDs to keys, for mirror fields that select their own key
+// (see WithKeyring).
+type Keyring map[string][]byte
+
+// WithKeyring provides the keys that mirror struct fields select by ID with a
+// transcrypt tag, so fields of one record can be encrypted under different
+// keys, and optionally with a different cipher suite:
+//
+//	type SecurePayment struct {
+//		Card  transcrypt.Ciphertext `transcrypt:",key=pci"`
+//		Email transcrypt.Ciphertext // the key passed to Encrypt
+//		Note  transcrypt.Ciphertext `transcrypt:",suite=CHACHA20_POLY1305"`
+//	}
+//
+// The options follow the field's matching name, if any, and apply to every
+// leaf below the field unless a nested field selects its own. Decrypting
+// reads the same tags, so every field is decrypted with the key it was
+// encrypted under; the cipher suite is read from the ciphertext. A key ID
+// missing from the keyring is an error.
+func WithKeyring(ring Keyring) Option {
+	return func(o *options) {
+		o.keyring = ring
+	}
+}
+
+// WithTenant encrypts or decrypts under the keys of tenant id: each key the
+// call would use, the one passed in and those of the keyring (see
+// WithKeyring), is replaced by a subkey derived from it for the tenant with
+// DeriveKey(key, "tenant:"+id). One master key thus serves any number of
+// tenants, while data encrypted for one tenant fails authentication under the
+// keys of every other.
+//
+// Pass it per call, to the package-level functions or to Encryptor.With:
+//
+//	tenantEnc, err := enc.With(transcrypt.WithTenant(tenantID))
+//	secure, err := transcrypt.EncryptWith[SecureAccount](tenantEnc, account)
+func WithTenant(id string) Option {
+	return func(o *options) {
+		o.tenant, o.hasTenant = id, true
+	}
+}
+
+// WithTenantKeys makes WithTenant mandatory: a call that does not name a
+// tenant fails instead of using the master key itself. Give it to an
+// Encryptor holding a master key, so that forgetting the tenant of a call
+// cannot put that tenant's data under a key shared by all of them.
+func WithTenantKeys() Option {
+	return func(o *options) {
+		o.tenantKeys = true
+	}
+}
+
+// WithArgon2 sets the Argon2id cost of the passphrase derivation of
+// ExportKey; the default is DefaultArgon2Params. Higher costs slow down
+// guessing the passphrase, and every import, alike. The parameters are
+// stored in the key file, so ImportKey needs no option; it accepts at most 8
+// passes and 1 GiB of memory, and so does WithArgon2.
+func WithArgon2(p Argon2Params) Option {
+	return func(o *options) {
+		o.argon2 = &p
+	}
+}
+
+// WithClock replaces time.Now as the source of the current time for
+// timestamps and expiry checks, e.g. to test expiry without waiting.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// Encoding defines the format a single value is encoded into.
+type Encoding byte
+
+const (
+	// EncodingTranscrypt is the library's own hex-encoded, colon-delimited
+	// format. It is the default.
+	EncodingTranscrypt Encoding = iota
+	// EncodingFernet produces and consumes Fernet tokens
+	// (https://github.com/fernet/spec), for exchanging values with other
+	// Fernet implementations such as Python's cryptography package. See
+	// fernet.go for its constraints.
+	EncodingFernet
+	// EncodingJWE produces and consumes JWE compact serializations
+	// (RFC 7516) with direct key agreement, for passing values through
+	// JOSE-aware systems. See jwe.go for its constraints.
+	EncodingJWE
+)
+
+// isValid reports whether e is one of the known encodings.
+func (e Encoding) isValid() bool {
+	switch e {
+	case EncodingTranscrypt, EncodingFernet, EncodingJWE:
+		return true
+	default:
+		return false
+	}
+}
+
+// String returns the encoding's name; an unknown value renders as
+// "Encoding(n)".
+func (e Encoding) String() string {
+	switch e {
+	case EncodingTranscrypt:
+		return "transcrypt"
+	case EncodingFernet:
+		return "fernet"
+	case EncodingJWE:
+		return "jwe"
+	default:
+		return fmt.Sprintf("Encoding(%d)", byte(e))
+	}
+}
@@ -0,0 +1,187 @@
+package transcrypt
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPadding_Size(t *testing.T) {
+	tests := []struct {
+		name    string
+		padding Padding
+		in      int64
+		want    int64
+		wantErr bool
+	}{
+		{"none", Padding{}, 13, 13, false},
+		{"block_exact", PadToBlock(16), 32, 32, false},
+		{"block_up", PadToBlock(16), 33, 48, false},
+		{"block_zero", PadToBlock(16), 0, 0, false},
+		{"pow2_small", PadToPowerOfTwo(), 1, 1, false},
+		{"pow2_exact", PadToPowerOfTwo(), 64, 64, false},
+		{"pow2_up", PadToPowerOfTwo(), 65, 128, false},
+		{"padme_tiny", PadPadme(), 2, 2, false},
+		{"padme_exact", PadPadme(), 64, 64, false},
+		{"padme_up", PadPadme(), 65, 72, false},
+		{"padme_large", PadPadme(), 1_000_000, 1_015_808, false},
+		{"block_max", PadToBlock(maxPaddingBlock), math.MaxInt64 - maxPaddingBlock, math.MaxInt64 - maxPaddingBlock + 1, false},
+		{"block_overflow", PadToBlock(maxPaddingBlock), math.MaxInt64 - 10, 0, true},
+		{"pow2_max", PadToPowerOfTwo(), 1 << 62, 1 << 62, false},
+		{"pow2_overflow", PadToPowerOfTwo(), 1<<62 + 1, 0, true},
+		{"padme_overflow", PadPadme(), math.MaxInt64 - 10, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.padding.size(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("size(%d) = %d, %v; want %d, error %t", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestPadding_PadmeOverhead pins Padmé's defining bound: never more than 12%
+// overhead.
+func TestPadding_PadmeOverhead(t *testing.T) {
+	for n := int64(1); n < 1<<16; n += 7 {
+		if got, _ := PadPadme().size(n); got < n || float64(got-n)/float64(n) > 0.12 {
+			t.Fatalf("size(%d) = %d exceeds the 12%% overhead bound", n, got)
+		}
+	}
+}
+
+func TestPadding_BlockBound(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		valid bool
+	}{
+		{"zero", 0, false},
+		{"negative", -16, false},
+		{"max", maxPaddingBlock, true},
+		{"above_max", maxPaddingBlock + 1, false},
+		{"max_int", math.MaxInt, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEncryptor(testKey, WithPadding(PadToBlock(tt.size)))
+			if (err == nil) != tt.valid {
+				t.Errorf("NewEncryptor() error = %v, want valid %t", err, tt.valid)
+			}
+			// Encrypt rejects an invalid size rather than padding; a valid
+			// one would pad to the full block.
+			if tt.valid {
+				return
+			}
+			if _, err = Encrypt[string](testKey, AES_256_GCM, "v", WithPadding(PadToBlock(tt.size))); err == nil {
+				t.Error("Encrypt() with an invalid block size error = nil")
+			}
+		})
+	}
+}
+
+func TestPadding_HidesValueLength(t *testing.T) {
+	short, err := Encrypt[string](testKey, AES_256_GCM, true, WithPadding(PadToBlock(64)))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	long, err := Encrypt[string](testKey, AES_256_GCM, "a longer string value", WithPadding(PadToBlock(64)))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if len(short) != len(long) {
+		t.Errorf("padded ciphertexts differ in length: %d vs %d", len(short), len(long))
+	}
+}
+
+func TestPadding_RoundTrip(t *testing.T) {
+	schemes := []Padding{PadToBlock(32), PadToPowerOfTwo(), PadPadme()}
+	values := []any{"", "hello", true, int64(-7), uint8(1), 2.5, complex64(1), []byte{0, 1, 2}}
+	for _, p := range schemes {
+		for _, in := range values {
+			enc, err := Encrypt[string](testKey, AES_256_GCM, in, WithPadding(p))
+			if err != nil {
+				t.Fatalf("%s: Encrypt(%T) error = %v", p, in, err)
+			}
+			// Padding is removed without any option on decryption.
+			got, err := Decrypt[any](testKey, enc)
+			if err != nil {
+				t.Fatalf("%s: Decrypt(%T) error = %v", p, in, err)
+			}
+			if !reflect.DeepEqual(got, in) {
+				t.Errorf("%s: round trip = %v (%T), want %v (%T)", p, got, got, in, in)
+			}
+		}
+	}
+}
+
+func TestPadding_InvalidOptions(t *testing.T) {
+	if _, err := Encrypt[string](testKey, AES_256_GCM, "x", WithPadding(PadToBlock(0))); err == nil {
+		t.Error("Encrypt() with a zero block size expected error")
+	}
+	if _, err := Encrypt[string](jweTestKey, AES_256_GCM, "x", WithEncoding(EncodingJWE), WithPadding(PadPadme())); err == nil {
+		t.Error("Encrypt() with padding under JWE expected error")
+	}
+}
+
+func TestPadding_File(t *testing.T) {
+	dir := t.TempDir()
+	sizes := []int{0, 1, 1000, 70_000}
+	var encryptedSizes []int64
+	for _, n := range sizes {
+		content := patternBytes(n)
+		src := writeTestFile(t, dir, "plain", content)
+		enc := filepath.Join(dir, "enc")
+		dec := filepath.Join(dir, "dec")
+
+		if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: enc}, WithPadding(PadToBlock(1<<17))); err != nil {
+			t.Fatalf("size %d: Encrypt() error = %v", n, err)
+		}
+		info, err := os.Stat(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encryptedSizes = append(encryptedSizes, info.Size())
+
+		if _, err = Decrypt[File](fileTestKey, File{Source: enc, Target: dec}); err != nil {
+			t.Fatalf("size %d: Decrypt() error = %v", n, err)
+		}
+		got, err := os.ReadFile(dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("size %d: round trip mismatch", n)
+		}
+	}
+	for i, size := range encryptedSizes {
+		if size != encryptedSizes[0] {
+			t.Errorf("encrypted size for %d bytes = %d, want %d like the others", sizes[i], size, encryptedSizes[0])
+		}
+	}
+	assertNoTempLitter(t, dir)
+}
+
+func TestPadding_FileTruncatedPaddingFails(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", []byte("short content"))
+	enc := filepath.Join(dir, "enc")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: enc}, WithPadding(PadToBlock(1<<17))); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	// Dropping the last DARE package (which holds only padding) must still
+	// fail authentication even though the content itself is intact.
+	data, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := writeTestFile(t, dir, "truncated", data[:len(data)-100])
+	if _, err = Decrypt[File](fileTestKey, File{Source: truncated, Target: filepath.Join(dir, "dec")}); err == nil {
+		t.Error("Decrypt() of a file with truncated padding expected error")
+	}
+}
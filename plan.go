@@ -0,0 +1,301 @@
+package transcrypt
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// A plan is the compiled mapping between a plain type and its encrypted
+// mirror. Compiling it validates the whole pair up front — matching fields,
+// kinds, array lengths, map keys and leaf types — so a mismatch surfaces as
+// soon as the pair is first used (or registered, see Register) rather than
+// only when data happens to flow through the offending field. The walkers in
+// encryptStruct.go and decryptStruct.go then follow the plan without
+// rediscovering the mapping by reflection on every call.
+//
+// Plans are immutable once compiled and cached per type pair for the life of
+// the process. The same plan serves both directions.
+type plan struct {
+	kind  planKind
+	plain reflect.Type
+	enc   reflect.Type
+	// elem is the plan for the element of a slice, array, map or pointer.
+	elem *plan
+	// fields maps the exported fields of a struct pair, in the plain
+	// struct's field order.
+	fields []fieldPlan
+	// byName indexes fields by their matching name, for WithFields.
+	byName map[string]int
+}
+
+type planKind byte
+
+const (
+	// planCopy copies identical types verbatim.
+	planCopy planKind = iota
+	// planLeaf encrypts a plain value into a Ciphertext.
+	planLeaf
+	planStruct
+	planSlice
+	planArray
+	planMap
+	planPointer
+	// planInterface walks the dynamic value of an interface pair, see
+	// interface.go.
+	planInterface
+)
+
+// fieldPlan maps one field of a struct pair. The indices are index
+// sequences, as promoted fields are reached through embedded structs.
+type fieldPlan struct {
+	name       string
+	plainIndex []int
+	encIndex   []int
+	plan       *plan
+	// key is the key and cipher suite selected by the mirror field's tag,
+	// or nil.
+	key *fieldKey
+}
+
+// planKey identifies a cached plan.
+type planKey struct {
+	plain    reflect.Type
+	enc      reflect.Type
+	matching Matching
+}
+
+// plans caches compiled plans by planKey.
+var plans sync.Map
+
+// mirrors and plainsByMirror map registered struct types to their mirror and
+// back, so interface fields can find the counterpart of their dynamic value
+// (see interface.go). The first pair registered for a type wins.
+var mirrors, plainsByMirror sync.Map
+
+// Register validates the plain struct type P against its encrypted mirror E
+// and caches the compiled mapping, so a mismatch between the two fails at
+// startup instead of when a record first flows through the mismatched field.
+// Encrypt and Decrypt compile and cache the pair on first use anyway;
+// registering only moves that work, and its errors, up front:
+//
+//	func init() {
+//		if err := transcrypt.Register[Account, SecureAccount](); err != nil {
+//			panic(err)
+//		}
+//	}
+//
+// Registering also tells the walkers how to encrypt a P, or a *P, held by an
+// interface field: into an E (or *E) in the mirror's interface field, and
+// back. Only the first mirror registered for a type is used this way.
+//
+// opts select the matching mode to validate for (see WithMatching); other
+// options are ignored. Errors about a particular field are *FieldError
+// values carrying its path, with "[]" standing for any slice, array or map
+// element.
+func Register[P, E any](opts ...Option) error {
+	return CheckMirror(reflect.TypeOf((*P)(nil)).Elem(), reflect.TypeOf((*E)(nil)).Elem(), opts...)
+}
+
+// CheckMirror is Register for types known only at run time.
+func CheckMirror(plainType, encType reflect.Type, opts ...Option) error {
+	if plainType == nil || encType == nil {
+		return fmt.Errorf("%w: types must not be nil", ErrUnsupportedType)
+	}
+	if plainType.Kind() != reflect.Struct || encType.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: plain type %s and encrypted type %s must both be structs", ErrUnsupportedType, plainType, encType)
+	}
+	if plainType == encType {
+		return fmt.Errorf("%w: encrypted type %s is the plain type itself: nothing would be encrypted", ErrUnsupportedType, encType)
+	}
+	o := newOptions(opts)
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if _, err := planFor(plainType, encType, o.matching); err != nil {
+		return err
+	}
+	mirrors.LoadOrStore(plainType, encType)
+	plainsByMirror.LoadOrStore(encType, plainType)
+	return nil
+}
+
+// planFor returns the cached plan for a type pair under a matching mode,
+// compiling it on first use. Only successful compilations are cached, so a
+// mismatched pair reports its error on every call.
+func planFor(plainType, encType reflect.Type, matching Matching) (*plan, error) {
+	key := planKey{plainType, encType, matching}
+	if p, ok := plans.Load(key); ok {
+		return p.(*plan), nil
+	}
+	p, err := compilePlan(plainType, encType, matching, "", make(map[planKey]*plan))
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := plans.LoadOrStore(key, p)
+	return actual.(*plan), nil
+}
+
+// compilePlan builds the plan for a type pair. compiling holds the plans of
+// the struct pairs currently being compiled, so recursive types (a struct
+// reaching itself through a pointer, slice or map) refer back to their own
+// plan instead of recursing forever.
+func compilePlan(plainType, encType reflect.Type, matching Matching, path string, compiling map[planKey]*plan) (*plan, error) {
+	// Interface pairs, identical or not, are walked by their dynamic values:
+	// copying an any verbatim would leave whatever it holds unencrypted.
+	if plainType.Kind() == reflect.Interface && encType.Kind() == reflect.Interface {
+		return &plan{kind: planInterface, plain: plainType, enc: encType}, nil
+	}
+
+	// Identical types are copied verbatim, unless they reach an interface
+	// whose dynamic value needs walking. This is checked before the
+	// Ciphertext leaf case so a Ciphertext-typed field appearing on both
+	// sides is copied, not encrypted a second time.
+	if plainType == encType && !holdsInterface(plainType, nil) {
+		return &plan{kind: planCopy, plain: plainType, enc: encType}, nil
+	}
+
+	if encType == ciphertextType {
+		if isNullable(plainType) && !nullableLeaf(plainType) {
+			return nil, pathErrorf(path, "%w: nullable %s cannot be encrypted into a single Ciphertext: it needs a Valid bool and one value field of a kind Encrypt supports", ErrUnsupportedType, plainType)
+		}
+		if !isLeafType(plainType) && !isNullable(plainType) {
+			return nil, pathErrorf(path, "%w: %s cannot be encrypted into a single Ciphertext; mirror it with a matching composite type", ErrUnsupportedType, plainType)
+		}
+		return &plan{kind: planLeaf, plain: plainType, enc: encType}, nil
+	}
+
+	if plainType.Kind() != encType.Kind() {
+		return nil, pathErrorf(path, "%w: cannot map plain type %s to encrypted type %s", ErrKindMismatch, plainType, encType)
+	}
+
+	p := &plan{plain: plainType, enc: encType}
+	var err error
+	switch plainType.Kind() {
+	case reflect.Struct:
+		key := planKey{plainType, encType, matching}
+		if inProgress, ok := compiling[key]; ok {
+			return inProgress, nil
+		}
+		p.kind = planStruct
+		compiling[key] = p
+		err = compileFields(p, matching, path, compiling)
+		delete(compiling, key)
+	case reflect.Slice:
+		p.kind = planSlice
+		p.elem, err = compilePlan(plainType.Elem(), encType.Elem(), matching, joinPath(path, "[]"), compiling)
+	case reflect.Array:
+		if plainType.Len() != encType.Len() {
+			return nil, pathErrorf(path, "%w: array length mismatch: plain %d, encrypted %d", ErrKindMismatch, plainType.Len(), encType.Len())
+		}
+		p.kind = planArray
+		p.elem, err = compilePlan(plainType.Elem(), encType.Elem(), matching, joinPath(path, "[]"), compiling)
+	case reflect.Map:
+		if plainType.Key() != encType.Key() {
+			return nil, pathErrorf(path, "%w: map key types must be identical (keys are never encrypted): plain %s, encrypted %s", ErrKindMismatch, plainType.Key(), encType.Key())
+		}
+		p.kind = planMap
+		p.elem, err = compilePlan(plainType.Elem(), encType.Elem(), matching, joinPath(path, "[]"), compiling)
+	case reflect.Pointer:
+		p.kind = planPointer
+		p.elem, err = compilePlan(plainType.Elem(), encType.Elem(), matching, path, compiling)
+	default:
+		return nil, pathErrorf(path, "%w: cannot map plain type %s to encrypted type %s", ErrKindMismatch, plainType, encType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// compileFields matches the fields of a struct pair by their matching names
+// (see fieldName). Matching is strict in both directions unless the matching
+// mode ignores unmatched fields on a side, so by default no exported field can
+// be dropped silently.
+func compileFields(p *plan, matching Matching, path string, compiling map[planKey]*plan) error {
+	plainFields, plainByName, err := structFields(p.plain)
+	if err != nil {
+		return pathErrorf(path, "%w", err)
+	}
+	encFields, encByName, err := structFields(p.enc)
+	if err != nil {
+		return pathErrorf(path, "%w", err)
+	}
+	for _, f := range plainFields {
+		fieldPath := joinPath(path, f.name)
+		e, ok := encByName[f.name]
+		if !ok {
+			if matching&IgnoreUnmatchedPlain != 0 {
+				continue
+			}
+			return pathErrorf(fieldPath, "plain struct %s has no matching field in encrypted struct %s", p.plain, p.enc)
+		}
+		encIndex := encFields[e].index
+
+		key, err := fieldKeyAt(p.enc, encIndex)
+		if err != nil {
+			return pathErrorf(fieldPath, "%w", err)
+		}
+		fp, err := compilePlan(fieldType(p.plain, f.index), fieldType(p.enc, encIndex), matching, fieldPath, compiling)
+		if err != nil {
+			return err
+		}
+		if p.byName == nil {
+			p.byName = make(map[string]int)
+		}
+		p.byName[f.name] = len(p.fields)
+		p.fields = append(p.fields, fieldPlan{name: f.name, plainIndex: f.index, encIndex: encIndex, plan: fp, key: key})
+	}
+
+	if matching&IgnoreUnmatchedEncrypted != 0 {
+		return nil
+	}
+	// Report the first unmatched encrypted field in index order, so the
+	// error is deterministic.
+	for _, f := range encFields {
+		if _, matched := plainByName[f.name]; !matched {
+			return pathErrorf(joinPath(path, f.name), "encrypted struct %s has no matching field in plain struct %s", p.enc, p.plain)
+		}
+	}
+	return nil
+}
+
+// holdsInterface reports whether t is an interface type or a pointer,
+// slice, array or map reaching one. Structs are not looked into: an
+// identical struct type on both sides is copied verbatim. seen guards
+// against recursive types such as type T []T.
+func holdsInterface(t reflect.Type, seen map[reflect.Type]bool) bool {
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		if seen[t] {
+			return false
+		}
+		if seen == nil {
+			seen = make(map[reflect.Type]bool)
+		}
+		seen[t] = true
+		return holdsInterface(t.Elem(), seen)
+	default:
+		return false
+	}
+}
+
+// isLeafType reports whether values of type t can be encrypted into a single
+// Ciphertext: the kinds convertValueToHexString supports, or an interface
+// whose dynamic value is checked when encrypted.
+func isLeafType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128,
+		reflect.String, reflect.Interface:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	default:
+		return false
+	}
+}
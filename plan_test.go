@@ -0,0 +1,172 @@
+package transcrypt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	if err := Register[Outer, SecureOuter](); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	p, ok := plans.Load(planKey{reflect.TypeOf(Outer{}), reflect.TypeOf(SecureOuter{}), MatchStrict})
+	if !ok {
+		t.Fatal("Register() did not cache the plan")
+	}
+	// Encrypt and Decrypt use the cached plan rather than compiling their own.
+	cached, err := planFor(reflect.TypeOf(Outer{}), reflect.TypeOf(SecureOuter{}), MatchStrict)
+	if err != nil || cached != p.(*plan) {
+		t.Errorf("planFor() = %p, %v; want the registered plan %p", cached, err, p)
+	}
+
+	enc, err := Encrypt[SecureOuter](testKey, AES_256_GCM, testOuter())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	dec, err := Decrypt[Outer](testKey, enc)
+	if err != nil || !reflect.DeepEqual(dec, testOuter()) {
+		t.Errorf("round trip = %+v, %v", dec, err)
+	}
+}
+
+func TestRegister_Errors(t *testing.T) {
+	type Leaf struct{ N int }
+	type LeafWrongKind struct{ N []string }
+	type LeafMissing struct{}
+	type LeafExtra struct {
+		N     Ciphertext
+		Extra Ciphertext
+	}
+	// The mismatch sits inside the element of a slice: it is reported even
+	// though no value, let alone a non-empty slice, was ever encrypted.
+	type PList struct{ Items []Leaf }
+	type EList struct{ Items []LeafWrongKind }
+	type PMap struct{ M map[string]Leaf }
+	type EMap struct{ M map[int]LeafExtra }
+	type PArray struct{ A [2]string }
+	type EArray struct{ A [3]Ciphertext }
+	type PComposite struct{ Inner Inner }
+	type EComposite struct{ Inner Ciphertext }
+	type EMissing struct{ Items []LeafMissing }
+
+	tests := []struct {
+		name  string
+		check func(...Option) error
+		path  string
+		want  error
+	}{
+		{"slice_element", Register[PList, EList], "Items[].N", ErrKindMismatch},
+		{"missing_field", Register[PList, EMissing], "Items[].N", nil},
+		{"map_key", Register[PMap, EMap], "M", ErrKindMismatch},
+		{"array_length", Register[PArray, EArray], "A", ErrKindMismatch},
+		{"composite_leaf", Register[PComposite, EComposite], "Inner", ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check()
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Path != tt.path {
+				t.Fatalf("Register() error = %v, want a FieldError at %q", err, tt.path)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Register() error = %v, want %v", err, tt.want)
+			}
+			// Failed compilations are not cached, so the error repeats.
+			if again := tt.check(); again == nil || again.Error() != err.Error() {
+				t.Errorf("second Register() error = %v, want %v", again, err)
+			}
+		})
+	}
+
+	// Encrypt reports the same mismatch for an empty value.
+	if _, err := Encrypt[EList](testKey, AES_256_GCM, PList{}); !errors.Is(err, ErrKindMismatch) {
+		t.Errorf("Encrypt() of an empty value error = %v, want ErrKindMismatch", err)
+	}
+}
+
+func TestRegister_RecursiveTypes(t *testing.T) {
+	type PTree struct {
+		Note     string
+		Children []PTree
+		Parent   *PTree
+		Index    map[string]*PTree
+	}
+	type ETree struct {
+		Note     Ciphertext
+		Children []ETree
+		Parent   *ETree
+		Index    map[string]*ETree
+	}
+	if err := Register[PTree, ETree](); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	in := PTree{Note: "root", Children: []PTree{{Note: "leaf"}}, Index: map[string]*PTree{"x": {Note: "x"}}}
+	enc, err := Encrypt[ETree](testKey, AES_256_GCM, in)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	dec, err := Decrypt[PTree](testKey, enc)
+	if err != nil || !reflect.DeepEqual(dec, in) {
+		t.Errorf("round trip = %+v, %v; want %+v", dec, err, in)
+	}
+}
+
+func TestCheckMirror_Validation(t *testing.T) {
+	tests := []struct {
+		name       string
+		plain, enc reflect.Type
+	}{
+		{"nil", nil, reflect.TypeOf(SecureInner{})},
+		{"not_struct", reflect.TypeOf(""), reflect.TypeOf(Ciphertext(""))},
+		{"pointer", reflect.TypeOf(&Inner{}), reflect.TypeOf(&SecureInner{})},
+		{"identical", reflect.TypeOf(Inner{}), reflect.TypeOf(Inner{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckMirror(tt.plain, tt.enc); !errors.Is(err, ErrUnsupportedType) {
+				t.Errorf("CheckMirror() error = %v, want ErrUnsupportedType", err)
+			}
+		})
+	}
+	if err := CheckMirror(reflect.TypeOf(Inner{}), reflect.TypeOf(SecureInner{})); err != nil {
+		t.Errorf("CheckMirror() error = %v", err)
+	}
+}
+
+// BenchmarkPlan compares struct encryption and decryption through the
+// cached plan with a cold cache, which compiles the plan on every call.
+func BenchmarkPlan(b *testing.B) {
+	in := testOuter()
+	enc, err := Encrypt[SecureOuter](testKey, AES_256_GCM, in)
+	if err != nil {
+		b.Fatalf("Encrypt() error = %v", err)
+	}
+	for _, cached := range []bool{true, false} {
+		name := "uncached"
+		if cached {
+			name = "cached"
+		}
+		b.Run(name+"/encrypt", func(b *testing.B) {
+			for b.Loop() {
+				if !cached {
+					plans.Clear()
+				}
+				if _, err := Encrypt[SecureOuter](testKey, AES_256_GCM, in); err != nil {
+					b.Fatalf("Encrypt() error = %v", err)
+				}
+			}
+		})
+		b.Run(name+"/decrypt", func(b *testing.B) {
+			for b.Loop() {
+				if !cached {
+					plans.Clear()
+				}
+				if _, err := Decrypt[Outer](testKey, enc); err != nil {
+					b.Fatalf("Decrypt() error = %v", err)
+				}
+			}
+		})
+	}
+}
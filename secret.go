@@ -0,0 +1,113 @@
+package transcrypt
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Secret holds key material outside the Go heap, in memory that is locked
+// against being swapped to disk and fenced by inaccessible guard pages, so a
+// stray read or write past either end faults instead of leaking or
+// corrupting the key. Destroy zeroes and releases it.
+//
+// A Secret is a []byte underneath, so it can be passed anywhere a key is
+// accepted, including Keyring entries and NewEncryptor, without copying it
+// back onto the heap:
+//
+//	key, err := transcrypt.CreateSecret(32)
+//	if err != nil {
+//		return err
+//	}
+//	defer key.Destroy()
+//	secure, err := transcrypt.Encrypt[SecureAccount](key, transcrypt.AES_256_GCM, account)
+//
+// The memory is released by Destroy, not by the garbage collector: a Secret
+// that is never destroyed stays locked for the life of the process. Neither
+// the Secret nor any slice of it may be used after Destroy; doing so faults
+// rather than quietly encrypting under a zeroed key. Only the key is
+// protected this way: values derived from it during encryption, and the
+// plaintexts passed in or decrypted, live in ordinary memory.
+//
+// Secrets are only available on Unix systems; elsewhere the constructors
+// return an error wrapping errors.ErrUnsupported.
+type Secret []byte
+
+// secrets maps the first byte of each live Secret to its whole mapping,
+// guard pages included, so Destroy can release it.
+var secrets sync.Map
+
+// NewSecret returns a zeroed Secret of size bytes.
+func NewSecret(size int) (Secret, error) {
+	if size < 1 {
+		return nil, errors.New("secret size must be at least 1")
+	}
+	mem, data, err := lockedAlloc(size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate locked memory: %w", err)
+	}
+	secrets.Store(&data[0], mem)
+	return Secret(data), nil
+}
+
+// NewSecretFrom copies key into a new Secret and clears key with ClearKey, so
+// a key read from a file or environment variable does not linger on the heap.
+func NewSecretFrom(key []byte) (Secret, error) {
+	s, err := NewSecret(len(key))
+	if err != nil {
+		return nil, err
+	}
+	copy(s, key)
+	ClearKey(key)
+	return s, nil
+}
+
+// CreateSecret is CreateKey returning a Secret: byteSize cryptographically
+// secure random bytes, read directly into locked memory.
+func CreateSecret(byteSize int) (Secret, error) {
+	return CreateSecretFrom(rand.Reader, byteSize)
+}
+
+// CreateSecretFrom is CreateSecret reading from random instead of
+// crypto/rand; see CreateKeyFrom.
+func CreateSecretFrom(random io.Reader, byteSize int) (Secret, error) {
+	if byteSize < 16 {
+		return nil, errors.New("byte size must be at least 16")
+	}
+	s, err := NewSecret(byteSize)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(random, s); err != nil {
+		_ = s.Destroy()
+		return nil, fmt.Errorf("failed to read random data for key: %w", err)
+	}
+	return s, nil
+}
+
+// Destroy zeroes s, unlocks it and releases its memory. It returns an error
+// if s was not returned by one of the Secret constructors, or was already
+// destroyed.
+func (s Secret) Destroy() error {
+	if len(s) == 0 {
+		return errors.New("secret is empty")
+	}
+	mem, ok := secrets.LoadAndDelete(&s[0])
+	if !ok {
+		return errors.New("secret was already destroyed or not created by NewSecret")
+	}
+	ClearKey(s)
+	return lockedFree(mem.([]byte))
+}
+
+// String redacts s, so a Secret logged by mistake does not print the key.
+func (s Secret) String() string {
+	return "transcrypt.Secret(redacted)"
+}
+
+// GoString redacts s for the %#v verb.
+func (s Secret) GoString() string {
+	return s.String()
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package transcrypt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// lockedAlloc fails: locking memory needs golang.org/x/sys/unix.
+func lockedAlloc(size int) (mem, data []byte, err error) {
+	return nil, nil, fmt.Errorf("%w: locked memory needs a Unix system", errors.ErrUnsupported)
+}
+
+// lockedFree is never reached, as lockedAlloc always fails.
+func lockedFree(mem []byte) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,126 @@
+package transcrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jantytgat/go-transcrypt/transcrypttest"
+)
+
+// newTestSecret returns a Secret holding key, skipping the test where locked
+// memory is unavailable.
+func newTestSecret(t *testing.T, key []byte) Secret {
+	t.Helper()
+	s, err := NewSecretFrom(bytes.Clone(key))
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("locked memory is not supported on this system")
+	}
+	if err != nil {
+		t.Fatalf("NewSecretFrom() error = %v", err)
+	}
+	return s
+}
+
+func TestSecretAsKey(t *testing.T) {
+	s := newTestSecret(t, testKey)
+	defer s.Destroy()
+
+	// Ciphertext under the Secret decrypts under the plain key, and back.
+	enc, err := Encrypt[string](s, AES_256_GCM, "v")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if got, err := Decrypt[string](testKey, enc); err != nil || got != "v" {
+		t.Errorf("Decrypt() = %q, %v", got, err)
+	}
+
+	e, err := NewEncryptor(s)
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	if got, err := DecryptWith[string](e, enc); err != nil || got != "v" {
+		t.Errorf("DecryptWith() = %q, %v", got, err)
+	}
+
+	type P struct{ A string }
+	type E struct {
+		A Ciphertext `transcrypt:",key=k"`
+	}
+	out, err := Encrypt[E](testKey, AES_256_GCM, P{"a"}, WithKeyring(Keyring{"k": s}))
+	if err != nil {
+		t.Fatalf("Encrypt() with a Secret in the keyring error = %v", err)
+	}
+	if got, err := Decrypt[string](testKey, out.A); err != nil || got != "a" {
+		t.Errorf("Decrypt() = %q, %v", got, err)
+	}
+}
+
+func TestSecretConstructors(t *testing.T) {
+	key := bytes.Clone(testKey)
+	s := newTestSecret(t, key)
+	if !bytes.Equal(s, testKey) {
+		t.Error("NewSecretFrom() does not hold the key")
+	}
+	if err := s.Destroy(); err != nil {
+		t.Errorf("Destroy() error = %v", err)
+	}
+
+	if s, err := NewSecretFrom(key); err == nil {
+		s.Destroy()
+	}
+	if !bytes.Equal(key, make([]byte, len(key))) {
+		t.Error("NewSecretFrom() did not clear its argument")
+	}
+
+	a, err := CreateSecretFrom(transcrypttest.NewReader("k"), 32)
+	if err != nil {
+		t.Fatalf("CreateSecretFrom() error = %v", err)
+	}
+	defer a.Destroy()
+	if b, _ := CreateKeyFrom(transcrypttest.NewReader("k"), 32); !bytes.Equal(a, b) {
+		t.Error("CreateSecretFrom() differs from CreateKeyFrom() on the same source")
+	}
+
+	if _, err = CreateSecret(8); err == nil {
+		t.Error("CreateSecret(8) error = nil, want a size error")
+	}
+	if _, err = NewSecret(0); err == nil {
+		t.Error("NewSecret(0) error = nil, want a size error")
+	}
+	failing := transcrypttest.FailingReader(transcrypttest.NewReader("k"), 4, errors.New("boom"))
+	if _, err = CreateSecretFrom(failing, 32); err == nil {
+		t.Error("CreateSecretFrom() with a failing reader error = nil")
+	}
+}
+
+func TestSecretDestroy(t *testing.T) {
+	s := newTestSecret(t, testKey)
+	if err := s.Destroy(); err != nil {
+		t.Fatalf("Destroy() error = %v", err)
+	}
+	if err := s.Destroy(); err == nil {
+		t.Error("second Destroy() error = nil")
+	}
+	if err := Secret(bytes.Clone(testKey)).Destroy(); err == nil {
+		t.Error("Destroy() of a heap slice error = nil")
+	}
+	if err := Secret(nil).Destroy(); err == nil {
+		t.Error("Destroy() of a nil Secret error = nil")
+	}
+}
+
+func TestSecretRedacted(t *testing.T) {
+	key := []byte("do not print me!")
+	s := newTestSecret(t, key)
+	defer s.Destroy()
+	for _, format := range []string{"%v", "%s", "%q", "%x", "%#v"} {
+		got := fmt.Sprintf(format, s)
+		if strings.Contains(got, string(key)) || strings.Contains(got, hex.EncodeToString(key)) || strings.Contains(got, "100") {
+			t.Errorf("Sprintf(%q) = %q reveals the key", format, got)
+		}
+	}
+}
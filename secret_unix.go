@@ -0,0 +1,43 @@
+//go:build unix
+
+package transcrypt
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockedAlloc maps size bytes of locked memory between two guard pages. data
+// ends where the trailing guard page starts, so an overrun faults on its
+// first byte; mem is the whole mapping, for lockedFree.
+func lockedAlloc(size int) (mem, data []byte, err error) {
+	page := unix.Getpagesize()
+	inner := (size + page - 1) / page * page
+	mem, err = unix.Mmap(-1, 0, inner+2*page, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mmap: %w", err)
+	}
+	fail := func(op string, err error) ([]byte, []byte, error) {
+		return nil, nil, errors.Join(fmt.Errorf("%s: %w", op, err), unix.Munmap(mem))
+	}
+	if err = unix.Mprotect(mem[:page], unix.PROT_NONE); err != nil {
+		return fail("mprotect", err)
+	}
+	if err = unix.Mprotect(mem[page+inner:], unix.PROT_NONE); err != nil {
+		return fail("mprotect", err)
+	}
+	if err = unix.Mlock(mem[page : page+inner]); err != nil {
+		return fail("mlock (see RLIMIT_MEMLOCK)", err)
+	}
+	end := page + inner
+	return mem, mem[end-size : end : end], nil
+}
+
+// lockedFree unlocks and unmaps a mapping made by lockedAlloc. The caller
+// zeroes the data first.
+func lockedFree(mem []byte) error {
+	page := unix.Getpagesize()
+	return errors.Join(unix.Munlock(mem[page:len(mem)-page]), unix.Munmap(mem))
+}
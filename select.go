@@ -0,0 +1,351 @@
+package transcrypt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// selection is the parsed form of the field paths given to WithFields: a tree
+// following the paths from the top-level struct. A node marked all selects
+// its whole subtree; otherwise only its children are selected.
+type selection struct {
+	all bool
+	// fields holds the selected struct fields by name.
+	fields map[string]*selection
+	// elems holds the selected slice, array or map elements by index or key,
+	// as written between the brackets; "" is the wildcard "[]".
+	elems map[string]*selection
+}
+
+// parseSelection parses field paths in the notation of FieldError: field
+// names joined by dots, and indices or map keys in brackets, e.g.
+// "Inners[2].Note" or "Meta[k1]". An empty bracket pair selects every
+// element, as in "Inners[].Note". Map keys cannot contain ']'.
+func parseSelection(paths []string) (*selection, error) {
+	root := &selection{}
+	for _, path := range paths {
+		node := root
+		rest := path
+		if rest == "" {
+			return nil, errors.New("field path is empty")
+		}
+		for first := true; rest != ""; first = false {
+			var next *selection
+			switch {
+			case rest[0] == '[':
+				if first {
+					return nil, fmt.Errorf("field path %q must start with a field name", path)
+				}
+				end := strings.IndexByte(rest, ']')
+				if end < 0 {
+					return nil, fmt.Errorf("field path %q has an unterminated '['", path)
+				}
+				next = child(&node.elems, rest[1:end])
+				rest = rest[end+1:]
+			default:
+				if !first {
+					if rest[0] != '.' {
+						return nil, fmt.Errorf("field path %q has no '.' before %q", path, rest)
+					}
+					rest = rest[1:]
+				}
+				end := strings.IndexAny(rest, ".[")
+				if end < 0 {
+					end = len(rest)
+				}
+				if end == 0 {
+					return nil, fmt.Errorf("field path %q has an empty field name", path)
+				}
+				next = child(&node.fields, rest[:end])
+				rest = rest[end:]
+			}
+			node = next
+		}
+		node.all = true
+	}
+	return root, nil
+}
+
+// child returns the child named name in m, creating it if needed.
+func child(m *map[string]*selection, name string) *selection {
+	if *m == nil {
+		*m = make(map[string]*selection)
+	}
+	if (*m)[name] == nil {
+		(*m)[name] = &selection{}
+	}
+	return (*m)[name]
+}
+
+// union returns the selection of everything a or b selects; either may be
+// nil. Overlapping paths such as "Items[]" and "Items[2].Note" are merged
+// this way, so every element is walked, and every leaf decrypted, once.
+func union(a, b *selection) *selection {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.all || b.all:
+		return &selection{all: true}
+	}
+	u := &selection{}
+	for _, m := range []struct{ dst, a, b *map[string]*selection }{
+		{&u.fields, &a.fields, &b.fields},
+		{&u.elems, &a.elems, &b.elems},
+	} {
+		for name, c := range *m.a {
+			*child(m.dst, name) = *union(c, (*m.b)[name])
+		}
+		for name, c := range *m.b {
+			if _, done := (*m.a)[name]; !done {
+				*child(m.dst, name) = *c
+			}
+		}
+	}
+	return u
+}
+
+// selectDecrypt decrypts the selected parts of enc into dst, which holds the
+// plain value to start from: the zero value, or the caller's value when
+// decrypting into one. Only the selected fields are written. Containers
+// on the way to them are copied before being written, so the starting value
+// is never modified through shared slices, maps or pointers. Fields outside
+// the selection need not exist in either type, so dst may have a type
+// holding only the selected fields.
+func (w *structWalk) selectDecrypt(sel *selection, enc, dst reflect.Value, path string) error {
+	if sel.all {
+		p, err := planFor(dst.Type(), enc.Type(), w.o.matching)
+		if err != nil {
+			return PrefixPath(err, path)
+		}
+		dst.SetZero()
+		return w.decrypt(p, enc, dst, path)
+	}
+
+	plainType := dst.Type()
+	if plainType.Kind() != enc.Kind() {
+		return pathErrorf(path, "%w: cannot map plain type %s to encrypted type %s", ErrKindMismatch, plainType, enc.Type())
+	}
+	switch enc.Kind() {
+	case reflect.Struct:
+		return w.selectStruct(sel, enc, dst, path)
+	case reflect.Pointer:
+		if enc.IsNil() {
+			dst.SetZero()
+			return nil
+		}
+		out := reflect.New(plainType.Elem())
+		if !dst.IsNil() {
+			out.Elem().Set(dst.Elem())
+		}
+		dst.Set(out)
+		return w.selectDecrypt(sel, enc.Elem(), out.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		if enc.Kind() == reflect.Slice {
+			if enc.IsNil() {
+				// Only the wildcard can select into a nil slice; it selects
+				// nothing, and the nil is preserved.
+				if _, err := selectIndices(sel, 0, path); err != nil {
+					return err
+				}
+				dst.SetZero()
+				return nil
+			}
+			out := reflect.MakeSlice(plainType, enc.Len(), enc.Len())
+			reflect.Copy(out, dst)
+			dst.Set(out)
+		} else if plainType.Len() != enc.Len() {
+			return pathErrorf(path, "%w: array length mismatch: plain %d, encrypted %d", ErrKindMismatch, plainType.Len(), enc.Len())
+		}
+		indices, err := selectIndices(sel, enc.Len(), path)
+		if err != nil {
+			return err
+		}
+		for _, i := range indices {
+			if err = w.selectDecrypt(i.sel, enc.Index(i.index), dst.Index(i.index), joinPath(path, indexPath(i.index))); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if plainType.Key() != enc.Type().Key() {
+			return pathErrorf(path, "%w: map key types must be identical (keys are never encrypted): plain %s, encrypted %s", ErrKindMismatch, plainType.Key(), enc.Type().Key())
+		}
+		if enc.IsNil() {
+			if _, err := selectMapKeys(sel, enc, path); err != nil {
+				return err
+			}
+			dst.SetZero()
+			return nil
+		}
+		out := reflect.MakeMapWithSize(plainType, enc.Len())
+		iter := dst.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), iter.Value())
+		}
+		dst.Set(out)
+		keys, err := selectMapKeys(sel, enc, path)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			elem := reflect.New(plainType.Elem()).Elem()
+			if current := out.MapIndex(k.key); current.IsValid() {
+				elem.Set(current)
+			}
+			if err = w.selectDecrypt(k.sel, enc.MapIndex(k.key), elem, joinPath(path, keyPath(k.key))); err != nil {
+				return err
+			}
+			w.setMapIndex(out, k.key, elem)
+		}
+		return nil
+	default:
+		return pathErrorf(path, "%w: selected paths continue below %s, which has no fields or elements", ErrUnsupportedType, enc.Type())
+	}
+}
+
+// selectStruct writes the selected fields of a struct. Embedded pointers on
+// the way to a promoted field are copied before being written, like the
+// containers selectDecrypt meets.
+//
+// The fields are looked up in the compiled plan of the struct pair. Only the
+// selected fields need to exist on both sides, so the plan is compiled with
+// unmatched fields ignored on either side, and cached like any other.
+func (w *structWalk) selectStruct(sel *selection, enc, dst reflect.Value, path string) error {
+	p, err := planFor(dst.Type(), enc.Type(), w.o.matching|IgnoreUnmatchedPlain|IgnoreUnmatchedEncrypted)
+	if err != nil {
+		return PrefixPath(err, path)
+	}
+	for _, name := range sortedKeys(sel.fields) {
+		fieldPath := joinPath(path, name)
+		i, ok := p.byName[name]
+		if !ok {
+			return unselectable(enc.Type(), dst.Type(), name, fieldPath)
+		}
+		f := p.fields[i]
+		from, ok := sourceField(enc, f.encIndex)
+		if !ok {
+			if to, ok := destField(dst, f.plainIndex, false, true); ok {
+				to.SetZero()
+			}
+			continue
+		}
+		// A zero value leaves a nil embedded pointer nil, as in
+		// decryptStruct.
+		to, ok := destField(dst, f.plainIndex, !from.IsZero(), true)
+		if !ok {
+			continue
+		}
+		err = w.field(f.key, fieldPath, func() error {
+			return w.selectDecrypt(sel.fields[name], from, to, fieldPath)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(sel.elems) > 0 {
+		return pathErrorf(path, "%w: struct %s has no elements to index", ErrUnsupportedType, enc.Type())
+	}
+	return nil
+}
+
+// unselectable reports the side of a struct pair that lacks the selected
+// field name. It only runs on failure, so it may look the fields up again.
+func unselectable(encType, plainType reflect.Type, name, path string) error {
+	if _, encByName, err := structFields(encType); err == nil {
+		if _, ok := encByName[name]; !ok {
+			return pathErrorf(path, "selected field not found in encrypted struct %s", encType)
+		}
+	}
+	return pathErrorf(path, "selected field not found in plain struct %s", plainType)
+}
+
+// selectedIndex is a slice or array element to walk with its selection.
+type selectedIndex struct {
+	index int
+	sel   *selection
+}
+
+// selectIndices resolves the selected elements of a slice or array of length
+// elements, in index order. An element selected both by the wildcard and by
+// its index gets the union of both.
+func selectIndices(sel *selection, length int, path string) ([]selectedIndex, error) {
+	exact := make(map[int]*selection)
+	for _, key := range sortedKeys(sel.elems) {
+		if key == "" {
+			continue
+		}
+		i, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, pathErrorf(path, "selected index %q is not a number", key)
+		}
+		if i < 0 || i >= length {
+			return nil, pathErrorf(joinPath(path, indexPath(i)), "selected index out of range [0, %d)", length)
+		}
+		exact[i] = union(exact[i], sel.elems[key])
+	}
+
+	var indices []selectedIndex
+	if wildcard := sel.elems[""]; wildcard != nil {
+		for i := range length {
+			indices = append(indices, selectedIndex{i, union(wildcard, exact[i])})
+		}
+		return indices, nil
+	}
+	for i, s := range exact {
+		indices = append(indices, selectedIndex{i, s})
+	}
+	slices.SortFunc(indices, func(a, b selectedIndex) int { return a.index - b.index })
+	return indices, nil
+}
+
+// selectedKey is a map element to walk with its selection.
+type selectedKey struct {
+	key reflect.Value
+	sel *selection
+}
+
+// selectMapKeys resolves the selected elements of the map enc, ordered by
+// their keyPath form. A key is written as keyPath renders it, so a key
+// selects the element whose key formats to the same text. An element
+// selected both by the wildcard and by its key gets the union of both.
+func selectMapKeys(sel *selection, enc reflect.Value, path string) ([]selectedKey, error) {
+	wildcard := sel.elems[""]
+	found := make(map[string]bool)
+	var keys []selectedKey
+	iter := enc.MapRange()
+	for iter.Next() {
+		written := keyPath(iter.Key())
+		exact := sel.elems[written[1:len(written)-1]]
+		if exact == nil && wildcard == nil {
+			continue
+		}
+		if exact != nil {
+			found[written] = true
+		}
+		keys = append(keys, selectedKey{iter.Key(), union(wildcard, exact)})
+	}
+	for _, key := range sortedKeys(sel.elems) {
+		if key != "" && !found["["+key+"]"] {
+			return nil, pathErrorf(joinPath(path, "["+key+"]"), "selected key not found")
+		}
+	}
+	slices.SortFunc(keys, func(a, b selectedKey) int { return strings.Compare(keyPath(a.key), keyPath(b.key)) })
+	return keys, nil
+}
+
+// sortedKeys returns the keys of m in order, so selections are processed, and
+// their errors reported, deterministically.
+func sortedKeys(m map[string]*selection) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
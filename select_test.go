@@ -0,0 +1,225 @@
+package transcrypt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	valid := [][]string{
+		{"Name"},
+		{"Inner.Note", "Inners[2].Note"},
+		{"Inners[].Note", "Meta[k1]", "Grid[0][1]"},
+		{"Meta[a.b]"},
+	}
+	for _, paths := range valid {
+		if _, err := parseSelection(paths); err != nil {
+			t.Errorf("parseSelection(%q) error = %v", paths, err)
+		}
+	}
+	for _, path := range []string{"", "[0]", "Inners[0", "Inner..Note", "Inner.", "Inners[0]Note", ".Name"} {
+		if _, err := parseSelection([]string{path}); err == nil {
+			t.Errorf("parseSelection(%q) expected error", path)
+		}
+	}
+	if _, err := NewEncryptor(testKey, WithFields("Inners[0")); err == nil {
+		t.Error("NewEncryptor() with a malformed path expected error")
+	}
+}
+
+func TestWithFields_Selected(t *testing.T) {
+	enc, err := Encrypt[SecureOuter](testKey, AES_256_GCM, testOuter())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	// Fields outside the selection are not decrypted at all, so a corrupt one
+	// does not fail the call.
+	enc.Count = "garbage"
+
+	full := testOuter()
+	tests := []struct {
+		name  string
+		paths []string
+		want  Outer
+	}{
+		{"leaf", []string{"Name"}, Outer{Name: full.Name}},
+		{"copied", []string{"Plain"}, Outer{Plain: full.Plain}},
+		{"nested", []string{"Inner.Note"}, Outer{Inner: Inner{Note: full.Inner.Note}}},
+		{"subtree", []string{"Inner"}, Outer{Inner: full.Inner}},
+		{"pointer", []string{"InnerPtr.Note"}, Outer{InnerPtr: &Inner{Note: full.InnerPtr.Note}}},
+		{"index", []string{"Inners[1].Note"}, Outer{Inners: []Inner{{}, {Note: "second"}}}},
+		{"wildcard", []string{"Inners[].Note"}, Outer{Inners: []Inner{{Note: "first"}, {Note: "second"}}}},
+		{"overlap", []string{"Inners[].Public", "Inners[0].Note", "Inners[0]"}, Outer{Inners: []Inner{{Note: "first", Public: 1}, {Public: 2}}}},
+		{"map_key", []string{"Meta[k2]"}, Outer{Meta: map[string]string{"k2": "v2"}}},
+		{"map_wildcard", []string{"Meta[]"}, Outer{Meta: full.Meta}},
+		{"array", []string{"Fixed[1]"}, Outer{Fixed: [2]int{0, 20}}},
+		{"nil_slice", []string{"Tags[]"}, Outer{Tags: full.Tags}},
+		{"nothing", []string{}, Outer{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, workers := range []int{0, 4} {
+				got, err := Decrypt[Outer](testKey, enc, WithFields(tt.paths...), WithConcurrency(workers))
+				if err != nil {
+					t.Fatalf("Decrypt() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Decrypt() with %d workers = %+v, want %+v", workers, got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Nil is preserved below a selected wildcard.
+	enc.Tags = nil
+	got, err := Decrypt[Outer](testKey, enc, WithFields("Tags[]"))
+	if err != nil || got.Tags != nil {
+		t.Errorf("Decrypt() of a nil slice = %v, %v; want nil", got.Tags, err)
+	}
+}
+
+func TestWithFields_PartialType(t *testing.T) {
+	enc, err := Encrypt[SecureOuter](testKey, AES_256_GCM, testOuter())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	type note struct{ Note string }
+	type partial struct {
+		Name   string
+		Inners []note
+	}
+	got, err := Decrypt[partial](testKey, enc, WithFields("Name", "Inners[].Note"))
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	want := partial{Name: "top secret", Inners: []note{{"first"}, {"second"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decrypt() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithFields_Plan(t *testing.T) {
+	type plainPair struct{ A, B string }
+	type securePair struct{ A, B Ciphertext }
+	enc, err := Encrypt[securePair](testKey, AES_256_GCM, plainPair{"a", "b"})
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	got, err := Decrypt[plainPair](testKey, enc, WithFields("A"))
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if want := (plainPair{A: "a"}); got != want {
+		t.Errorf("Decrypt() = %+v, want %+v", got, want)
+	}
+	key := planKey{reflect.TypeFor[plainPair](), reflect.TypeFor[securePair](), IgnoreUnmatchedPlain | IgnoreUnmatchedEncrypted}
+	if _, ok := plans.Load(key); !ok {
+		t.Error("Decrypt() with WithFields did not cache the selection plan")
+	}
+
+	// Unselected fields present on both sides are still compiled.
+	type badPair struct {
+		A string
+		B []int
+	}
+	_, err = Decrypt[badPair](testKey, enc, WithFields("A"))
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "B" {
+		t.Errorf("Decrypt() with a mismatched unselected field error = %v, want a FieldError at B", err)
+	}
+}
+
+func TestWithFields_Encryptor(t *testing.T) {
+	enc, err := Encrypt[SecureOuter](testKey, AES_256_GCM, testOuter())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	e, err := NewEncryptor(testKey, WithFields("Name", "Inners[0].Note", "Meta[k1]"))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+
+	inners := []Inner{{Note: "old", Public: 10}, {Note: "keep", Public: 20}}
+	meta := map[string]string{"k1": "old", "other": "keep"}
+	dst := Outer{Name: "old", Count: 99, Inners: inners, Meta: meta}
+	if err = e.Decrypt(&dst, enc); err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	want := Outer{
+		Name:   "top secret",
+		Count:  99,
+		Inners: []Inner{{Note: "first", Public: 10}, {Note: "keep", Public: 20}},
+		Meta:   map[string]string{"k1": "v1", "other": "keep"},
+	}
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("Decrypt() = %+v, want %+v", dst, want)
+	}
+	// The caller's slice and map were copied, not written through.
+	if inners[0].Note != "old" || meta["k1"] != "old" {
+		t.Errorf("Decrypt() modified the destination's shared data: %+v, %v", inners, meta)
+	}
+
+	// On failure dst is left as it was.
+	enc.Name = "garbage"
+	before := dst
+	if err = e.Decrypt(&dst, enc); err == nil || !reflect.DeepEqual(dst, before) {
+		t.Errorf("Decrypt() of a corrupt field = %v; dst %+v", err, dst)
+	}
+}
+
+func TestWithFields_Errors(t *testing.T) {
+	enc, err := Encrypt[SecureOuter](testKey, AES_256_GCM, testOuter())
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	type wrongKind struct{ Inner []Inner }
+	tests := []struct {
+		name  string
+		paths []string
+		path  string
+		want  error
+	}{
+		{"missing_encrypted", []string{"Nope"}, "Nope", nil},
+		{"index_range", []string{"Inners[5]"}, "Inners[5]", nil},
+		{"index_number", []string{"Inners[x]"}, "Inners", nil},
+		{"map_key", []string{"Meta[nope]"}, "Meta[nope]", nil},
+		{"below_leaf", []string{"Name.Length"}, "Name", ErrUnsupportedType},
+		{"index_struct", []string{"Inner[0]"}, "Inner", ErrUnsupportedType},
+		{"corrupt", []string{"Name"}, "Name", ErrMalformed},
+	}
+	enc.Name = "garbage"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt[Outer](testKey, enc, WithFields(tt.paths...))
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Path != tt.path {
+				t.Fatalf("Decrypt() error = %v, want a FieldError at %q", err, tt.path)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Decrypt() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// The plain type must hold every selected field, matching its mirror.
+	if _, err = Decrypt[struct{ Count int }](testKey, enc, WithFields("Name")); err == nil {
+		t.Error("Decrypt() into a type lacking the selected field expected error")
+	}
+	if _, err = Decrypt[wrongKind](testKey, enc, WithFields("Inner.Note")); !errors.Is(err, ErrKindMismatch) {
+		t.Errorf("Decrypt() into a mismatched kind error = %v, want ErrKindMismatch", err)
+	}
+	// A selected subtree matches strictly, with errors located in the whole
+	// struct.
+	type badLeaf struct {
+		Inner struct {
+			Note   []int
+			Public int
+		}
+	}
+	_, err = Decrypt[badLeaf](testKey, enc, WithFields("Inner"))
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "Inner.Note" {
+		t.Errorf("Decrypt() of a mismatched subtree error = %v, want a FieldError at Inner.Note", err)
+	}
+}
@@ -0,0 +1,210 @@
+package transcrypt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A key split with SplitKey is shared as text, one line per custodian:
+//
+//	transcrypt-share:1:<set>:<k>:<n>:<x>:<data>:<checksum>
+//
+// where 1 is the format version, set is a random 8-hex-digit ID common to the
+// shares of one split, k is the number of shares needed to recover the key,
+// n the number of shares made, x the share's own number (1 to n), data the
+// share's bytes in hex, and checksum the first 4 bytes of the SHA-256 of
+// everything before it, in hex. The checksum catches typing and transcription
+// mistakes; it does not authenticate the share.
+const (
+	sharePrefix  = "transcrypt-share"
+	shareVersion = 1
+	// shareSetLength and shareChecksumLength are in bytes.
+	shareSetLength      = 4
+	shareChecksumLength = 4
+)
+
+// share is a parsed share.
+type share struct {
+	set  string
+	k, n int
+	x    byte
+	data []byte
+}
+
+// SplitKey splits key into n shares, any k of which recover it with
+// CombineShares, using Shamir's secret sharing over GF(256): every byte of
+// the key is the constant term of its own random polynomial of degree k-1,
+// and share x holds the polynomials evaluated at x. Fewer than k shares
+// reveal nothing about the key, not even its bytes one at a time; only its
+// length shows.
+//
+// The shares are self-describing text lines (see the format above), to be
+// handed to different custodians. It returns an error unless 2 <= k <= n <=
+// 255, or if key is empty.
+func SplitKey(key []byte, n, k int) ([]string, error) {
+	if len(key) == 0 {
+		return nil, errors.New("key is empty")
+	}
+	if k < 2 || k > n || n > 255 {
+		return nil, fmt.Errorf("shares must satisfy 2 <= k <= n <= 255, got k=%d, n=%d", k, n)
+	}
+
+	var set [shareSetLength]byte
+	if _, err := io.ReadFull(rand.Reader, set[:]); err != nil {
+		return nil, fmt.Errorf("failed to read random data for share set: %w", err)
+	}
+	// coefficients[i] holds the k-1 random coefficients of byte i's
+	// polynomial; its constant term is key[i].
+	coefficients := make([]byte, len(key)*(k-1))
+	if _, err := io.ReadFull(rand.Reader, coefficients); err != nil {
+		return nil, fmt.Errorf("failed to read random data for shares: %w", err)
+	}
+	defer ClearKey(coefficients)
+
+	shares := make([]string, n)
+	data := make([]byte, len(key))
+	defer ClearKey(data)
+	for x := 1; x <= n; x++ {
+		for i, secret := range key {
+			// Horner's rule, from the highest coefficient down.
+			var y byte
+			for _, c := range coefficients[i*(k-1) : (i+1)*(k-1)] {
+				y = gfMul(y, byte(x)) ^ c
+			}
+			data[i] = gfMul(y, byte(x)) ^ secret
+		}
+		shares[x-1] = share{set: hex.EncodeToString(set[:]), k: k, n: n, x: byte(x), data: data}.String()
+	}
+	return shares, nil
+}
+
+// CombineShares recovers a key split by SplitKey from at least k of its
+// shares, in any order. Surrounding whitespace is ignored.
+//
+// It returns an error wrapping ErrMalformed if a share is not in the share
+// format or fails its checksum, and an error if the shares come from
+// different splits, repeat a share, or are fewer than the split requires.
+// Shares from the same split that were altered consistently enough to pass
+// their checksums recover a wrong key, without error.
+func CombineShares(shares []string) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares given")
+	}
+	parsed := make([]share, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, s := range shares {
+		p, err := parseShare(s)
+		if err != nil {
+			return nil, fmt.Errorf("share %d: %w", i+1, err)
+		}
+		first := parsed[0]
+		if i > 0 && (p.set != first.set || p.k != first.k || p.n != first.n || len(p.data) != len(first.data)) {
+			return nil, fmt.Errorf("share %d: belongs to split %s, share 1 to split %s", i+1, p.set, first.set)
+		}
+		if seen[p.x] {
+			return nil, fmt.Errorf("share %d: share number %d is given twice", i+1, p.x)
+		}
+		seen[p.x] = true
+		parsed[i] = p
+	}
+	if k := parsed[0].k; len(parsed) < k {
+		return nil, fmt.Errorf("split %s needs %d shares, got %d", parsed[0].set, k, len(parsed))
+	}
+
+	// Lagrange interpolation at x = 0. In GF(256) subtraction is addition
+	// (XOR), so the basis polynomial of share j at 0 is the product of
+	// x_m / (x_m ^ x_j) over the other shares m.
+	key := make([]byte, len(parsed[0].data))
+	for j, pj := range parsed {
+		basis := byte(1)
+		for m, pm := range parsed {
+			if m != j {
+				basis = gfMul(basis, gfMul(pm.x, gfInv(pm.x^pj.x)))
+			}
+		}
+		for i, y := range pj.data {
+			key[i] ^= gfMul(basis, y)
+		}
+	}
+	return key, nil
+}
+
+// String formats s as a share line, checksum included.
+func (s share) String() string {
+	body := fmt.Sprintf("%s:%d:%s:%d:%d:%d:%x", sharePrefix, shareVersion, s.set, s.k, s.n, s.x, s.data)
+	return body + ":" + shareChecksum(body)
+}
+
+// shareChecksum returns the checksum of a share line's body, in hex.
+func shareChecksum(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:shareChecksumLength])
+}
+
+// parseShare parses and checks a share line.
+func parseShare(line string) (share, error) {
+	line = strings.TrimSpace(line)
+	body, checksum, ok := cutLast(line, ":")
+	fields := strings.Split(body, ":")
+	if !ok || len(fields) != 7 || fields[0] != sharePrefix {
+		return share{}, fmt.Errorf("%w: not a transcrypt key share", ErrMalformed)
+	}
+	if fields[1] != strconv.Itoa(shareVersion) {
+		return share{}, fmt.Errorf("%w: unsupported key share version %q", ErrMalformed, fields[1])
+	}
+	if subtle.ConstantTimeCompare([]byte(checksum), []byte(shareChecksum(body))) != 1 {
+		return share{}, fmt.Errorf("%w: key share checksum mismatch: the share was altered or mistyped", ErrMalformed)
+	}
+
+	s := share{set: fields[2]}
+	k, errK := strconv.Atoi(fields[3])
+	n, errN := strconv.Atoi(fields[4])
+	x, errX := strconv.Atoi(fields[5])
+	data, errData := hex.DecodeString(fields[6])
+	if err := errors.Join(errK, errN, errX, errData); err != nil {
+		return share{}, fmt.Errorf("%w: key share: %w", ErrMalformed, err)
+	}
+	if len(s.set) != 2*shareSetLength || k < 2 || k > n || n > 255 || x < 1 || x > n || len(data) == 0 {
+		return share{}, fmt.Errorf("%w: key share fields out of range", ErrMalformed)
+	}
+	s.k, s.n, s.x, s.data = k, n, byte(x), data
+	return s, nil
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// gfMul multiplies in GF(256) with the AES polynomial x^8 + x^4 + x^3 + x + 1.
+// It runs in constant time, without lookup tables indexed by key bytes.
+func gfMul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= a & -(b & 1)
+		a = a<<1 ^ 0x1b&-(a>>7)
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns the multiplicative inverse of a non-zero a in GF(256), as
+// a^254.
+func gfInv(a byte) byte {
+	result := a
+	for range 6 {
+		a = gfMul(a, a)
+		result = gfMul(result, a)
+	}
+	return gfMul(result, result)
+}
@@ -0,0 +1,130 @@
+package transcrypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSplitKeyRoundTrip(t *testing.T) {
+	key := bytes.Clone(testKey[:32])
+	shares, err := SplitKey(key, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitKey() error = %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("SplitKey() made %d shares, want 5", len(shares))
+	}
+
+	// Every subset of at least 3 shares, in any order, recovers the key.
+	for mask := 1; mask < 1<<5; mask++ {
+		var subset []string
+		for i := 4; i >= 0; i-- {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, shares[i])
+			}
+		}
+		got, err := CombineShares(subset)
+		switch {
+		case len(subset) < 3:
+			if err == nil || !strings.Contains(err.Error(), "needs 3 shares") {
+				t.Errorf("CombineShares() of %d shares error = %v", len(subset), err)
+			}
+		case err != nil || !bytes.Equal(got, key):
+			t.Errorf("CombineShares(%05b) = %x, %v; want the key", mask, got, err)
+		}
+	}
+
+	// Whitespace around a share, as pasted from a file, is ignored.
+	if got, err := CombineShares([]string{" " + shares[0] + "\n", shares[1], "\t" + shares[2]}); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("CombineShares() with whitespace = %x, %v", got, err)
+	}
+}
+
+func TestSplitKeyShareFormat(t *testing.T) {
+	shares, err := SplitKey([]byte("0123456789abcdef"), 3, 2)
+	if err != nil {
+		t.Fatalf("SplitKey() error = %v", err)
+	}
+	fields := strings.Split(shares[1], ":")
+	if len(fields) != 8 || fields[0] != "transcrypt-share" || fields[1] != "1" || fields[3] != "2" || fields[4] != "3" || fields[5] != "2" || len(fields[6]) != 32 {
+		t.Errorf("share = %q, want transcrypt-share:1:<set>:2:3:2:<32 hex digits>:<checksum>", shares[1])
+	}
+	if strings.Contains(shares[1], "30313233") {
+		t.Errorf("share %q holds the key in the clear", shares[1])
+	}
+}
+
+func TestCombineSharesErrors(t *testing.T) {
+	shares, err := SplitKey(testKey[:16], 3, 2)
+	if err != nil {
+		t.Fatalf("SplitKey() error = %v", err)
+	}
+	other, _ := SplitKey(testKey[:16], 3, 2)
+
+	// Change the last digit of the data, keeping the checksum.
+	i := strings.LastIndexByte(shares[0], ':') - 1
+	digit := "a"
+	if shares[0][i] == 'a' {
+		digit = "b"
+	}
+	mistyped := shares[0][:i] + digit + shares[0][i+1:]
+
+	tests := []struct {
+		name   string
+		shares []string
+		want   string
+		is     error
+	}{
+		{"none", nil, "no shares", nil},
+		{"garbage", []string{"hello", shares[1]}, "share 1: malformed input: not a transcrypt key share", ErrMalformed},
+		{"mistyped", []string{mistyped, shares[1]}, "checksum mismatch", ErrMalformed},
+		{"version", []string{strings.Replace(shares[0], "share:1:", "share:9:", 1), shares[1]}, "version", ErrMalformed},
+		{"mixed", []string{shares[0], other[1]}, "share 2: belongs to split", nil},
+		{"repeated", []string{shares[0], shares[0]}, "given twice", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CombineShares(tt.shares)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || (tt.is != nil && !errors.Is(err, tt.is)) {
+				t.Errorf("CombineShares() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitKeyArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+		n, k int
+	}{
+		{"empty_key", nil, 3, 2},
+		{"threshold_one", testKey, 3, 1},
+		{"threshold_above_n", testKey, 3, 4},
+		{"too_many", testKey, 256, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SplitKey(tt.key, tt.n, tt.k); err == nil {
+				t.Errorf("SplitKey(n=%d, k=%d) error = nil", tt.n, tt.k)
+			}
+		})
+	}
+	if shares, err := SplitKey(testKey[:16], 255, 255); err != nil || len(shares) != 255 {
+		t.Errorf("SplitKey(n=255, k=255) = %d shares, %v", len(shares), err)
+	}
+}
+
+func TestGF256(t *testing.T) {
+	// The worked example of FIPS 197, section 4.2.
+	if got := gfMul(0x57, 0x83); got != 0xc1 {
+		t.Errorf("gfMul(0x57, 0x83) = %#x, want 0xc1", got)
+	}
+	for a := 1; a < 256; a++ {
+		if got := gfMul(byte(a), gfInv(byte(a))); got != 1 {
+			t.Errorf("%#x * gfInv(%#x) = %#x, want 1", a, a, got)
+		}
+	}
+}
@@ -10,27 +10,35 @@ package transcrypt
 //     field gets its own salt, derived key and nonce, and carries its original
 //     type inside the authenticated ciphertext);
 //   - a mirror field with the identical type as the plain field is copied
-//     verbatim;
+//     verbatim, unless it reaches an interface;
 //   - mirrored composite types (struct/slice/array/map/pointer pairs) are
-//     traversed recursively.
+//     traversed recursively;
+//   - interface pairs are mapped by their dynamic values (see interface.go).
 //
-// There are no struct tags and no interfaces to implement: declaring a field
-// as Ciphertext in the mirror struct is the only marker needed, so the
+// There are no interfaces to implement and no tags are required: declaring a
+// field as Ciphertext in the mirror struct is the only marker needed, so the
 // definition of "what is encrypted" cannot drift from the encrypted type.
 //
-// Fields are matched by name, and matching is strict in both directions: an
-// exported field present on one side but missing on the other is an error, so
-// data can never be dropped silently. Unexported fields are ignored on both
-// sides (like encoding/json); anonymous (embedded) fields are matched by their
-// type name, so embedding is only supported when both sides embed a type with
-// the same name. Nil pointers, slices and maps are preserved as nil. Map keys
-// are never encrypted, only map values — and because error messages carry the
+// Fields are matched by name, and matching is strict in both directions by
+// default: an exported field present on one side but missing on the other is
+// an error, so data can never be dropped silently. WithMatching relaxes this
+// for evolving schemas. A `transcrypt:"name"` tag matches a field under name
+// instead of its Go name, so a field can be renamed on one side only, and
+// `transcrypt:"-"` leaves a field out like an unexported one. Error and
+// WithFields paths use these matching names. Unexported fields are ignored on
+// both sides (like encoding/json). Embedded structs are flattened into the
+// fields they promote (see structFields), so an embedded Audit can be
+// mirrored by an embedded SecureAudit, or by the promoted fields listed
+// directly. Nil pointers, slices and maps are preserved as nil. Map keys are
+// never encrypted, only map values — and because error messages carry the
 // field path, map keys can appear verbatim in errors (and thus in logs), so
 // keys should never hold sensitive data.
 
 import (
 	"fmt"
 	"reflect"
+	"slices"
+	"strings"
 )
 
 // Ciphertext marks a field of an encrypted mirror struct as the encrypted
@@ -54,24 +62,279 @@ func joinPath(path, elem string) string {
 	return path + "." + elem
 }
 
-// pathErrorf prefixes an error with the field path it occurred at, keeping
-// top-level errors free of a leading separator.
+// pathErrorf wraps an error in a *FieldError carrying the field path it
+// occurred at. Top-level errors (an empty path) are returned unwrapped, free of
+// a leading separator.
 func pathErrorf(path, format string, args ...any) error {
 	if path == "" {
 		return fmt.Errorf(format, args...)
 	}
-	return fmt.Errorf("%s: %w", path, fmt.Errorf(format, args...))
+	return &FieldError{Path: path, Err: fmt.Errorf(format, args...)}
 }
 
-// exportedFieldIndex maps the names of a struct type's exported fields to
-// their field index. Unexported fields are excluded on purpose: they cannot be
-// read or set via reflection, so both walkers ignore them entirely.
-func exportedFieldIndex(t reflect.Type) map[string]int {
-	m := make(map[string]int, t.NumField())
+// Matching selects which struct fields may lack a counterpart on the other
+// side of a plain/mirror pair (see WithMatching). Modes combine with |.
+type Matching uint8
+
+const (
+	// MatchStrict requires every exported field on either side to have a
+	// counterpart. It is the default.
+	MatchStrict Matching = 0
+	// IgnoreUnmatchedPlain skips plain fields missing from the mirror: they
+	// are not encrypted, and are left zero when decrypting.
+	IgnoreUnmatchedPlain Matching = 1
+	// IgnoreUnmatchedEncrypted skips mirror fields missing from the plain
+	// struct: they are left zero when encrypting, and their values are not
+	// decrypted.
+	IgnoreUnmatchedEncrypted Matching = 2
+	// IgnoreUnmatched skips unmatched fields on both sides.
+	IgnoreUnmatched = IgnoreUnmatchedPlain | IgnoreUnmatchedEncrypted
+)
+
+// structField is a field of a struct type as the walkers see it: one of its
+// own, or one promoted from an embedded struct.
+type structField struct {
+	// name is the matching name, see fieldName.
+	name string
+	// index is the field's index sequence, as for reflect.Type.FieldByIndex.
+	index []int
+}
+
+// structFields returns the fields of the struct type t in index order, with
+// embedded structs flattened like the promoted fields of Go: an untagged
+// embedded struct, or pointer to one, contributes its fields rather than
+// being a field itself. byName maps their matching names to their position.
+//
+// Go lets an outer field shadow a promoted one, and two promoted fields of
+// the same name cancel each other out; both would leave data behind, so
+// here any two fields sharing a matching name are an error.
+func structFields(t reflect.Type) (fields []structField, byName map[string]int, err error) {
+	if fields, err = collectFields(t, nil, map[reflect.Type]bool{t: true}); err != nil {
+		return nil, nil, err
+	}
+	byName = make(map[string]int, len(fields))
+	for i, f := range fields {
+		if other, dup := byName[f.name]; dup {
+			return nil, nil, fmt.Errorf("struct %s: fields %s and %s both match as %q", t, goPath(t, fields[other].index), goPath(t, f.index), f.name)
+		}
+		byName[f.name] = i
+	}
+	return fields, byName, nil
+}
+
+// collectFields appends the fields of t, found at index prefix, descending
+// into embedded structs. embedding holds the struct types being flattened,
+// to reject a struct that embeds itself.
+func collectFields(t reflect.Type, prefix []int, embedding map[reflect.Type]bool) ([]structField, error) {
+	var fields []structField
 	for i := 0; i < t.NumField(); i++ {
-		if f := t.Field(i); f.IsExported() {
-			m[f.Name] = i
+		f := t.Field(i)
+		index := append(slices.Clip(prefix), i)
+		if et, ok := embeddedStruct(f); ok {
+			if embedding[et] {
+				return nil, fmt.Errorf("struct %s embeds itself through %s", et, f.Name)
+			}
+			// An unexported pointer cannot be allocated to write through.
+			if !f.IsExported() && f.Type.Kind() == reflect.Pointer {
+				return nil, fmt.Errorf("%w: embedded pointer to unexported struct %s", ErrUnsupportedType, et)
+			}
+			embedding[et] = true
+			promoted, err := collectFields(et, index, embedding)
+			delete(embedding, et)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, promoted...)
+			continue
+		}
+		if name, ok := fieldName(f); ok {
+			fields = append(fields, structField{name: name, index: index})
+		}
+	}
+	return fields, nil
+}
+
+// embeddedStruct reports whether f is an embedded struct to flatten, and
+// returns its struct type. Embedded structs named by a tag are ordinary
+// fields, as are nullable ones (see nullable.go) and those without exported
+// fields, such as time.Time, which are values rather than groups of fields.
+func embeddedStruct(f reflect.StructField) (reflect.Type, bool) {
+	if !f.Anonymous {
+		return nil, false
+	}
+	if name, _, _ := strings.Cut(f.Tag.Get("transcrypt"), ","); name != "" {
+		return nil, false
+	}
+	t := f.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || isNullable(t) {
+		return nil, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() || t.Field(i).Anonymous {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// goPath renders the Go selector path of the field at index in t, e.g.
+// "Audit.CreatedBy".
+func goPath(t reflect.Type, index []int) string {
+	names := make([]string, len(index))
+	for i, x := range index {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		names[i] = t.Field(x).Name
+		t = t.Field(x).Type
+	}
+	return strings.Join(names, ".")
+}
+
+// fieldType returns the type of the field at index in t.
+func fieldType(t reflect.Type, index []int) reflect.Type {
+	for _, x := range index {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		t = t.Field(x).Type
+	}
+	return t
+}
+
+// sourceField returns the field at index in the struct v, to read from. ok
+// is false if the field is promoted through a nil embedded pointer, and so
+// holds no value.
+func sourceField(v reflect.Value, index []int) (field reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// destField returns the field at index in the struct v, to write to. Nil
+// embedded pointers on the way are allocated if alloc is set; otherwise ok
+// is false when one is met. With copyPointers, embedded pointers that are
+// set are replaced by a copy first, so the write does not reach a struct
+// shared with another value.
+func destField(v reflect.Value, index []int, alloc, copyPointers bool) (field reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			switch {
+			case v.IsNil() && !alloc:
+				return reflect.Value{}, false
+			case v.IsNil():
+				v.Set(reflect.New(v.Type().Elem()))
+			case copyPointers:
+				c := reflect.New(v.Type().Elem())
+				c.Elem().Set(v.Elem())
+				v.Set(c)
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldName returns the name a struct field is matched under: the name of
+// its transcrypt tag, or its Go name (for an embedded field that is not
+// flattened, the name of its type). ok is false for fields the walkers
+// skip: unexported ones, which cannot be read or set via reflection, and
+// those tagged "-".
+func fieldName(f reflect.StructField) (name string, ok bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	tag, _, _ := strings.Cut(f.Tag.Get("transcrypt"), ",")
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// fieldKey is the key and cipher suite a mirror field's tag selects for the
+// leaves below it, e.g. `transcrypt:",key=pci,suite=CHACHA20_POLY1305"`.
+type fieldKey struct {
+	// id names a key in the keyring; "" keeps the inherited key.
+	id          string
+	cipherSuite CipherSuite
+	hasSuite    bool
+}
+
+// fieldKeyAt returns the key and cipher suite selected for the field at
+// index in t. A promoted field inherits the selection of the embedded fields
+// it is reached through, the innermost tag winning, as for nested fields.
+func fieldKeyAt(t reflect.Type, index []int) (*fieldKey, error) {
+	var k *fieldKey
+	for _, x := range index {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		f := t.Field(x)
+		inner, err := fieldKeyOf(f)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case inner == nil:
+		case k == nil:
+			k = inner
+		default:
+			merged := *k
+			if inner.id != "" {
+				merged.id = inner.id
+			}
+			if inner.hasSuite {
+				merged.cipherSuite, merged.hasSuite = inner.cipherSuite, true
+			}
+			k = &merged
+		}
+		t = f.Type
+	}
+	return k, nil
+}
+
+// fieldKeyOf parses the options of a mirror field's transcrypt tag, those
+// after the name. It returns nil if the tag selects neither a key nor a
+// cipher suite. Unknown options are an error: a misspelled key option must
+// not silently encrypt under the default key.
+func fieldKeyOf(f reflect.StructField) (*fieldKey, error) {
+	_, opts, ok := strings.Cut(f.Tag.Get("transcrypt"), ",")
+	if !ok {
+		return nil, nil
+	}
+	k := &fieldKey{}
+	for opt := range strings.SplitSeq(opts, ",") {
+		name, value, _ := strings.Cut(opt, "=")
+		switch name {
+		case "key":
+			if value == "" {
+				return nil, fmt.Errorf("field %s: tag option key needs a key ID", f.Name)
+			}
+			k.id = value
+		case "suite":
+			suite, err := GetCipherSuite(value)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			k.cipherSuite, k.hasSuite = suite, true
+		default:
+			return nil, fmt.Errorf("field %s: unknown transcrypt tag option %q", f.Name, opt)
 		}
 	}
-	return m
+	return k, nil
 }
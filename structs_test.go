@@ -1,9 +1,12 @@
 package transcrypt
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/jantytgat/go-transcrypt/transcrypttest"
 )
 
 // Inner / SecureInner mirror a nested struct with one encrypted and one
@@ -228,6 +231,112 @@ func TestStructMissingFieldErrors(t *testing.T) {
 	}
 }
 
+func TestStructMatchingModes(t *testing.T) {
+	// V1 is the old schema; V2 dropped Legacy and added Phone.
+	type V1 struct {
+		Name   string
+		Legacy string
+	}
+	type SecureV2 struct {
+		Name  Ciphertext
+		Phone Ciphertext
+	}
+
+	tests := []struct {
+		name     string
+		matching Matching
+		wantErr  bool
+	}{
+		{"strict", MatchStrict, true},
+		{"ignore_plain", IgnoreUnmatchedPlain, true},
+		{"ignore_encrypted", IgnoreUnmatchedEncrypted, true},
+		{"ignore_both", IgnoreUnmatched, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := Encrypt[SecureV2](testKey, AES_256_GCM, V1{Name: "n", Legacy: "l"}, WithMatching(tt.matching))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Encrypt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if enc.Phone != "" {
+				t.Errorf("unmatched mirror field = %q, want zero", enc.Phone)
+			}
+			out, err := Decrypt[V1](testKey, enc, WithMatching(tt.matching))
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if want := (V1{Name: "n"}); out != want {
+				t.Errorf("Decrypt() = %+v, want %+v", out, want)
+			}
+		})
+	}
+
+	// Each mode only relaxes its own side.
+	type Narrow struct{ Name string }
+	if _, err := Encrypt[SecureV2](testKey, AES_256_GCM, Narrow{"n"}, WithMatching(IgnoreUnmatchedEncrypted)); err != nil {
+		t.Errorf("Encrypt() with an extra mirror field error = %v", err)
+	}
+	type SecureNarrow struct{ Name Ciphertext }
+	if _, err := Encrypt[SecureNarrow](testKey, AES_256_GCM, V1{}, WithMatching(IgnoreUnmatchedPlain)); err != nil {
+		t.Errorf("Encrypt() with an extra plain field error = %v", err)
+	}
+	if err := CheckMirror(reflect.TypeOf(V1{}), reflect.TypeOf(SecureNarrow{}), WithMatching(IgnoreUnmatchedEncrypted)); err == nil {
+		t.Error("CheckMirror() accepted an extra plain field under IgnoreUnmatchedEncrypted")
+	}
+
+	if _, err := Encrypt[SecureV2](testKey, AES_256_GCM, V1{}, WithMatching(Matching(8))); err == nil {
+		t.Error("expected error for an unknown matching mode")
+	}
+}
+
+func TestStructRenameTags(t *testing.T) {
+	type P struct {
+		Email   string
+		Comment string `transcrypt:"-"`
+		Ignored string `transcrypt:"-"`
+	}
+	// The mirror renamed Email to Mail, and has a field of its own that is
+	// left out of matching.
+	type E struct {
+		Mail    Ciphertext `transcrypt:"Email"`
+		Audit   string     `transcrypt:"-"`
+		Comment Ciphertext `transcrypt:"-"`
+	}
+
+	enc, err := Encrypt[E](testKey, AES_256_GCM, P{Email: "a@b.c", Comment: "c", Ignored: "i"})
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if enc.Mail == "" || enc.Comment != "" {
+		t.Errorf("Encrypt() = %+v, want only Mail set", enc)
+	}
+	out, err := Decrypt[P](testKey, enc)
+	if err != nil || out != (P{Email: "a@b.c"}) {
+		t.Errorf("Decrypt() = %+v, %v", out, err)
+	}
+
+	// Paths use the matching name.
+	type EBad struct {
+		Mail Ciphertext `transcrypt:"Email"`
+	}
+	_, err = Decrypt[P](testKey, EBad{Mail: "garbage"})
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "Email" {
+		t.Errorf("Decrypt() error = %v, want a FieldError at Email", err)
+	}
+
+	type Dup struct {
+		A Ciphertext `transcrypt:"Email"`
+		B Ciphertext `transcrypt:"Email"`
+	}
+	if _, err := Encrypt[Dup](testKey, AES_256_GCM, P{}); err == nil || !strings.Contains(err.Error(), "both match") {
+		t.Errorf("Encrypt() error = %v, want a duplicate name error", err)
+	}
+}
+
 func TestStructKindMismatchErrors(t *testing.T) {
 	type P struct{ A int }
 	type E struct{ A bool }
@@ -437,3 +546,413 @@ func TestStructChaCha20Suite(t *testing.T) {
 		t.Fatal("round trip mismatch with CHACHA20_POLY1305")
 	}
 }
+
+func TestStructFieldKeys(t *testing.T) {
+	pciKey := transcrypttest.Key("pci", 32)
+	type Card struct {
+		Number string
+		Holder string
+	}
+	type SecureCard struct {
+		Number Ciphertext
+		// A nested tag overrides the key selected above it.
+		Holder Ciphertext `transcrypt:",key=pii"`
+	}
+	type Payment struct {
+		Email string
+		Cards []Card
+		Note  string
+	}
+	type SecurePayment struct {
+		Email Ciphertext
+		Cards []SecureCard `transcrypt:",key=pci"`
+		Note  Ciphertext   `transcrypt:"Note,suite=CHACHA20_POLY1305"`
+	}
+	piiKey := transcrypttest.Key("pii", 32)
+	ring := WithKeyring(Keyring{"pci": pciKey, "pii": piiKey})
+	in := Payment{Email: "a@b.c", Cards: []Card{{"4111", "A"}, {"5500", "B"}}, Note: "n"}
+
+	enc, err := Encrypt[SecurePayment](testKey, AES_256_GCM, in, ring)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	for _, c := range []struct {
+		name  string
+		value Ciphertext
+		key   []byte
+	}{
+		{"Email", enc.Email, testKey},
+		{"Cards[1].Number", enc.Cards[1].Number, pciKey},
+		{"Cards[1].Holder", enc.Cards[1].Holder, piiKey},
+		{"Note", enc.Note, testKey},
+	} {
+		if _, err := Decrypt[string](c.key, c.value); err != nil {
+			t.Errorf("%s does not decrypt under its key: %v", c.name, err)
+		}
+	}
+	if info, err := Inspect(string(enc.Note)); err != nil || info.CipherSuite != CHACHA20_POLY1305 {
+		t.Errorf("Note cipher suite = %v, %v; want CHACHA20_POLY1305", info.CipherSuite, err)
+	}
+	if info, err := Inspect(string(enc.Email)); err != nil || info.CipherSuite != AES_256_GCM {
+		t.Errorf("Email cipher suite = %v, %v; want AES_256_GCM", info.CipherSuite, err)
+	}
+
+	out, err := Decrypt[Payment](testKey, enc, ring)
+	if err != nil || !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip = %+v, %v; want %+v", out, err, in)
+	}
+	partial, err := Decrypt[Payment](testKey, enc, ring, WithFields("Cards[0].Number"))
+	if err != nil || partial.Cards[0].Number != "4111" {
+		t.Errorf("Decrypt() with WithFields = %+v, %v", partial, err)
+	}
+	matchesSequential[Payment, SecurePayment](t, testKey, AES_256_GCM, in, ring)
+
+	// A swapped keyring fails authentication at the first keyed field.
+	swapped := WithKeyring(Keyring{"pci": piiKey, "pii": pciKey})
+	var fieldErr *FieldError
+	if _, err = Decrypt[Payment](testKey, enc, swapped); !errors.As(err, &fieldErr) || fieldErr.Path != "Cards[0].Number" || !errors.Is(err, ErrAuthentication) {
+		t.Errorf("Decrypt() with swapped keys error = %v, want ErrAuthentication at Cards[0].Number", err)
+	}
+	if _, err = Encrypt[SecurePayment](testKey, AES_256_GCM, in); !errors.As(err, &fieldErr) || fieldErr.Path != "Cards" {
+		t.Errorf("Encrypt() without a keyring error = %v, want a FieldError at Cards", err)
+	}
+	// Empty slices reach no keyed leaf, but the key is still resolved.
+	if _, err = Encrypt[SecurePayment](testKey, AES_256_GCM, Payment{}, WithKeyring(Keyring{"pii": piiKey})); err == nil || !strings.Contains(err.Error(), `key "pci" is not in the keyring`) {
+		t.Errorf("Encrypt() with a missing key ID error = %v", err)
+	}
+}
+
+func TestStructFieldKeyTagErrors(t *testing.T) {
+	type P struct{ A string }
+	tests := []struct {
+		name string
+		enc  reflect.Type
+		want string
+	}{
+		{"unknown_option", reflect.TypeOf(struct {
+			A Ciphertext `transcrypt:",kye=pci"`
+		}{}), `unknown transcrypt tag option "kye=pci"`},
+		{"empty_key", reflect.TypeOf(struct {
+			A Ciphertext `transcrypt:",key="`
+		}{}), "needs a key ID"},
+		{"unknown_suite", reflect.TypeOf(struct {
+			A Ciphertext `transcrypt:",suite=ROT13"`
+		}{}), "ROT13"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckMirror(reflect.TypeOf(P{}), tt.enc)
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Path != "A" || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("CheckMirror() error = %v, want %q at A", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructDecryptInto(t *testing.T) {
+	in := testOuter()
+	enc, err := Encrypt[SecureOuter](testKey, AES_256_GCM, in)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	// dst holds a previous record: larger containers and stale values.
+	innerPtr := &Inner{Note: "stale"}
+	dst := Outer{
+		Name:     "stale",
+		InnerPtr: innerPtr,
+		Inners:   make([]Inner, 5, 8),
+		Tags:     make([]string, 0, 4),
+		Meta:     map[string]string{"gone": "x"},
+	}
+	inners, tags, meta := dst.Inners[:1], dst.Tags[:1], dst.Meta
+
+	for _, opts := range [][]Option{nil, {WithConcurrency(4)}} {
+		if err = DecryptInto(testKey, enc, &dst, opts...); err != nil {
+			t.Fatalf("DecryptInto() error = %v", err)
+		}
+		if !reflect.DeepEqual(dst, in) {
+			t.Errorf("DecryptInto() = %+v, want %+v", dst, in)
+		}
+		if &dst.Inners[0] != &inners[0] || &dst.Tags[0] != &tags[0] || reflect.ValueOf(dst.Meta).Pointer() != reflect.ValueOf(meta).Pointer() || dst.InnerPtr != innerPtr {
+			t.Error("DecryptInto() did not reuse the slices, map and pointer dst holds")
+		}
+	}
+
+	// Nil plain values clear what dst holds.
+	enc.InnerPtr, enc.Tags, enc.Meta = nil, nil, nil
+	if err = DecryptInto(testKey, enc, &dst); err != nil {
+		t.Fatalf("DecryptInto() error = %v", err)
+	}
+	if dst.InnerPtr != nil || dst.Tags != nil || dst.Meta != nil {
+		t.Errorf("DecryptInto() kept stale values: %+v", dst)
+	}
+
+	// Other targets are simply overwritten.
+	var n int
+	if err = DecryptInto(testKey, enc.Count, &n); err != nil || n != in.Count {
+		t.Errorf("DecryptInto() of a single value = %d, %v", n, err)
+	}
+	if err = DecryptInto(testKey, enc, dst); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("DecryptInto() into a non-pointer error = %v, want ErrUnsupportedType", err)
+	}
+}
+
+func TestStructEncryptInto(t *testing.T) {
+	e, err := NewEncryptor(testKey, WithConcurrency(4))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	dst := SecureOuter{Tags: make([]Ciphertext, 0, 4), Meta: map[string]Ciphertext{"gone": "x"}}
+	tags, meta := dst.Tags[:1], dst.Meta
+
+	in := testOuter()
+	if err = e.EncryptInto(&dst, in); err != nil {
+		t.Fatalf("EncryptInto() error = %v", err)
+	}
+	if &dst.Tags[0] != &tags[0] || reflect.ValueOf(dst.Meta).Pointer() != reflect.ValueOf(meta).Pointer() {
+		t.Error("EncryptInto() did not reuse the slice and map dst holds")
+	}
+	if _, stale := dst.Meta["gone"]; stale {
+		t.Error("EncryptInto() kept a stale map entry")
+	}
+	var out Outer
+	if err = e.DecryptInto(&out, dst); err != nil || !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip = %+v, %v; want %+v", out, err, in)
+	}
+
+	var s string
+	if err = EncryptInto(testKey, AES_256_GCM, "value", &s); err != nil || s == "" {
+		t.Errorf("EncryptInto() of a single value = %q, %v", s, err)
+	}
+}
+
+// Audit / SecureAudit are embedded by the records of the embedding tests.
+type Audit struct {
+	CreatedBy string
+	Revision  int
+}
+
+type SecureAudit struct {
+	CreatedBy Ciphertext
+	Revision  int
+}
+
+func TestStructEmbeddedFields(t *testing.T) {
+	type Record struct {
+		Audit
+		Name string
+	}
+	// The mirror embeds a differently named struct.
+	type SecureRecord struct {
+		SecureAudit
+		Name Ciphertext
+	}
+	// The mirror lists the promoted fields directly.
+	type FlatRecord struct {
+		CreatedBy Ciphertext
+		Revision  int
+		Name      Ciphertext
+	}
+	in := Record{Audit: Audit{CreatedBy: "alice", Revision: 3}, Name: "n"}
+
+	enc, err := Encrypt[SecureRecord](testKey, AES_256_GCM, in)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if enc.CreatedBy == "" || enc.Revision != 3 {
+		t.Errorf("Encrypt() = %+v, want CreatedBy encrypted and Revision copied", enc)
+	}
+	if out, err := Decrypt[Record](testKey, enc); err != nil || out != in {
+		t.Errorf("round trip = %+v, %v; want %+v", out, err, in)
+	}
+	matchesSequential[Record, SecureRecord](t, testKey, AES_256_GCM, in)
+
+	flat, err := Encrypt[FlatRecord](testKey, AES_256_GCM, in)
+	if err != nil {
+		t.Fatalf("Encrypt() into a flattened mirror error = %v", err)
+	}
+	if out, err := Decrypt[Record](testKey, flat); err != nil || out != in {
+		t.Errorf("flattened round trip = %+v, %v; want %+v", out, err, in)
+	}
+
+	// Promoted fields are selected by their own name.
+	partial, err := Decrypt[Record](testKey, enc, WithFields("CreatedBy"))
+	if err != nil || partial.CreatedBy != "alice" || partial.Name != "" {
+		t.Errorf("Decrypt() with WithFields = %+v, %v", partial, err)
+	}
+
+	// Promoted fields are matched as strictly as any other.
+	type Short struct {
+		SecureAudit
+	}
+	var fieldErr *FieldError
+	if _, err = Encrypt[Short](testKey, AES_256_GCM, in); !errors.As(err, &fieldErr) || fieldErr.Path != "Name" {
+		t.Errorf("Encrypt() error = %v, want a FieldError at Name", err)
+	}
+	type Extra struct {
+		SecureAudit
+		Name    Ciphertext
+		Deleted Ciphertext
+	}
+	if _, err = Encrypt[Extra](testKey, AES_256_GCM, in); !errors.As(err, &fieldErr) || fieldErr.Path != "Deleted" {
+		t.Errorf("Encrypt() error = %v, want a FieldError at Deleted", err)
+	}
+
+	// A tagged embedded struct is an ordinary field, mapped as a whole.
+	type Named struct {
+		Audit `transcrypt:"Audit"`
+		Name  string
+	}
+	type SecureNamed struct {
+		SecureAudit `transcrypt:"Audit"`
+		Name        Ciphertext
+	}
+	named := Named{Audit: in.Audit, Name: in.Name}
+	if enc, err := Encrypt[SecureNamed](testKey, AES_256_GCM, named); err != nil || enc.SecureAudit.CreatedBy == "" {
+		t.Errorf("Encrypt() of a tagged embedded struct = %+v, %v", enc, err)
+	}
+}
+
+func TestStructEmbeddedPointers(t *testing.T) {
+	type Record struct {
+		*Audit
+		Name string
+	}
+	type SecureRecord struct {
+		*SecureAudit
+		Name Ciphertext
+	}
+	type ValueRecord struct {
+		SecureAudit
+		Name Ciphertext
+	}
+
+	for _, in := range []Record{{Name: "n"}, {Audit: &Audit{CreatedBy: "alice"}, Name: "n"}} {
+		enc, err := Encrypt[SecureRecord](testKey, AES_256_GCM, in)
+		if err != nil {
+			t.Fatalf("Encrypt() error = %v", err)
+		}
+		if (in.Audit == nil) != (enc.SecureAudit == nil) {
+			t.Errorf("Encrypt() SecureAudit = %v, want nil only for a nil Audit", enc.SecureAudit)
+		}
+		out, err := Decrypt[Record](testKey, enc)
+		if err != nil || !reflect.DeepEqual(out, in) {
+			t.Errorf("round trip = %+v, %v; want %+v", out, err, in)
+		}
+		matchesSequential[Record, SecureRecord](t, testKey, AES_256_GCM, in)
+	}
+
+	// A pointer mirrored by a value, or by the promoted fields listed
+	// directly, leaves them zero for nil; zero fields decrypt back into a
+	// nil pointer, and set ones into an allocated pointer.
+	type FlatRecord struct {
+		CreatedBy Ciphertext
+		Revision  int
+		Name      Ciphertext
+	}
+	enc, err := Encrypt[ValueRecord](testKey, AES_256_GCM, Record{Name: "n"})
+	if err != nil || enc.SecureAudit != (SecureAudit{}) {
+		t.Fatalf("Encrypt() = %+v, %v; want a zero SecureAudit", enc, err)
+	}
+	for _, in := range []Record{{Name: "n"}, {Audit: &Audit{CreatedBy: "alice"}, Name: "n"}, {Audit: &Audit{}, Name: "n"}} {
+		value, err := Encrypt[ValueRecord](testKey, AES_256_GCM, in)
+		if err != nil {
+			t.Fatalf("Encrypt() error = %v", err)
+		}
+		if out, err := Decrypt[Record](testKey, value); err != nil || !reflect.DeepEqual(out, in) {
+			t.Errorf("round trip through a value = %+v, %v; want %+v", out, err, in)
+		}
+		flat, err := Encrypt[FlatRecord](testKey, AES_256_GCM, in)
+		if err != nil {
+			t.Fatalf("Encrypt() error = %v", err)
+		}
+		if out, err := Decrypt[Record](testKey, flat); err != nil || !reflect.DeepEqual(out, in) {
+			t.Errorf("round trip through promoted fields = %+v, %v; want %+v", out, err, in)
+		}
+		if out, err := Decrypt[Record](testKey, flat, WithFields("CreatedBy")); err != nil || (out.Audit == nil) != (in.Audit == nil) {
+			t.Errorf("Decrypt() with WithFields = %+v, %v; want Audit nil only for a nil Audit", out, err)
+		}
+	}
+	if enc, err = Encrypt[ValueRecord](testKey, AES_256_GCM, Record{Audit: &Audit{CreatedBy: "alice"}}); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	out, err := Decrypt[Record](testKey, enc)
+	if err != nil || out.Audit == nil || out.CreatedBy != "alice" {
+		t.Errorf("Decrypt() = %+v, %v; want an allocated Audit", out, err)
+	}
+
+	// Selecting a promoted field does not write through the caller's
+	// embedded pointer.
+	shared := &Audit{CreatedBy: "stale"}
+	dst := Record{Audit: shared}
+	if err = DecryptInto(testKey, enc, &dst, WithFields("CreatedBy")); err != nil || dst.CreatedBy != "alice" {
+		t.Errorf("DecryptInto() = %+v, %v", dst, err)
+	}
+	if shared.CreatedBy != "stale" {
+		t.Errorf("DecryptInto() wrote through the embedded pointer: %+v", shared)
+	}
+}
+
+func TestStructEmbeddedKeys(t *testing.T) {
+	auditKey := transcrypttest.Key("audit", 32)
+	type Record struct {
+		Audit
+		Name string
+	}
+	type SecureRecord struct {
+		SecureAudit `transcrypt:",key=audit"`
+		Name        Ciphertext
+	}
+	ring := WithKeyring(Keyring{"audit": auditKey})
+	in := Record{Audit: Audit{CreatedBy: "alice"}, Name: "n"}
+
+	enc, err := Encrypt[SecureRecord](testKey, AES_256_GCM, in, ring)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if _, err := Decrypt[string](auditKey, enc.CreatedBy); err != nil {
+		t.Errorf("CreatedBy does not decrypt under the audit key: %v", err)
+	}
+	if out, err := Decrypt[Record](testKey, enc, ring); err != nil || out != in {
+		t.Errorf("round trip = %+v, %v; want %+v", out, err, in)
+	}
+}
+
+func TestStructEmbeddedConflicts(t *testing.T) {
+	type Other struct{ CreatedBy string }
+	type Base struct{ Revision int }
+	type Loop struct {
+		*Loop
+		Name string
+	}
+	tests := []struct {
+		name  string
+		plain reflect.Type
+		want  string
+	}{
+		// Go would hide both; here neither may be dropped.
+		{"ambiguous", reflect.TypeOf(struct {
+			Audit
+			Other
+		}{}), `fields Audit.CreatedBy and Other.CreatedBy both match as "CreatedBy"`},
+		// Go would shadow the promoted field.
+		{"shadowed", reflect.TypeOf(struct {
+			Audit
+			Revision int
+		}{}), `fields Audit.Revision and Revision both match as "Revision"`},
+		{"nested", reflect.TypeOf(struct {
+			Audit
+			Base
+		}{}), `fields Audit.Revision and Base.Revision both match as "Revision"`},
+		{"self", reflect.TypeOf(Loop{}), "embeds itself"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckMirror(tt.plain, reflect.TypeOf(SecureAudit{})); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("CheckMirror() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
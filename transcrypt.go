@@ -5,6 +5,7 @@
 // plain struct onto its encrypted mirror field by field (see structs.go), with
 // a mirror field typed Ciphertext as the encrypted leaf; a File target streams
 // a file on disk through the cipher into a binary sibling format (see file.go).
+// An Encryptor (see encryptor.go) bundles a key with options for repeated use.
 package transcrypt
 
 import (
@@ -13,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/minio/sio"
@@ -43,138 +45,205 @@ import (
 // copy the value verbatim rather than encrypt anything. A fresh random salt is
 // generated for every encrypted value, so encrypting twice never reuses the
 // same (key, nonce) pair.
-func Encrypt[E any](key []byte, cipherSuite CipherSuite, d any) (E, error) {
-	var zero E
-	encType := reflect.TypeOf((*E)(nil)).Elem()
+//
+// opts adjust the output (see Option); without any, single values use the
+// transcrypt encoding. Encrypt is shorthand for EncryptWith on an Encryptor
+// holding key, cipherSuite and opts; cipherSuite overrides any
+// WithCipherSuite among opts.
+func Encrypt[E any](key []byte, cipherSuite CipherSuite, d any, opts ...Option) (E, error) {
+	e := &Encryptor{key: key, opts: append(slices.Clone(opts), WithCipherSuite(cipherSuite))}
+	return EncryptWith[E](e, d)
+}
+
+// Decrypt decrypts data back into the target type P, mirroring Encrypt:
+//
+//   - P is an interface type (typically any): data must be an encoded string;
+//     the value is returned as whatever type was stored, recovered from inside
+//     the authenticated ciphertext;
+//   - P is a non-struct concrete type: data must be an encoded string; the
+//     decrypted value must have P's kind (named types of the same kind are
+//     converted, a kind mismatch is an error);
+//   - P is a struct type: data is the encrypted mirror struct and P the plain
+//     struct to rebuild, with every Ciphertext field decrypted individually;
+//   - P is File: data must be a File naming the encrypted file; its content is
+//     streamed back into File.Target (in place when Target is empty), and the
+//     returned File carries the resolved Target.
+//
+// Calls name the target explicitly: Decrypt[any](key, s) keeps the stored
+// type, Decrypt[int64](key, s) enforces it, Decrypt[Data](key, secureData)
+// rebuilds a struct, Decrypt[File](key, File{Source: path}) restores a file.
+//
+// opts must select the same encoding the data was produced with. Decrypt is
+// shorthand for DecryptWith on an Encryptor holding key and opts.
+func Decrypt[P any](key []byte, data any, opts ...Option) (P, error) {
+	return DecryptWith[P](&Encryptor{key: key, opts: opts}, data)
+}
+
+// EncryptInto encrypts d into the value dst points to, whose type selects the
+// target like the type parameter of Encrypt. A mirror struct is filled in
+// place rather than built anew, reusing the capacity of its slices and maps
+// and the pointers it holds: a hot loop encrypting into the same value
+// allocates little beyond the ciphertexts. Other targets are simply
+// overwritten.
+//
+// The walker rules are those of Encrypt: every field the plan maps is
+// overwritten, nil plain values set nil, and maps are cleared before being
+// refilled. Fields outside the mapping (see WithMatching) keep their values.
+// Unlike Encryptor.Encrypt, a failed struct encryption can leave dst
+// partially written.
+func EncryptInto(key []byte, cipherSuite CipherSuite, d any, dst any, opts ...Option) error {
+	e := &Encryptor{key: key, opts: append(slices.Clone(opts), WithCipherSuite(cipherSuite))}
+	return e.EncryptInto(dst, d)
+}
+
+// DecryptInto decrypts data into the value dst points to, mirroring
+// EncryptInto: a plain struct is filled in place, reusing the capacity of its
+// slices and maps and the pointers it holds, for ORMs and decoders that hand
+// out a pointer to populate. A failed struct decryption can leave dst
+// partially written.
+func DecryptInto(key []byte, data any, dst any, opts ...Option) error {
+	return (&Encryptor{key: key, opts: opts}).DecryptInto(dst, data)
+}
 
+// encryptTo encrypts d into a value of type encType; it implements Encrypt
+// for every target type, see there. into, if valid, is the destination, which
+// a struct encryption in place (see EncryptInto) fills directly.
+func encryptTo(key []byte, encType reflect.Type, d any, into reflect.Value, o *options) (reflect.Value, error) {
 	// File is streaming file encryption, intercepted by concrete type before
 	// the kind switch because File is itself a struct type.
 	if encType == fileType {
 		f, ok := d.(File)
 		if !ok {
-			return zero, fmt.Errorf("encryption target File requires a File value, got %T", d)
+			return reflect.Value{}, fmt.Errorf("%w: encryption target File requires a File value, got %T", ErrUnsupportedType, d)
 		}
-		out, err := encryptFile(key, cipherSuite, f)
+		out, err := encryptFile(key, o.cipherSuite, f, o)
 		if err != nil {
-			return zero, err
+			return reflect.Value{}, err
 		}
-		return any(out).(E), nil
+		return reflect.ValueOf(out), nil
 	}
 
 	switch encType.Kind() {
 	case reflect.String:
-		encrypted, err := encryptScalar(key, cipherSuite, d)
+		encrypted, err := encryptScalar(key, o.cipherSuite, d, o)
 		if err != nil {
-			return zero, err
+			return reflect.Value{}, err
 		}
-		return reflect.ValueOf(encrypted).Convert(encType).Interface().(E), nil
+		return reflect.ValueOf(encrypted).Convert(encType), nil
 	case reflect.Struct:
 		if d == nil {
-			return zero, errors.New("plain value is nil")
+			return reflect.Value{}, errors.New("plain value is nil")
 		}
 		plainValue := reflect.ValueOf(d)
 		if plainValue.Kind() != reflect.Struct {
-			return zero, fmt.Errorf("plain value must be a struct, got %T", d)
+			return reflect.Value{}, fmt.Errorf("%w: plain value must be a struct, got %T", ErrUnsupportedType, d)
 		}
 		// Identical types are copied verbatim by the walker, which is correct for
 		// nested fields but means a top-level call with E == d's type would
 		// return the plaintext unchanged while looking like a successful
 		// encryption. Reject that instead of silently not encrypting.
 		if plainValue.Type() == encType {
-			return zero, fmt.Errorf("encryption target %s is the plain type itself: nothing would be encrypted; use a mirror struct with Ciphertext fields", encType)
+			return reflect.Value{}, fmt.Errorf("%w: encryption target %s is the plain type itself: nothing would be encrypted; use a mirror struct with Ciphertext fields", ErrUnsupportedType, encType)
 		}
-		out, err := encryptValue(key, cipherSuite, plainValue, encType, "", nil)
+		p, err := planFor(plainValue.Type(), encType, o.matching)
 		if err != nil {
-			return zero, err
+			return reflect.Value{}, err
+		}
+		out := reflect.New(encType).Elem()
+		if o.inPlace {
+			out = into
+		}
+		w := newStructWalk(key, o)
+		if err = w.finish(w.encrypt(p, plainValue, out, ""), true); err != nil {
+			return reflect.Value{}, err
 		}
-		return out.Interface().(E), nil
+		return out, nil
 	default:
-		return zero, fmt.Errorf("unsupported encryption target %s: use a string type for single values or a mirror struct type", encType)
+		return reflect.Value{}, fmt.Errorf("%w: encryption target %s: use a string type for single values or a mirror struct type", ErrUnsupportedType, encType)
 	}
 }
 
-// Decrypt decrypts data back into the target type P, mirroring Encrypt:
-//
-//   - P is an interface type (typically any): data must be an encoded string;
-//     the value is returned as whatever type was stored, recovered from inside
-//     the authenticated ciphertext;
-//   - P is a non-struct concrete type: data must be an encoded string; the
-//     decrypted value must have P's kind (named types of the same kind are
-//     converted, a kind mismatch is an error);
-//   - P is a struct type: data is the encrypted mirror struct and P the plain
-//     struct to rebuild, with every Ciphertext field decrypted individually;
-//   - P is File: data must be a File naming the encrypted file; its content is
-//     streamed back into File.Target (in place when Target is empty), and the
-//     returned File carries the resolved Target.
-//
-// Calls name the target explicitly: Decrypt[any](key, s) keeps the stored
-// type, Decrypt[int64](key, s) enforces it, Decrypt[Data](key, secureData)
-// rebuilds a struct, Decrypt[File](key, File{Source: path}) restores a file.
-func Decrypt[P any](key []byte, data any) (P, error) {
-	var zero P
-	plainType := reflect.TypeOf((*P)(nil)).Elem()
-
+// decryptTo decrypts data into a value of type plainType; it implements
+// Decrypt for every target type, see there. For an interface plainType the
+// result holds the stored value's own type. into, if valid, is the
+// destination, whose current value a selective struct decryption (see
+// WithFields) starts from, and which a struct decryption in place (see
+// DecryptInto) fills directly.
+func decryptTo(key []byte, plainType reflect.Type, data any, into reflect.Value, o *options) (reflect.Value, error) {
 	// File is streaming file decryption, intercepted by concrete type before
 	// the kind switch because File is itself a struct type.
 	if plainType == fileType {
 		f, ok := data.(File)
 		if !ok {
-			return zero, fmt.Errorf("decryption target File requires a File value, got %T", data)
+			return reflect.Value{}, fmt.Errorf("%w: decryption target File requires a File value, got %T", ErrUnsupportedType, data)
 		}
-		out, err := decryptFile(key, f)
+		out, err := decryptFile(key, f, o)
 		if err != nil {
-			return zero, err
+			return reflect.Value{}, err
 		}
-		return any(out).(P), nil
+		return reflect.ValueOf(out), nil
 	}
 
 	switch plainType.Kind() {
 	case reflect.Interface:
 		encoded, err := encodedString(data)
 		if err != nil {
-			return zero, err
+			return reflect.Value{}, err
 		}
-		decrypted, err := decryptScalar(key, encoded)
+		decrypted, err := decryptScalar(key, encoded, o)
 		if err != nil {
-			return zero, err
+			return reflect.Value{}, err
 		}
-		out, ok := decrypted.(P)
-		if !ok {
-			return zero, fmt.Errorf("decrypted value of type %T does not implement %s", decrypted, plainType)
-		}
-		return out, nil
+		return fitValue(reflect.ValueOf(decrypted), plainType)
 	case reflect.Struct:
 		if data == nil {
-			return zero, errors.New("encrypted value is nil")
+			return reflect.Value{}, errors.New("encrypted value is nil")
 		}
 		encValue := reflect.ValueOf(data)
 		if encValue.Kind() != reflect.Struct {
-			return zero, fmt.Errorf("encrypted value must be a struct, got %T", data)
+			return reflect.Value{}, fmt.Errorf("%w: encrypted value must be a struct, got %T", ErrUnsupportedType, data)
 		}
-		// Mirror of the guard in Encrypt: P == data's type would copy the value
-		// verbatim without decrypting anything.
+		// Mirror of the guard in encryptTo: P == data's type would copy the
+		// value verbatim without decrypting anything.
 		if encValue.Type() == plainType {
-			return zero, fmt.Errorf("decryption target %s is the encrypted type itself: nothing would be decrypted; use the plain mirror struct", plainType)
+			return reflect.Value{}, fmt.Errorf("%w: decryption target %s is the encrypted type itself: nothing would be decrypted; use the plain mirror struct", ErrUnsupportedType, plainType)
+		}
+		out := reflect.New(plainType).Elem()
+		if o.inPlace {
+			out = into
+		}
+		w := newStructWalk(key, o)
+		if o.fields != nil {
+			sel, err := parseSelection(o.fields)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			if into.IsValid() && !o.inPlace {
+				out.Set(into)
+			}
+			if err = w.finish(w.selectDecrypt(sel, encValue, out, ""), false); err != nil {
+				return reflect.Value{}, err
+			}
+			return out, nil
 		}
-		out, err := decryptValue(key, encValue, plainType, "", nil)
+		p, err := planFor(plainType, encValue.Type(), o.matching)
 		if err != nil {
-			return zero, err
+			return reflect.Value{}, err
 		}
-		return out.Interface().(P), nil
+		if err = w.finish(w.decrypt(p, encValue, out, ""), false); err != nil {
+			return reflect.Value{}, err
+		}
+		return out, nil
 	default:
 		encoded, err := encodedString(data)
 		if err != nil {
-			return zero, err
-		}
-		decrypted, err := decryptScalar(key, encoded)
-		if err != nil {
-			return zero, err
+			return reflect.Value{}, err
 		}
-		out, err := fitValue(reflect.ValueOf(decrypted), plainType)
+		decrypted, err := decryptScalar(key, encoded, o)
 		if err != nil {
-			return zero, err
+			return reflect.Value{}, err
 		}
-		return out.Interface().(P), nil
+		return fitValue(reflect.ValueOf(decrypted), plainType)
 	}
 }
 
@@ -184,60 +253,102 @@ func Decrypt[P any](key []byte, data any) (P, error) {
 func encodedString(data any) (string, error) {
 	v := reflect.ValueOf(data)
 	if !v.IsValid() || v.Kind() != reflect.String {
-		return "", fmt.Errorf("encrypted data must be a string, got %T", data)
+		return "", fmt.Errorf("%w: encrypted data must be a string, got %T", ErrUnsupportedType, data)
 	}
 	return v.String(), nil
 }
 
+// rawBytes is the decrypted payload of an encoding that carries no type tag
+// (e.g. a Fernet token). Unlike a typed value, whose kind is authenticated and
+// must match the target, there is no stored kind to enforce, so fitValue lets
+// it fill any string-kind or []byte target.
+type rawBytes []byte
+
+var rawBytesType = reflect.TypeOf(rawBytes(nil))
+
 // fitValue fits a decrypted value into the target type. An exact type match is
 // returned as-is and a named type of the same kind is converted, but a kind
 // mismatch is an error: the kind recovered from the authenticated ciphertext
 // always wins, so a stored value can never be relabeled as a different kind.
+// Untyped rawBytes are the exception, see rawBytes. An interface target
+// takes the value with its stored type, if that implements the interface.
 func fitValue(v reflect.Value, target reflect.Type) (reflect.Value, error) {
+	if target.Kind() == reflect.Interface {
+		// Untyped payloads surface as a plain []byte, the closest to what
+		// was stored.
+		if v.Type() == rawBytesType {
+			v = v.Convert(reflect.TypeOf([]byte(nil)))
+		}
+		if !v.Type().Implements(target) {
+			return reflect.Value{}, fmt.Errorf("%w: decrypted value of type %s does not implement %s", ErrKindMismatch, v.Type(), target)
+		}
+		return v, nil
+	}
+	if v.Type() == rawBytesType {
+		switch {
+		case target.Kind() == reflect.String:
+			return reflect.ValueOf(string(v.Bytes())).Convert(target), nil
+		case target.Kind() == reflect.Slice && target.Elem().Kind() == reflect.Uint8:
+			return v.Convert(target), nil
+		}
+		return reflect.Value{}, fmt.Errorf("%w: decrypted value is untyped bytes, which do not fit target type %s", ErrKindMismatch, target)
+	}
 	if v.Type() == target {
 		return v, nil
 	}
 	if v.Kind() == target.Kind() && v.Type().ConvertibleTo(target) {
 		return v.Convert(target), nil
 	}
-	return reflect.Value{}, fmt.Errorf("decrypted value has kind %s, which does not fit target type %s", v.Kind(), target)
+	return reflect.Value{}, fmt.Errorf("%w: decrypted value has kind %s, which does not fit target type %s", ErrKindMismatch, v.Kind(), target)
 }
 
 // decryptScalar decrypts a supplied hex-encoded data string using the supplied secret key.
 // It will return an error if either the key or the data is empty.
 // If the hex-encoded string data cannot be converted into proper encrypted data, decryption will also fail with an error.
-func decryptScalar(key []byte, data string) (any, error) {
+// With another encoding selected in o, data is decoded in that format instead;
+// a value without a type tag is returned as rawBytes.
+func decryptScalar(key []byte, data string, o *options) (any, error) {
 	if len(key) == 0 {
 		return nil, errors.New("key is empty")
 	}
 	if data == "" {
 		return nil, errors.New("data is empty")
 	}
+	switch o.encoding {
+	case EncodingFernet:
+		return decryptFernet(key, data, o)
+	case EncodingJWE:
+		return decryptJWE(key, data, o)
+	}
 
 	var err error
 	var encryptedData []byte
 	var cryptoConfig sio.Config
 
-	if encryptedData, cryptoConfig, err = decodeHexString(key, data); err != nil {
+	if encryptedData, cryptoConfig, err = decodeHexString(key, data, o); err != nil {
 		return nil, err
 	}
 
 	var decryptedData *bytes.Buffer
 	decryptedData = bytes.NewBuffer(make([]byte, 0))
 	if _, err = sio.Decrypt(decryptedData, bytes.NewBuffer(encryptedData), cryptoConfig); err != nil {
-		return nil, fmt.Errorf("decrypt failed: %w", err)
+		return nil, fmt.Errorf("decrypt failed: %w: %w", ErrAuthentication, err)
 	}
 
 	// Recover the type tag from the authenticated plaintext. Because it was inside
 	// the ciphertext, a tampered tag would already have failed sio.Decrypt above.
-	var kindName, hexPayload string
-	if kindName, hexPayload, err = decodeInnerPayload(decryptedData.String()); err != nil {
+	var tag innerTag
+	var hexPayload string
+	if tag, hexPayload, err = decodeInnerPayload(decryptedData.String()); err != nil {
+		return nil, err
+	}
+	if err = o.checkValidity(tag.issuedAt, tag.expiresAt); err != nil {
 		return nil, err
 	}
 
-	kind := getKindForString(kindName)
+	kind := getKindForString(tag.kind)
 	if kind == reflect.Invalid {
-		return nil, fmt.Errorf("cannot decode kind %q", kindName)
+		return nil, fmt.Errorf("%w: cannot decode kind %q", ErrUnsupportedType, tag.kind)
 	}
 
 	var outputValue reflect.Value
@@ -252,8 +363,9 @@ func decryptScalar(key []byte, data string) (any, error) {
 // It will return an error if the key is shorter than minKeyLength bytes or the data is nil.
 // Additionally, if the necessary cryptographic configuration cannot be created using the supplied cipherSuite, it will return an error.
 // A fresh random nonce is generated for every call, so encrypting twice never
-// reuses the same (key, nonce) pair.
-func encryptScalar(key []byte, cipherSuite CipherSuite, d any) (string, error) {
+// reuses the same (key, nonce) pair. The encoding selected in o decides the
+// output format.
+func encryptScalar(key []byte, cipherSuite CipherSuite, d any, o *options) (string, error) {
 	if len(key) < minKeyLength {
 		return "", fmt.Errorf("key must be at least %d bytes", minKeyLength)
 	}
@@ -263,7 +375,14 @@ func encryptScalar(key []byte, cipherSuite CipherSuite, d any) (string, error) {
 	}
 
 	if !cipherSuite.isValid() {
-		return "", fmt.Errorf("unknown cipher suite: %d", cipherSuite)
+		return "", fmt.Errorf("%w: %d", ErrUnknownCipherSuite, cipherSuite)
+	}
+
+	switch o.encoding {
+	case EncodingFernet:
+		return encryptFernet(key, d, o)
+	case EncodingJWE:
+		return encryptJWE(key, cipherSuite, d, o)
 	}
 
 	var err error
@@ -274,14 +393,20 @@ func encryptScalar(key []byte, cipherSuite CipherSuite, d any) (string, error) {
 	}
 
 	// Frame the type tag together with the payload so both are encrypted as one
-	// unit; this keeps the type authenticated by the AEAD and immune to tampering.
-	plaintext := encodeInnerPayload(reflect.TypeOf(d).Kind().String(), hexPayload)
+	// unit; this keeps the type (and the validity window, if stamped)
+	// authenticated by the AEAD and immune to tampering.
+	tag := innerTag{kind: reflect.TypeOf(d).Kind().String()}
+	tag.issuedAt, tag.expiresAt = o.stamp()
+	plaintext, err := padInnerPayload(encodeInnerPayload(tag, hexPayload), o.padding)
+	if err != nil {
+		return "", err
+	}
 
 	// A nil salt makes createCryptoConfig generate a fresh random one per call and
 	// return it so it can be stored; the AEAD nonce is derived from it.
 	var cryptoConfig sio.Config
-	var salt []byte
-	if cryptoConfig, salt, err = createCryptoConfig(key, []byte{byte(cipherSuite)}, nil, nil); err != nil {
+	var salt, commitment []byte
+	if cryptoConfig, salt, commitment, err = createCryptoConfig(o.rand(), key, []byte{byte(cipherSuite)}, nil, nil, nil); err != nil {
 		return "", err
 	}
 
@@ -292,13 +417,19 @@ func encryptScalar(key []byte, cipherSuite CipherSuite, d any) (string, error) {
 
 	// Encode all details in hex before joining together. Field 2 is the HKDF salt
 	// (the nonce is derived from it); the type tag lives inside the ciphertext.
-	encryptedString := strings.Join(
-		[]string{
-			hex.EncodeToString([]byte{byte(cipherSuite)}),
-			hex.EncodeToString(salt),
-			hex.EncodeToString(encryptedData.Bytes()),
-		}, ":",
-	)
+	// The key commitment, if requested, sits between the salt and the data.
+	fields := []string{
+		hex.EncodeToString([]byte{byte(cipherSuite)}),
+		hex.EncodeToString(salt),
+	}
+	if o.keyCommitment {
+		fields = append(fields, hex.EncodeToString(commitment))
+	}
+	if o.keyID {
+		fields = append(fields, Fingerprint(key))
+	}
+	fields = append(fields, hex.EncodeToString(encryptedData.Bytes()))
+	encryptedString := strings.Join(fields, ":")
 
 	if !regexEncryptedString.MatchString(encryptedString) {
 		return "", fmt.Errorf("could not validate encrypted data")
@@ -0,0 +1,68 @@
+// Package transcrypttest provides deterministic randomness for testing code
+// that uses transcrypt. Every salt, IV and generated key is drawn from an
+// io.Reader that can be replaced (see transcrypt.WithRandom and
+// transcrypt.CreateKeyFrom); feeding it a Reader from this package makes
+// encrypted output reproducible, so encrypted fixtures can be compared
+// byte for byte, and FailingReader injects RNG failures.
+//
+// The readers are predictable by design. Never use them outside tests:
+// reusing a salt under the same key reuses the derived key and nonce.
+package transcrypttest
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// NewReader returns an endless, deterministic stream of pseudo-random bytes
+// derived from seed: the ChaCha20 keystream under SHA-256(seed) and a zero
+// nonce. Equal seeds yield equal streams, on every platform and Go version.
+func NewReader(seed string) io.Reader {
+	key := sha256.Sum256([]byte(seed))
+	// The key and nonce sizes are fixed, so this cannot fail.
+	c, _ := chacha20.NewUnauthenticatedCipher(key[:], make([]byte, chacha20.NonceSize))
+	return &keystream{cipher: c}
+}
+
+type keystream struct {
+	cipher *chacha20.Cipher
+}
+
+func (k *keystream) Read(p []byte) (int, error) {
+	clear(p)
+	k.cipher.XORKeyStream(p, p)
+	return len(p), nil
+}
+
+// Key returns a deterministic key of size bytes derived from seed, e.g. to
+// pair with NewReader in a fixture test.
+func Key(seed string, size int) []byte {
+	b := make([]byte, size)
+	_, _ = io.ReadFull(NewReader("key:"+seed), b)
+	return b
+}
+
+// FailingReader returns a Reader that yields n bytes from r and then fails
+// every read with err, to exercise the handling of RNG failures at a chosen
+// point.
+func FailingReader(r io.Reader, n int64, err error) io.Reader {
+	return &failingReader{r: io.LimitReader(r, n), err: err}
+}
+
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		if n > 0 {
+			return n, nil
+		}
+		return 0, f.err
+	}
+	return n, err
+}
@@ -0,0 +1,66 @@
+package transcrypttest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestNewReader_Deterministic(t *testing.T) {
+	a := make([]byte, 100)
+	b := make([]byte, 100)
+	if _, err := io.ReadFull(NewReader("seed"), a); err != nil {
+		t.Fatal(err)
+	}
+	// Reading in small chunks yields the same stream.
+	r := NewReader("seed")
+	for i := 0; i < len(b); i += 7 {
+		if _, err := io.ReadFull(r, b[i:min(i+7, len(b))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("equal seeds produced different streams")
+	}
+
+	c := make([]byte, 100)
+	_, _ = io.ReadFull(NewReader("other"), c)
+	if bytes.Equal(a, c) {
+		t.Error("different seeds produced the same stream")
+	}
+
+	// Pin the stream so it never changes between releases: fixtures depend
+	// on it.
+	if got, want := hex.EncodeToString(a[:8]), "e9f5d902aebb39aa"; got != want {
+		t.Errorf("stream prefix = %s, want %s", got, want)
+	}
+}
+
+func TestKey(t *testing.T) {
+	if !bytes.Equal(Key("k", 32), Key("k", 32)) {
+		t.Error("Key() is not deterministic")
+	}
+	if bytes.Equal(Key("k", 32), Key("j", 32)) {
+		t.Error("Key() ignores the seed")
+	}
+	if len(Key("k", 20)) != 20 {
+		t.Error("Key() returned the wrong size")
+	}
+}
+
+func TestFailingReader(t *testing.T) {
+	boom := errors.New("boom")
+	r := FailingReader(NewReader("seed"), 10, boom)
+	buf := make([]byte, 8)
+	if n, err := r.Read(buf); n != 8 || err != nil {
+		t.Fatalf("Read() = %d, %v; want 8, nil", n, err)
+	}
+	if n, err := r.Read(buf); n != 2 || err != nil {
+		t.Fatalf("Read() = %d, %v; want 2, nil", n, err)
+	}
+	if _, err := r.Read(buf); !errors.Is(err, boom) {
+		t.Errorf("Read() after n bytes error = %v, want %v", err, boom)
+	}
+}
@@ -0,0 +1,73 @@
+package transcrypt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// VerifyError reports where verification of an encrypted file failed. Offset
+// is the byte offset in the file of the failing part: 0 for a missing or
+// foreign header, the offset of the header field at fault, or the start of
+// the DARE package that did not authenticate. A stream cut off at a package
+// boundary fails at the offset where the missing package should begin. Err
+// is the underlying failure, so errors.Is matches the sentinel errors through
+// a VerifyError.
+type VerifyError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verification failed at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyFile checks that the encrypted file at path decrypts under key,
+// without writing any plaintext: it runs the same header checks and
+// authenticates every DARE package exactly as Decrypt[File] does, discarding
+// the output. It returns nil if the file would decrypt successfully and a
+// *VerifyError locating the failure otherwise. Errors that are not about the
+// file's content, such as an empty key or an unreadable path, are returned
+// as they are.
+//
+// opts are the decryption options, e.g. WithKeyCommitment to require a
+// committed file.
+func VerifyFile(key []byte, path string, opts ...Option) error {
+	return (&Encryptor{key: key, opts: opts}).VerifyFile(path)
+}
+
+// VerifyFile is the package-level VerifyFile with the key and options taken
+// from e.
+func (e *Encryptor) VerifyFile(path string) error {
+	if len(e.key) == 0 {
+		return errors.New("key is empty")
+	}
+	o := e.options()
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if err := o.checkFileOptions(); err != nil {
+		return err
+	}
+	key, err := o.callKey(e.key)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open file: %w", err)
+	}
+	defer f.Close()
+
+	// io.Discard never fails, so every error comes from reading the file.
+	if offset, err := decryptFileStream(key, f, io.Discard, o); err != nil {
+		return &VerifyError{Offset: offset, Err: err}
+	}
+	return nil
+}
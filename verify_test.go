@@ -0,0 +1,110 @@
+package transcrypt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", patternBytes(100_000))
+	enc := filepath.Join(dir, "enc")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: enc}); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	committed := filepath.Join(dir, "committed")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: committed}, WithKeyCommitment()); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	padded := filepath.Join(dir, "padded")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: padded}, WithPadding(PadPadme())); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	for _, path := range []string{enc, committed, padded} {
+		if err := VerifyFile(fileTestKey, path); err != nil {
+			t.Errorf("VerifyFile(%s) error = %v", filepath.Base(path), err)
+		}
+	}
+	// Verification writes nothing next to the file.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("directory holds %d entries after verification, want 4", len(entries))
+	}
+}
+
+func TestVerifyFile_FailureOffsets(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "plain", patternBytes(100_000))
+	enc := filepath.Join(dir, "enc")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: enc}); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	committed := filepath.Join(dir, "committed")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: committed}, WithKeyCommitment()); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	stamped := filepath.Join(dir, "stamped")
+	if _, err := Encrypt[File](fileTestKey, AES_256_GCM, File{Source: src, Target: stamped}, WithKeyCommitment(), WithKeyID()); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	data, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondPackage := int64(fileHeaderLength + darePackageLength)
+	flipped := append([]byte(nil), data...)
+	flipped[secondPackage+100] ^= 1
+
+	tests := []struct {
+		name       string
+		path       string
+		key        []byte
+		opts       []Option
+		wantOffset int64
+		want       error
+	}{
+		{"foreign", writeTestFile(t, dir, "foreign", []byte("plain text")), fileTestKey, nil, 0, ErrNotTranscryptFile},
+		{"wrong_key", enc, testKey, nil, int64(fileHeaderLength), ErrAuthentication},
+		{"wrong_key_committed", committed, testKey, nil, int64(fileHeaderLength), ErrAuthentication},
+		{"wrong_key_id", stamped, testKey, nil, int64(fileHeaderLength + 1 + commitmentLength), ErrAuthentication},
+		{"commitment_required", enc, fileTestKey, []Option{WithKeyCommitment()}, fileVersionOffset, ErrAuthentication},
+		{"tampered_second_package", writeTestFile(t, dir, "flipped", flipped), fileTestKey, nil, secondPackage, ErrAuthentication},
+		{"cut_at_boundary", writeTestFile(t, dir, "cut", data[:secondPackage]), fileTestKey, nil, secondPackage, ErrAuthentication},
+		{"cut_in_second_package", writeTestFile(t, dir, "cut2", data[:len(data)-5]), fileTestKey, nil, secondPackage, ErrAuthentication},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyFile(tt.key, tt.path, tt.opts...)
+			var verifyErr *VerifyError
+			if !errors.As(err, &verifyErr) {
+				t.Fatalf("VerifyFile() error = %v, want *VerifyError", err)
+			}
+			if verifyErr.Offset != tt.wantOffset {
+				t.Errorf("Offset = %d, want %d (%v)", verifyErr.Offset, tt.wantOffset, err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("VerifyFile() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyFile_Errors(t *testing.T) {
+	dir := t.TempDir()
+	var verifyErr *VerifyError
+	if err := VerifyFile(nil, filepath.Join(dir, "x")); err == nil || errors.As(err, &verifyErr) {
+		t.Errorf("VerifyFile() with an empty key error = %v, want a plain error", err)
+	}
+	if err := VerifyFile(fileTestKey, filepath.Join(dir, "missing")); !errors.Is(err, os.ErrNotExist) || errors.As(err, &verifyErr) {
+		t.Errorf("VerifyFile() of a missing file error = %v, want os.ErrNotExist", err)
+	}
+	if err := VerifyFile(fileTestKey, filepath.Join(dir, "x"), WithEncoding(EncodingJWE)); err == nil {
+		t.Error("VerifyFile() with a string encoding expected error")
+	}
+}